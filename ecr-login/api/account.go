@@ -0,0 +1,93 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache"
+	log "github.com/cihub/seelog"
+)
+
+// defaultRegistryKey is the key of the default registry of the credentials in identityCache.
+const defaultRegistryKey = "default"
+
+// ErrCrossAccountNotAllowed is returned, wrapped with both accounts, when the requested registry belongs to another
+// account than the credentials and AllowCrossAccount is not set.
+var ErrCrossAccountNotAllowed = errors.New("cross-account registry is not allowed")
+
+// checkOwnAccount returns ErrCrossAccountNotAllowed if registry is not the default registry of the credentials and
+// AllowCrossAccount is not set. An empty registry stands for the default registry. When the account of the
+// credentials cannot be determined the check is skipped, with a warning.
+func (self *defaultClient) checkOwnAccount(registry string, warn *warnings) error {
+	if self.options.AllowCrossAccount || registry == "" {
+		return nil
+	}
+	account, err := self.ownAccount()
+	if err != nil {
+		log.Warnf("Skipping the cross-account check for %s, cannot determine the account of the credentials: %v", registry, err)
+		warn.add("the cross-account check for %s was skipped, the account of the credentials cannot be determined: %v", registry, err)
+		return nil
+	}
+	if account != registry {
+		return fmt.Errorf("%w: registry %s is not in account %s", ErrCrossAccountNotAllowed, registry, account)
+	}
+	return nil
+}
+
+// ownAccount returns the account of the credentials, cached for IdentityTTL by the identity resolver.
+func (self *defaultClient) ownAccount() (string, error) {
+	return self.identityResolver().resolve(self.options.identityTTL(), time.Now(), self.lookupOwnAccount)
+}
+
+// lookupOwnAccount looks up the account of the credentials. The vendored SDK has no STS client, so the account is
+// read from the proxy endpoint of the default registry, which ECR returns when no registry is requested. With a
+// shared cache, the proxy endpoint is kept in identityCache for IdentityTTL, without the token, so that the other
+// processes using the same credentials do not look it up again.
+func (self *defaultClient) lookupOwnAccount() (string, error) {
+	if self.identityCache != nil {
+		if entry := self.identityCache.Get(defaultRegistryKey); entry != nil && time.Now().Before(entry.ExpiresAt) {
+			if account := registryFromImage(entry.ProxyEndpoint); account != "" {
+				return account, nil
+			}
+		}
+	}
+
+	log.Debug("Calling ECR.GetAuthorizationToken for the default registry")
+	output, err := self.ecrClient.GetAuthorizationToken(&ecr.GetAuthorizationTokenInput{})
+	if err != nil {
+		return "", classifyECRError(err)
+	}
+	if output != nil {
+		for _, authData := range output.AuthorizationData {
+			proxyEndpoint := aws.StringValue(authData.ProxyEndpoint)
+			if account := registryFromImage(proxyEndpoint); account != "" {
+				if self.identityCache != nil {
+					now := time.Now()
+					self.identityCache.Set(defaultRegistryKey, &cache.AuthEntry{
+						RequestedAt:   now,
+						ExpiresAt:     now.Add(self.options.identityTTL()),
+						ProxyEndpoint: proxyEndpoint,
+					})
+				}
+				return account, nil
+			}
+		}
+	}
+	return "", errors.New("no default registry in the ECR response")
+}
@@ -0,0 +1,217 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api/mocks"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+// registryTokenOutput is a GetAuthorizationToken response for registry.
+func registryTokenOutput(registry string) *ecr.GetAuthorizationTokenOutput {
+	return &ecr.GetAuthorizationTokenOutput{
+		AuthorizationData: []*ecr.AuthorizationData{
+			&ecr.AuthorizationData{
+				ProxyEndpoint:      aws.String(proxyEndpointScheme + registryHost(registry)),
+				ExpiresAt:          aws.Time(time.Now().Add(12 * time.Hour)),
+				AuthorizationToken: aws.String(base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword))),
+			},
+		},
+	}
+}
+
+func expectOwnAccountLookup(ecrClient *mock_ecriface.MockECRAPI, account string) {
+	ecrClient.EXPECT().GetAuthorizationToken(&ecr.GetAuthorizationTokenInput{}).Return(registryTokenOutput(account), nil)
+}
+
+func TestCrossAccountCheckAllowsOwnAccount(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: cache.NewNullCredentialsCache(),
+	}
+
+	expectOwnAccountLookup(ecrClient, registryID)
+	ecrClient.EXPECT().GetAuthorizationToken(&ecr.GetAuthorizationTokenInput{
+		RegistryIds: []*string{aws.String(registryID)},
+	}).Return(registryTokenOutput(registryID), nil).Times(2)
+
+	// The account is looked up once per client.
+	for i := 0; i < 2; i++ {
+		creds, err := client.GetCredentials(registryID, registryHost(registryID)+"/myimage")
+		assert.Nil(t, err)
+		assert.Equal(t, expectedPassword, creds.Password)
+	}
+}
+
+func TestCrossAccountDeniedByDefault(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: cache.NewNullCredentialsCache(),
+	}
+
+	expectOwnAccountLookup(ecrClient, registryID)
+
+	creds, err := client.GetCredentials(otherRegistryID, registryHost(otherRegistryID)+"/myimage")
+	assert.True(t, errors.Is(err, ErrCrossAccountNotAllowed), "%v", err)
+	assert.Nil(t, creds)
+}
+
+func TestCrossAccountAllowedWithOptIn(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: cache.NewNullCredentialsCache(),
+		options:         ClientOptions{AllowCrossAccount: true},
+	}
+
+	// The account is not looked up when cross-account registries are allowed.
+	ecrClient.EXPECT().GetAuthorizationToken(&ecr.GetAuthorizationTokenInput{
+		RegistryIds: []*string{aws.String(otherRegistryID)},
+	}).Return(registryTokenOutput(otherRegistryID), nil)
+
+	creds, err := client.GetCredentials(otherRegistryID, registryHost(otherRegistryID)+"/myimage")
+	assert.Nil(t, err)
+	assert.Equal(t, expectedPassword, creds.Password)
+}
+
+func TestCrossAccountCheckLookupFailure(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: cache.NewNullCredentialsCache(),
+	}
+
+	ecrClient.EXPECT().GetAuthorizationToken(&ecr.GetAuthorizationTokenInput{}).Return(nil, awserr.New("ServerException", "internal error", nil))
+	ecrClient.EXPECT().GetAuthorizationToken(&ecr.GetAuthorizationTokenInput{
+		RegistryIds: []*string{aws.String(otherRegistryID)},
+	}).Return(registryTokenOutput(otherRegistryID), nil)
+
+	// The check is skipped with a warning rather than failing the fetch.
+	creds, err := client.GetCredentials(otherRegistryID, registryHost(otherRegistryID)+"/myimage")
+	assert.Nil(t, err)
+	if assert.NotNil(t, creds) {
+		assert.Equal(t, expectedPassword, creds.Password)
+		assert.Len(t, creds.Warnings, 1)
+	}
+}
+
+func TestIdentityResolvedOnceWithinTTL(t *testing.T) {
+	lookups := 0
+	lookup := func() (string, error) {
+		lookups++
+		return registryID, nil
+	}
+	resolver := &identityResolver{}
+	now := time.Now()
+	for _, at := range []time.Duration{0, time.Minute, 59 * time.Minute} {
+		account, err := resolver.resolve(time.Hour, now.Add(at), lookup)
+		assert.Nil(t, err)
+		assert.Equal(t, registryID, account)
+	}
+	assert.Equal(t, 1, lookups, "the account is resolved once within the TTL")
+	assert.Equal(t, registryID, resolver.cached(time.Hour, now.Add(30*time.Minute)))
+
+	_, err := resolver.resolve(time.Hour, now.Add(time.Hour), lookup)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, lookups, "the account is resolved again once the TTL has passed")
+	assert.Equal(t, "", resolver.cached(time.Hour, now.Add(3*time.Hour)))
+}
+
+func TestIdentityLookupFailureNotCached(t *testing.T) {
+	resolver := &identityResolver{}
+	_, err := resolver.resolve(time.Hour, time.Now(), func() (string, error) { return "", errors.New("unavailable") })
+	assert.NotNil(t, err)
+
+	account, err := resolver.resolve(time.Hour, time.Now(), func() (string, error) { return registryID, nil })
+	assert.Nil(t, err)
+	assert.Equal(t, registryID, account)
+}
+
+// resetIdentities forgets the identity resolvers shared by credentials once the test is done.
+func resetIdentities(t *testing.T) {
+	t.Cleanup(func() {
+		identities.Range(func(key, _ interface{}) bool {
+			identities.Delete(key)
+			return true
+		})
+	})
+}
+
+func TestIdentitySharedByCredentials(t *testing.T) {
+	resetIdentities(t)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+
+	p := principal{provider: "StaticProvider", accessKeyID: "AKIDSHAREDIDENTITY"}
+	newClient := func() *defaultClient {
+		return &defaultClient{
+			ecrClient:       ecrClient,
+			credentialCache: cache.NewNullCredentialsCache(),
+			principal:       p,
+			identity:        sharedIdentity(p, time.Hour, time.Now()),
+		}
+	}
+	assert.True(t, sharedIdentity(p, time.Hour, time.Now()) == sharedIdentity(p, time.Hour, time.Now()))
+	assert.Nil(t, sharedIdentity(principal{}, time.Hour, time.Now()))
+
+	expectOwnAccountLookup(ecrClient, registryID)
+	for i := 0; i < 2; i++ {
+		account, err := newClient().ownAccount()
+		assert.Nil(t, err)
+		assert.Equal(t, registryID, account)
+	}
+}
+
+func TestSharedIdentityEvictsStaleResolvers(t *testing.T) {
+	resetIdentities(t)
+	now := time.Now()
+	rotated := principal{provider: "StaticProvider", accessKeyID: "AKIDROTATED"}
+	current := principal{provider: "StaticProvider", accessKeyID: "AKIDCURRENT"}
+
+	resolver := sharedIdentity(rotated, time.Hour, now)
+	_, err := resolver.resolve(time.Hour, now, func() (string, error) { return registryID, nil })
+	assert.Nil(t, err)
+
+	assert.True(t, resolver == sharedIdentity(rotated, time.Hour, now.Add(59*time.Minute)), "a resolver is kept while it holds an account")
+	sharedIdentity(current, time.Hour, now.Add(2*time.Hour))
+	_, ok := identities.Load(rotated.accessKeyID)
+	assert.False(t, ok, "the resolver of credentials no longer used is evicted")
+	_, ok = identities.Load(current.accessKeyID)
+	assert.True(t, ok)
+}
@@ -0,0 +1,109 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	log "github.com/cihub/seelog"
+)
+
+// AuditRecord describes one issuance of credentials, without the token. The vendored SDK has no STS client to
+// resolve the ARN of the principal, so the credentials are identified by their provider and access key ID, which
+// is not secret. With CredentialSources these are the credentials of the first source. Account is set when the
+// account of the credentials was already resolved, for the cross-account check, and is not looked up for the record.
+type AuditRecord struct {
+	Time               time.Time `json:"time"`
+	Registry           string    `json:"registry"`
+	CredentialProvider string    `json:"credentialProvider"`
+	AccessKeyID        string    `json:"accessKeyId"`
+	Account            string    `json:"account,omitempty"`
+	CacheHit           bool      `json:"cacheHit"`
+	ExpiresAt          time.Time `json:"expiresAt"`
+}
+
+// AuditSink records every successful GetCredentials. An error is logged but does not fail the call.
+type AuditSink interface {
+	Audit(record AuditRecord) error
+}
+
+// auditLog appends audit records to a file as JSON lines.
+type auditLog struct {
+	path string
+	lock sync.Mutex
+}
+
+// NewAuditLog returns an AuditSink appending records to the file at path as JSON lines, creating it if needed.
+func NewAuditLog(path string) AuditSink {
+	return &auditLog{path: path}
+}
+
+func (a *auditLog) Audit(record AuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	file, err := os.OpenFile(a.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(line, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// principal identifies the credentials requests are signed with, in debug logs and audit records.
+type principal struct {
+	provider    string
+	accessKeyID string
+}
+
+// resolvePrincipal returns the principal of creds, which are resolved once and then reused by the SDK until they
+// expire. An empty principal is returned when they cannot be resolved.
+func resolvePrincipal(creds *credentials.Credentials) principal {
+	value, err := creds.Get()
+	if err != nil {
+		log.Debugf("Could not resolve credentials: %v", err)
+		return principal{}
+	}
+	log.Debugf("Using credentials from %s, access key %s", value.ProviderName, redactAccessKeyID(value.AccessKeyID))
+	return principal{provider: value.ProviderName, accessKeyID: value.AccessKeyID}
+}
+
+// audit sends the record of the credentials issued for registry to the AuditSink, if any.
+func (self *defaultClient) audit(registry string, cacheHit bool, creds *Credentials) {
+	if self.options.AuditSink == nil {
+		return
+	}
+	record := AuditRecord{
+		Time:               time.Now(),
+		Registry:           registry,
+		CredentialProvider: self.principal.provider,
+		AccessKeyID:        self.principal.accessKeyID,
+		Account:            self.identityResolver().cached(self.options.identityTTL(), time.Now()),
+		CacheHit:           cacheHit,
+		ExpiresAt:          creds.ExpiresAt,
+	}
+	if err := self.options.AuditSink.Audit(record); err != nil {
+		log.Warnf("Could not write the audit record for %s: %v", registry, err)
+	}
+}
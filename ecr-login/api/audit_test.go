@@ -0,0 +1,118 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api/mocks"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingAuditSink keeps the records it receives.
+type recordingAuditSink struct {
+	records []AuditRecord
+}
+
+func (r *recordingAuditSink) Audit(record AuditRecord) error {
+	r.records = append(r.records, record)
+	return nil
+}
+
+func TestGetCredentialsAudit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+	sink := &recordingAuditSink{}
+
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: cache.NewMemoryCredentialsCache(),
+		options:         ClientOptions{AllowCrossAccount: true, AuditSink: sink},
+		principal:       resolvePrincipal(credentials.NewStaticCredentials("AKIDEXAMPLE", "SECRET", "")),
+	}
+
+	expiresAt := time.Now().Add(12 * time.Hour)
+	ecrClient.EXPECT().GetAuthorizationToken(gomock.Any()).Return(&ecr.GetAuthorizationTokenOutput{
+		AuthorizationData: []*ecr.AuthorizationData{
+			&ecr.AuthorizationData{
+				ProxyEndpoint:      aws.String(proxyEndpointScheme + proxyEndpoint),
+				ExpiresAt:          aws.Time(expiresAt),
+				AuthorizationToken: aws.String(base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword))),
+			},
+		},
+	}, nil)
+
+	for i := 0; i < 2; i++ {
+		_, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+		assert.Nil(t, err)
+	}
+
+	if assert.Len(t, sink.records, 2) {
+		for i, record := range sink.records {
+			assert.Equal(t, registryID, record.Registry)
+			assert.Equal(t, "StaticProvider", record.CredentialProvider)
+			assert.Equal(t, "AKIDEXAMPLE", record.AccessKeyID)
+			assert.Equal(t, i == 1, record.CacheHit)
+			assert.True(t, expiresAt.Equal(record.ExpiresAt))
+			assert.False(t, record.Time.IsZero())
+
+			encoded, err := json.Marshal(record)
+			assert.Nil(t, err)
+			assert.False(t, strings.Contains(string(encoded), expectedPassword))
+			assert.False(t, strings.Contains(string(encoded), "SECRET"))
+		}
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink := NewAuditLog(path)
+	assert.Nil(t, sink.Audit(AuditRecord{Registry: registryID}))
+	assert.Nil(t, sink.Audit(AuditRecord{Registry: otherRegistryID, CacheHit: true}))
+
+	file, err := os.Open(path)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer file.Close()
+	var records []AuditRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record AuditRecord
+		assert.Nil(t, json.Unmarshal(scanner.Bytes(), &record))
+		records = append(records, record)
+	}
+	if assert.Len(t, records, 2) {
+		assert.Equal(t, registryID, records[0].Registry)
+		assert.Equal(t, otherRegistryID, records[1].Registry)
+		assert.True(t, records[1].CacheHit)
+	}
+
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
@@ -0,0 +1,62 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+// ErrECRUnavailableInRegion is returned when Amazon ECR has no endpoint in the region of the client, as in opt-in
+// regions ECR is not yet available in. It is distinct from network errors reaching an existing endpoint.
+var ErrECRUnavailableInRegion = errors.New("Amazon ECR is not available in the region")
+
+// resolveRegionEndpoint returns the ECR endpoint EndpointResolver resolves for region, or an error wrapping
+// ErrECRUnavailableInRegion when it resolves none. An empty endpoint leaves the SDK to derive it from the region.
+func (options ClientOptions) resolveRegionEndpoint(region string) (string, error) {
+	if options.EndpointResolver == nil || options.Endpoint != "" {
+		return "", nil
+	}
+	endpoint, err := options.EndpointResolver(region)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: %v", ErrECRUnavailableInRegion, region, err)
+	}
+	return endpoint, nil
+}
+
+// classifyRegionError wraps err in ErrECRUnavailableInRegion when the request for registry failed because the host
+// the SDK derived from the region does not exist, as ECR has no host in the regions it is not available in. There is
+// no list of regions to check this against, which would go stale, so DNS that is broken for that one host, such as
+// split-horizon DNS without an ECR record, is reported the same way; the error names the host to tell them apart.
+// Errors reaching an explicitly configured endpoint are returned unchanged, as the endpoint rather than the region is
+// at fault.
+func (self *defaultClient) classifyRegionError(registry string, err error) error {
+	if self.region == "" || self.options.Endpoint != "" || self.options.EndpointResolver != nil || self.overridesEndpoint(registry) {
+		return err
+	}
+	cause := err
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.OrigErr() != nil {
+		cause = awsErr.OrigErr()
+	}
+	var dnsErr *net.DNSError
+	if !errors.As(cause, &dnsErr) || !dnsErr.IsNotFound || !strings.Contains(dnsErr.Name, self.region) {
+		return err
+	}
+	return fmt.Errorf("%w: %s: no such host %s, check DNS if ECR is available in the region", ErrECRUnavailableInRegion,
+		self.region, dnsErr.Name)
+}
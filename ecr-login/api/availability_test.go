@@ -0,0 +1,122 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api/mocks"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewClientEndpointResolver(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "SECRET")
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_ECR_DISABLE_CACHE", "true")
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		token := base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword))
+		fmt.Fprintf(w, `{"authorizationData":[{"authorizationToken":%q,"expiresAt":%d,"proxyEndpoint":%q}]}`,
+			token, time.Now().Add(12*time.Hour).Unix(), proxyEndpointScheme+proxyEndpoint)
+	}))
+	defer server.Close()
+
+	// The stubbed resolver knows of ECR in us-west-2 only.
+	factory := DefaultClientFactory{Options: ClientOptions{
+		AllowCrossAccount: true,
+		EndpointResolver: func(region string) (string, error) {
+			if region != "us-west-2" {
+				return "", errors.New("no ecr endpoint")
+			}
+			return server.URL, nil
+		},
+	}}
+
+	_, err := factory.NewClient("xx-optin-1").GetCredentials(registryID, proxyEndpoint+"/myimage")
+	assert.True(t, errors.Is(err, ErrECRUnavailableInRegion), "%v", err)
+	assert.Contains(t, err.Error(), "xx-optin-1")
+	assert.Equal(t, 0, calls)
+
+	results, err := factory.NewClient("xx-optin-1").CheckPullPermissions(context.Background(), []string{registryID})
+	assert.Nil(t, err)
+	assert.True(t, errors.Is(results[registryID], ErrECRUnavailableInRegion), "%v", results[registryID])
+
+	creds, err := factory.NewClient("us-west-2").GetCredentials(registryID, proxyEndpoint+"/myimage")
+	assert.Nil(t, err)
+	assert.Equal(t, expectedPassword, creds.Password)
+	assert.Equal(t, 1, calls)
+}
+
+func TestGetAuthConfigRegionHostNotFound(t *testing.T) {
+	requestError := func(dnsErr *net.DNSError) error {
+		return awserr.New("RequestError", "send request failed", &url.Error{
+			Op:  "Post",
+			URL: "https://" + dnsErr.Name + "/",
+			Err: &net.OpError{Op: "dial", Net: "tcp", Err: dnsErr},
+		})
+	}
+	for _, tc := range []struct {
+		name        string
+		region      string
+		err         error
+		unavailable bool
+	}{
+		{"no such host", "xx-optin-1", requestError(&net.DNSError{Name: "ecr.xx-optin-1.amazonaws.com", IsNotFound: true}), true},
+		{"any region", "us-west-2", requestError(&net.DNSError{Name: "ecr.us-west-2.amazonaws.com", IsNotFound: true}), true},
+		{"temporary", "xx-optin-1", requestError(&net.DNSError{Name: "ecr.xx-optin-1.amazonaws.com", IsTemporary: true}), false},
+		{"other host", "xx-optin-1", requestError(&net.DNSError{Name: "proxy.example.com", IsNotFound: true}), false},
+		{"access denied", "xx-optin-1", awserr.New("AccessDeniedException", "not authorized", nil), false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+			credentialCache := mock_cache.NewMockCredentialsCache(ctrl)
+
+			client := &defaultClient{
+				ecrClient:       ecrClient,
+				credentialCache: credentialCache,
+				region:          tc.region,
+				options:         ClientOptions{AllowCrossAccount: true},
+			}
+			credentialCache.EXPECT().GetValid(registryID, gomock.Any()).Return((*cache.AuthEntry)(nil))
+			credentialCache.EXPECT().Get(registryID).Return((*cache.AuthEntry)(nil))
+			ecrClient.EXPECT().GetAuthorizationToken(gomock.Any()).Return(nil, tc.err)
+
+			_, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+			assert.NotNil(t, err)
+			assert.Equal(t, tc.unavailable, errors.Is(err, ErrECRUnavailableInRegion), "%v", err)
+			if tc.unavailable {
+				assert.Contains(t, err.Error(), tc.region)
+				assert.Contains(t, err.Error(), "ecr."+tc.region+".amazonaws.com", "the host is named to diagnose broken DNS")
+			}
+		})
+	}
+}
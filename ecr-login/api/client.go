@@ -14,9 +14,15 @@
 package api
 
 import (
+	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"math/rand"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -26,76 +32,632 @@ import (
 	log "github.com/cihub/seelog"
 )
 
+// proxyEndpointScheme is the scheme ECR uses for proxy endpoints. Endpoints returned with another scheme, such as
+// the http:// endpoints of LocalStack, are matched on their host and path as well.
 const proxyEndpointScheme = "https://"
 
+// httpsPort is the port implied by proxyEndpointScheme, which image hosts may spell out explicitly.
+const httpsPort = "443"
+
+// refreshJitter bounds the random offset subtracted from RefreshAfter so that clients sharing a token do not all
+// refresh at the same instant.
+const refreshJitter = time.Minute
+
+// defaultMaxTokenLength is the default of MaxTokenLength.
+const defaultMaxTokenLength = 64 * 1024
+
+// defaultMinTokenValidity is the default of MinTokenValidity.
+const defaultMinTokenValidity = time.Minute
+
+// ErrMalformedToken is returned when an authorization token cannot be decoded into a username and password.
+var ErrMalformedToken = errors.New("malformed authorization token")
+
+// ErrTokenTooLarge is returned when an authorization token is longer than MaxTokenLength, before decoding it.
+var ErrTokenTooLarge = errors.New("authorization token is too large")
+
+// ErrTokenTooShortLived is returned, wrapped with the registry, when RejectShortLivedTokens is set and ECR returns a
+// token that would be valid for less than MinTokenValidity.
+var ErrTokenTooShortLived = errors.New("authorization token is too short lived")
+
+// ErrRegistryImageMismatch is returned, wrapped with both registry IDs, when the host of the image belongs to a
+// different registry than the one requested.
+var ErrRegistryImageMismatch = errors.New("requested registry does not match the registry of the image")
+
+// ErrProxyEndpointMismatch is returned, wrapped with the registry, when no authorization data returned by ECR
+// matches the image.
+var ErrProxyEndpointMismatch = errors.New("No AuthorizationToken found")
+
+// endpointMismatchRetryDelay is how long to wait before retrying when RetryProxyEndpointMismatch is set.
+var endpointMismatchRetryDelay = time.Second
+
+// ErrRegistryNotAllowed is returned, wrapped with the registry, when AllowedRegistryIDs is set and does not include
+// the registry.
+var ErrRegistryNotAllowed = errors.New("registry is not allowed")
+
+// ErrRegionNotAllowed is returned, wrapped with the region, when AllowedRegions is set and does not include the
+// region of the client.
+var ErrRegionNotAllowed = errors.New("region is not allowed")
+
+// ErrInvalidImage is returned, wrapped with the image, when the image argument is not a registry host optionally
+// followed by a repository.
+var ErrInvalidImage = errors.New("invalid image")
+
+// ErrOfflineCacheMiss is returned, wrapped with the registry, when Offline is set and no usable token is cached.
+var ErrOfflineCacheMiss = errors.New("no cached token in offline mode")
+
+// ErrCacheMissWarming is returned, wrapped with the registry, when NonBlockingMiss is set and no token is cached. A
+// token is then fetched in the background for the next call.
+var ErrCacheMissWarming = errors.New("no cached token, warming the cache")
+
+var imageRegistryPattern = regexp.MustCompile(`^([a-zA-Z0-9][a-zA-Z0-9-_]*)\.dkr\.ecr\.`)
+var imageHostPattern = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-_.]*[a-zA-Z0-9])?(:[0-9]+)?$`)
+
 type Client interface {
-	GetCredentials(registry, image string) (string, string, error)
+	GetCredentials(registry, image string) (*Credentials, error)
+	GenerateContainerdHostConfig(registry, image string) ([]byte, error)
+	GenerateDockerAuthConfig(registry, image string) ([]byte, error)
+	WriteDockerConfig(path string, registries []string) error
+	DescribeCredentials(registry, image string) (CredentialInfo, error)
+	IsCached(registry string) bool
+	CheckPullPermissions(ctx context.Context, registries []string) (map[string]error, error)
+	ThrottleState() ThrottleState
+	GetPublicCredentials() (*Credentials, error)
+}
+
+// Credentials are the docker credentials for a registry, along with the validity of the token they were decoded
+// from. RefreshAfter is the time callers caching these credentials should request new ones. ProxyEndpoint is the
+// endpoint ECR returned for the registry, which callers can use to rewrite image references to their canonical host.
+// Warnings describe non-fatal issues met while retrieving the credentials, such as falling back to a stale token.
+type Credentials struct {
+	Username      string    `json:"username"`
+	Password      string    `json:"password"`
+	ExpiresAt     time.Time `json:"expiresAt"`
+	RefreshAfter  time.Time `json:"refreshAfter"`
+	ProxyEndpoint string    `json:"proxyEndpoint"`
+	Warnings      []string  `json:"warnings,omitempty"`
+}
+
+// warnings collects the non-fatal issues met while retrieving credentials.
+type warnings []string
+
+func (w *warnings) add(format string, args ...interface{}) {
+	*w = append(*w, fmt.Sprintf(format, args...))
 }
+
 type defaultClient struct {
 	ecrClient       ecriface.ECRAPI
 	credentialCache cache.CredentialsCache
+	options         ClientOptions
+	principal       principal
+
+	// region is the region the client was built for, checked against AllowedRegions.
+	region string
+
+	// throttle tracks the throttling of ecrClient, see ThrottleState.
+	throttle *throttleTracker
+
+	// unavailable is set, wrapping ErrECRUnavailableInRegion, when EndpointResolver found no ECR endpoint in region.
+	unavailable error
+
+	// registryClients are the ECR clients built for RegistryEndpoints, by registry.
+	registryClients map[string]ecriface.ECRAPI
+
+	// ecrPublicClient requests tokens for the Amazon ECR Public registry.
+	ecrPublicClient ecrPublicAPI
+
+	// warming holds the registries fetched in the background for NonBlockingMiss and RefreshMargin, shared with the
+	// other clients of a freshSessionClient. ownWarming is used instead when unset, see warmingRegistries.
+	warming    *sync.Map
+	ownWarming sync.Map
+
+	// identity caches the account of the credentials, shared with the other clients of the same credentials.
+	// ownIdentity is used instead when the credentials are unknown, see identityResolver.
+	identity    *identityResolver
+	ownIdentity identityResolver
+
+	// identityCache is set when credentialCache is shared with other principals. It keeps the account of the
+	// credentials between processes, see lookupOwnAccount.
+	identityCache cache.CredentialsCache
 }
 
-func (self *defaultClient) GetCredentials(registry, image string) (string, string, error) {
+func (self *defaultClient) GetCredentials(registry, image string) (*Credentials, error) {
 	log.Debugf("GetCredentials for %s", registry)
 
-	cachedEntry := self.credentialCache.Get(registry)
+	start := time.Now()
+	var warn warnings
+	authEntry, err := self.getAuthEntry(registry, image, &warn)
+	if err != nil {
+		return nil, err
+	}
+	creds, err := self.credentials(authEntry)
+	if err != nil {
+		return nil, err
+	}
+	creds.Warnings = warn
+	// Tokens requested from ECR before this call were served from the cache.
+	self.audit(registry, authEntry.RequestedAt.Before(start), creds)
+	return creds, nil
+}
+
+// IsCached reports whether a token for registry is cached and would be used by GetCredentials without calling ECR.
+func (self *defaultClient) IsCached(registry string) bool {
+	if self.identityCache != nil && self.checkOwnAccount(registry, &warnings{}) != nil {
+		return false
+	}
+	cachedEntry, servable := self.lookup(registry, time.Now())
+	return servable && self.hasMinRemainingValidity(cachedEntry) &&
+		self.options.Policy.allowsCacheAge(registry, time.Since(cachedEntry.RequestedAt))
+}
+
+// getAuthEntry returns the cached or freshly requested authorization token for the registry serving image, running
+// the PreFetch and PostFetch hooks around the retrieval. Non-fatal issues are added to warn.
+func (self *defaultClient) getAuthEntry(registry, image string, warn *warnings) (*cache.AuthEntry, error) {
+	if err := validateImage(image); err != nil {
+		return nil, err
+	}
+
+	if self.options.PreFetch != nil {
+		if err := self.options.PreFetch(registry); err != nil {
+			return nil, err
+		}
+	}
+
+	authEntry, err := self.retrieveAuthEntry(registry, image, warn)
+	if self.options.PostFetch != nil {
+		self.options.PostFetch(registry, err)
+	}
+	return authEntry, err
+}
+
+func (self *defaultClient) retrieveAuthEntry(registry, image string, warn *warnings) (*cache.AuthEntry, error) {
+	if imageRegistry := registryFromImage(image); imageRegistry != "" && imageRegistry != registry {
+		if !self.options.TrustImageRegistry {
+			return nil, fmt.Errorf("%w: requested %s but image %s is in %s", ErrRegistryImageMismatch, registry, image, imageRegistry)
+		}
+		log.Infof("Using registry %s of image %s instead of requested registry %s", imageRegistry, image, registry)
+		registry = imageRegistry
+	}
+
+	if err := self.options.checkRegistry(registry); err != nil {
+		return nil, err
+	}
+	if err := self.options.checkRegion(self.region); err != nil {
+		return nil, err
+	}
+	if self.unavailable != nil && !self.overridesEndpoint(registry) {
+		return nil, self.unavailable
+	}
+
+	if self.identityCache != nil {
+		// Entries of a shared cache may have been fetched by another principal of the account, allowed to fetch
+		// tokens this client must not serve.
+		if err := self.checkOwnAccount(registry, warn); err != nil {
+			return nil, err
+		}
+	}
+
+	cachedEntry, servable := self.lookup(registry, time.Now())
+	if cachedEntry != nil && !self.options.Policy.allowsCacheAge(registry, time.Since(cachedEntry.RequestedAt)) {
+		log.Debugf("Cached token for %s was requested at %s, longer ago than the policy allows", registry, cachedEntry.RequestedAt)
+		cachedEntry = nil
+	}
+	if self.options.Offline {
+		return self.offlineAuthEntry(registry, cachedEntry)
+	}
 
 	if cachedEntry != nil {
-		if cachedEntry.IsValid(time.Now()) {
-			log.Debugf("Using cached token for %s", registry)
-			return extractToken(cachedEntry.AuthorizationToken)
-		} else {
+		if !servable {
 			log.Debugf("Cached token is no longer valid. RequestAt: %s, ExpiresAt: %s", cachedEntry.RequestedAt, cachedEntry.ExpiresAt)
+		} else if !self.hasMinRemainingValidity(cachedEntry) {
+			log.Debugf("Cached token expires at %s, sooner than the minimum remaining validity of %s", cachedEntry.ExpiresAt, self.options.MinRemainingValidity)
+		} else {
+			log.Debugf("Using cached token for %s", registry)
+			if self.options.ObserveCacheAge != nil {
+				self.options.ObserveCacheAge(registry, time.Since(cachedEntry.RequestedAt))
+			}
+			if self.dueForRefresh(cachedEntry, time.Now()) {
+				if self.options.SynchronousRefresh {
+					return self.fetchAuthEntry(registry, image, cachedEntry, warn)
+				}
+				self.warm(registry, image)
+			}
+			return cachedEntry, nil
 		}
 	}
 
+	if cachedEntry == nil && self.options.NonBlockingMiss {
+		self.warm(registry, image)
+		return nil, fmt.Errorf("%w for %s", ErrCacheMissWarming, registry)
+	}
+	return self.fetchAuthEntry(registry, image, cachedEntry, warn)
+}
+
+// fetchAuthEntry requests an authorization token for registry from ECR and caches it, falling back to cachedEntry,
+// if any, when the request fails.
+func (self *defaultClient) fetchAuthEntry(registry, image string, cachedEntry *cache.AuthEntry, warn *warnings) (*cache.AuthEntry, error) {
+	if registry == PublicRegistryHost {
+		return self.fetchPublicAuthEntry(cachedEntry, warn)
+	}
+	if err := self.checkOwnAccount(registry, warn); err != nil {
+		return nil, err
+	}
 	log.Debugf("Calling ECR.GetAuthorizationToken for %s", registry)
 
-	input := &ecr.GetAuthorizationTokenInput{
-		RegistryIds: []*string{aws.String(registry)},
+	input := &ecr.GetAuthorizationTokenInput{}
+	if registry != "" {
+		// Without a registry ECR returns the default registry of the credentials, for hosts not naming one.
+		input.RegistryIds = []*string{aws.String(registry)}
 	}
 
-	output, err := self.ecrClient.GetAuthorizationToken(input)
+	ecrClient := self.ecrClientFor(registry)
+	output, err := ecrClient.GetAuthorizationToken(input)
 
 	if err != nil || output == nil {
 		if err == nil {
 			err = fmt.Errorf("Missing AuthorizationData in ECR response for %s", registry)
 		}
 
-		// if we have a cached token, fall back to avoid failing the request. This may result an expired token
-		// being returned, but if there is a 500 or timeout from the service side, we'd like to attempt to re-use an
-		// old token. We invalidate tokens prior to their expiration date to help mitigate this scenario.
-		if cachedEntry != nil {
-			log.Infof("Got error fetching authorization token. Falling back to cached token. Error was: %s", err)
-			return extractToken(cachedEntry.AuthorizationToken)
+		if fallback := self.fallBackToCache(registry, cachedEntry, err, warn); fallback != nil {
+			return fallback, nil
 		}
+		return nil, classifyECRError(self.classifyRegionError(registry, err))
+	}
 
-		return "", "", err
+	selected, err := self.selectAuthData(registry, image, output)
+	if err != nil {
+		return nil, err
 	}
-	for _, authData := range output.AuthorizationData {
-		if authData.ProxyEndpoint != nil &&
-			strings.HasPrefix(proxyEndpointScheme+image, aws.StringValue(authData.ProxyEndpoint)) &&
-			authData.AuthorizationToken != nil {
-			authEntry := cache.AuthEntry{
-				AuthorizationToken: aws.StringValue(authData.AuthorizationToken),
-				RequestedAt:        time.Now(),
-				ExpiresAt:          aws.TimeValue(authData.ExpiresAt),
-				ProxyEndpoint:      aws.StringValue(authData.ProxyEndpoint),
+	if selected == nil && self.options.RetryProxyEndpointMismatch {
+		// Newly created registries can be missing from the first response.
+		log.Infof("No authorization data matches %s, retrying in %s", image, endpointMismatchRetryDelay)
+		time.Sleep(endpointMismatchRetryDelay)
+		output, err = ecrClient.GetAuthorizationToken(input)
+		if err != nil || output == nil {
+			if err == nil {
+				err = fmt.Errorf("Missing AuthorizationData in ECR response for %s", registry)
+			}
+			log.Infof("Retrying GetAuthorizationToken for %s failed: %v", registry, err)
+			if fallback := self.fallBackToCache(registry, cachedEntry, err, warn); fallback != nil {
+				return fallback, nil
 			}
+			return nil, classifyECRError(self.classifyRegionError(registry, err))
+		}
+		if selected, err = self.selectAuthData(registry, image, output); err != nil {
+			return nil, err
+		}
+	}
+	if selected == nil {
+		// ECR answered but with nothing usable, such as an empty AuthorizationData during an ECR hiccup. Unlike
+		// errors, only a cached token that has not yet expired is served in its place.
+		if cachedEntry != nil && time.Now().Before(cachedEntry.ExpiresAt) {
+			log.Infof("No usable authorization data for %s. Falling back to cached token", registry)
+			warn.add("using a cached token for %s that is due for refresh, ECR returned no usable authorization data", registry)
+			return cachedEntry, nil
+		}
+		return nil, fmt.Errorf("%w for %s", ErrProxyEndpointMismatch, registry)
+	}
+
+	authEntry := cache.AuthEntry{
+		AuthorizationToken: aws.StringValue(selected.AuthorizationToken),
+		RequestedAt:        time.Now(),
+		ExpiresAt:          aws.TimeValue(selected.ExpiresAt),
+		ProxyEndpoint:      aws.StringValue(selected.ProxyEndpoint),
+	}
+
+	return self.storeAuthEntry(registry, authEntry, selected.ExpiresAt != nil, warn)
+}
+
+// fallBackToCache returns cachedEntry, if any, to serve in place of a token that could not be fetched because of
+// err, or nil when there is none or it expired beyond the stale grace period.
+func (self *defaultClient) fallBackToCache(registry string, cachedEntry *cache.AuthEntry, err error, warn *warnings) *cache.AuthEntry {
+	// if we have a cached token, fall back to avoid failing the request. This may result an expired token
+	// being returned, but if there is a 500 or timeout from the service side, we'd like to attempt to re-use an
+	// old token. We invalidate tokens prior to their expiration date to help mitigate this scenario.
+	if cachedEntry == nil {
+		return nil
+	}
+	if !self.withinStaleGracePeriod(cachedEntry) {
+		log.Infof("Got error fetching authorization token. The cached token expired at %s, beyond the stale grace period of %s", cachedEntry.ExpiresAt, self.options.StaleGracePeriod)
+		return nil
+	}
+	log.Infof("Got error fetching authorization token. Falling back to cached token. Error was: %s", err)
+	warn.add("using a cached token for %s that is due for refresh, fetching a new one failed: %v", registry, err)
+	return cachedEntry
+}
+
+// storeAuthEntry caches the freshly fetched authEntry for registry, unless it has no expiry or is too short lived
+// to be reused, and returns it.
+func (self *defaultClient) storeAuthEntry(registry string, authEntry cache.AuthEntry, hasExpiry bool, warn *warnings) (*cache.AuthEntry, error) {
+	if !hasExpiry {
+		log.Infof("ECR returned a token without an expiry for %s", registry)
+		warn.add("ECR returned a token without an expiry for %s, it will not be reused", registry)
+		return &authEntry, nil
+	} else if authEntry.ExpiresAt.Before(authEntry.RequestedAt) {
+		log.Warnf("Token for %s expired at %s, before it was received at %s", registry, authEntry.ExpiresAt, authEntry.RequestedAt)
+		warn.add("token for %s expired at %s before it was received, the local clock may be skewed", registry, authEntry.ExpiresAt)
+	} else if validity := authEntry.RefreshTime().Sub(authEntry.RequestedAt); validity < self.options.minTokenValidity() {
+		if self.options.RejectShortLivedTokens {
+			return nil, fmt.Errorf("%w: the token for %s expires at %s", ErrTokenTooShortLived, registry, authEntry.ExpiresAt)
+		}
+		log.Warnf("Token for %s expires at %s, too soon to be cached", registry, authEntry.ExpiresAt)
+		warn.add("token for %s expires at %s, too soon to be cached", registry, authEntry.ExpiresAt)
+		return &authEntry, nil
+	} else if !self.hasMinRemainingValidity(&authEntry) {
+		log.Warnf("Token for %s expires at %s, sooner than the minimum remaining validity of %s", registry, authEntry.ExpiresAt, self.options.MinRemainingValidity)
+		warn.add("token for %s expires at %s, sooner than the minimum remaining validity of %s", registry, authEntry.ExpiresAt, self.options.MinRemainingValidity)
+	}
+	self.credentialCache.Set(registry, &authEntry)
+	return &authEntry, nil
+}
+
+// lookup returns the cached entry for registry and whether it is servable at now. Without a ReadMargin, servable
+// entries are read with GetValid, so that they cannot be replaced between the read and the validity check. Entries
+// no longer servable are still returned, for the fallbacks when ECR cannot be reached.
+func (self *defaultClient) lookup(registry string, now time.Time) (*cache.AuthEntry, bool) {
+	if self.options.ReadMargin <= 0 {
+		if cachedEntry := self.credentialCache.GetValid(registry, now); cachedEntry != nil {
+			return cachedEntry, true
+		}
+	}
+	cachedEntry := self.credentialCache.Get(registry)
+	return cachedEntry, cachedEntry != nil && self.servable(cachedEntry, now)
+}
+
+// servable reports whether cachedEntry may be served from the cache at now: until ReadMargin before it expires when
+// set, or until its RefreshTime otherwise.
+func (self *defaultClient) servable(cachedEntry *cache.AuthEntry, now time.Time) bool {
+	if self.options.ReadMargin > 0 {
+		return now.Before(cachedEntry.ExpiresAt.Add(-self.options.ReadMargin))
+	}
+	return cachedEntry.IsValid(now)
+}
+
+// dueForRefresh reports whether a servable cachedEntry should be refreshed in the background at now, once within
+// RefreshMargin of its expiry.
+func (self *defaultClient) dueForRefresh(cachedEntry *cache.AuthEntry, now time.Time) bool {
+	return self.options.RefreshMargin > 0 && !now.Before(cachedEntry.ExpiresAt.Add(-self.options.RefreshMargin))
+}
+
+// warm fetches a token for registry in the background, unless a fetch for it is already running.
+func (self *defaultClient) warm(registry, image string) {
+	warming := self.warmingRegistries()
+	if _, running := warming.LoadOrStore(registry, true); running {
+		return
+	}
+	log.Debugf("Warming the cache for %s in the background", registry)
+	go func() {
+		defer warming.Delete(registry)
+		var warn warnings
+		if _, err := self.fetchAuthEntry(registry, image, nil, &warn); err != nil {
+			log.Infof("Could not warm the cache for %s: %v", registry, err)
+		}
+	}()
+}
 
-			self.credentialCache.Set(registry, &authEntry)
-			return extractToken(aws.StringValue(authData.AuthorizationToken))
+// warmingRegistries returns the registries being warmed, shared with other clients, or those of the client itself.
+func (self *defaultClient) warmingRegistries() *sync.Map {
+	if self.warming != nil {
+		return self.warming
+	}
+	return &self.ownWarming
+}
+
+// withinStaleGracePeriod reports whether cachedEntry may be served when ECR cannot be reached: it has not expired,
+// or expired less than StaleGracePeriod ago, if set.
+func (self *defaultClient) withinStaleGracePeriod(cachedEntry *cache.AuthEntry) bool {
+	if self.options.StaleGracePeriod <= 0 {
+		return true
+	}
+	return time.Now().Before(cachedEntry.ExpiresAt.Add(self.options.StaleGracePeriod))
+}
+
+// offlineAuthEntry returns cachedEntry for registry in offline mode. The refresh margin and MinRemainingValidity
+// are ignored, but expired tokens are refused unless OfflineAllowStale is set.
+func (self *defaultClient) offlineAuthEntry(registry string, cachedEntry *cache.AuthEntry) (*cache.AuthEntry, error) {
+	if cachedEntry == nil {
+		return nil, fmt.Errorf("%w for %s", ErrOfflineCacheMiss, registry)
+	}
+	if !time.Now().Before(cachedEntry.ExpiresAt) && !self.options.OfflineAllowStale {
+		return nil, fmt.Errorf("%w for %s: the cached token expired at %s", ErrOfflineCacheMiss, registry, cachedEntry.ExpiresAt)
+	}
+	log.Debugf("Using cached token for %s in offline mode", registry)
+	return cachedEntry, nil
+}
+
+// selectAuthData returns the authorization data in output matching image. If several entries match, as they can
+// with MatchModeSuffix or a custom EndpointMatcher, the one with the longest, most specific proxy endpoint host is
+// returned, and the longest-lived one among equally long hosts. Entries whose token cannot be decoded are skipped,
+// and the error decoding them is returned only when no other entry matches. Entries are considered in the order of
+// their proxy endpoint, not the order ECR returned them in, so that remaining ties are settled the same way every
+// time.
+func (self *defaultClient) selectAuthData(registry, image string, output *ecr.GetAuthorizationTokenOutput) (*ecr.AuthorizationData, error) {
+	authorizationData := append([]*ecr.AuthorizationData(nil), output.AuthorizationData...)
+	sort.SliceStable(authorizationData, func(i, j int) bool {
+		return aws.StringValue(authorizationData[i].ProxyEndpoint) < aws.StringValue(authorizationData[j].ProxyEndpoint)
+	})
+
+	var selected *ecr.AuthorizationData
+	var decodeErr error
+	for _, authData := range authorizationData {
+		if !self.matchesImage(registry, image, authData) || authData.AuthorizationToken == nil {
+			continue
 		}
+		if _, _, err := self.decodeAuthorizationToken(aws.StringValue(authData.AuthorizationToken)); err != nil {
+			log.Infof("Skipping authorization data for %s with an invalid token: %v", aws.StringValue(authData.ProxyEndpoint), err)
+			decodeErr = err
+			continue
+		}
+		if selected == nil || moreSpecific(authData, selected) {
+			selected = authData
+		}
+	}
+	if selected == nil && decodeErr != nil {
+		return nil, decodeErr
+	}
+	return selected, nil
+}
+
+// moreSpecific reports whether authData is preferred to selected: its proxy endpoint host is longer, or as long and
+// it expires later.
+func moreSpecific(authData, selected *ecr.AuthorizationData) bool {
+	length := len(endpointHost(aws.StringValue(authData.ProxyEndpoint)))
+	selectedLength := len(endpointHost(aws.StringValue(selected.ProxyEndpoint)))
+	if length != selectedLength {
+		return length > selectedLength
+	}
+	return aws.TimeValue(authData.ExpiresAt).After(aws.TimeValue(selected.ExpiresAt))
+}
+
+// hasMinRemainingValidity reports whether authEntry remains valid for at least MinRemainingValidity.
+func (self *defaultClient) hasMinRemainingValidity(authEntry *cache.AuthEntry) bool {
+	return !authEntry.ExpiresAt.Before(time.Now().Add(self.options.MinRemainingValidity))
+}
+
+// registryFromImage returns the registry ID encoded in the host of image, or "" if the host does not encode one.
+func registryFromImage(image string) string {
+	matches := imageRegistryPattern.FindStringSubmatch(trimScheme(image))
+	if len(matches) < 2 {
+		return ""
+	}
+	return matches[1]
+}
+
+// validateImage checks that image is empty, a bare registry host, or a registry host followed by a repository.
+func validateImage(image string) error {
+	if image == "" {
+		return nil
+	}
+	if strings.ContainsAny(image, " \t\r\n") || !imageHostPattern.MatchString(imageHost(image)) {
+		return fmt.Errorf("%w: %q", ErrInvalidImage, image)
+	}
+	return nil
+}
+
+// matchesImage reports whether authData serves image, as decided by the EndpointMatcher. An empty image requests the
+// registry itself, which is matched against the registry encoded in the host of the proxy endpoint, as are images
+// of registries reached through RegistryEndpoints, whose host may be the one of the overridden endpoint.
+func (self *defaultClient) matchesImage(registry, image string, authData *ecr.AuthorizationData) bool {
+	proxyRegistry := registryFromImage(aws.StringValue(authData.ProxyEndpoint))
+	if image == "" {
+		return authData.ProxyEndpoint != nil && proxyRegistry == registry
+	}
+	if self.overridesEndpoint(registry) && proxyRegistry == registry {
+		return true
+	}
+	return self.options.endpointMatcher().Matches(image, authData)
+}
+
+// matchesProxyEndpoint reports whether image is served by proxyEndpoint, ignoring the scheme of either. When the
+// proxy endpoint has no port, the default HTTPS port is stripped from the image host before comparing, as is any
+// other port if stripAnyPort is set.
+func matchesProxyEndpoint(image, proxyEndpoint string, stripAnyPort bool) bool {
+	imageHost := imageHost(image)
+	endpointHost := endpointHost(proxyEndpoint)
+	if imageHost == endpointHost {
+		return true
+	}
+	if strings.Contains(endpointHost, ":") {
+		return false
+	}
+	i := strings.LastIndex(imageHost, ":")
+	if i < 0 || (imageHost[i+1:] != httpsPort && !stripAnyPort) {
+		return false
+	}
+	return imageHost[:i] == endpointHost
+}
+
+// endpointHost returns the host of proxyEndpoint, including its port if any.
+func endpointHost(proxyEndpoint string) string {
+	return strings.TrimSuffix(trimScheme(proxyEndpoint), "/")
+}
+
+// imageHost returns the host of image, including its port if any.
+func imageHost(image string) string {
+	return ParseImage(image).Host
+}
+
+func trimScheme(url string) string {
+	if i := strings.Index(url, "://"); i >= 0 {
+		return url[i+len("://"):]
 	}
-	return "", "", fmt.Errorf("No AuthorizationToken found for %s", registry)
+	return url
 }
 
-func extractToken(token string) (string, string, error) {
-	decodedToken, err := base64.StdEncoding.DecodeString(token)
+// credentials decodes the token of authEntry into Credentials.
+func (self *defaultClient) credentials(authEntry *cache.AuthEntry) (*Credentials, error) {
+	username, password, err := self.decodeAuthorizationToken(authEntry.AuthorizationToken)
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
+	if self.options.UsernameTransformer != nil {
+		username = self.options.UsernameTransformer(username)
+	}
+	return &Credentials{
+		Username:      username,
+		Password:      password,
+		ExpiresAt:     authEntry.ExpiresAt,
+		RefreshAfter:  authEntry.RefreshTime().Add(-time.Duration(rand.Int63n(int64(refreshJitter)))),
+		ProxyEndpoint: authEntry.ProxyEndpoint,
+	}, nil
+}
+
+// decodeAuthorizationToken decodes token with the TokenDecoder, or extractToken when unset.
+func (self *defaultClient) decodeAuthorizationToken(token string) (string, string, error) {
+	if self.options.TokenDecoder == nil {
+		return extractToken(token, self.options.StrictTokenParsing, self.options.maxTokenLength())
+	}
+	if maxLength := self.options.maxTokenLength(); len(token) > maxLength {
+		return "", "", fmt.Errorf("%w: %d bytes exceeds %d", ErrTokenTooLarge, len(token), maxLength)
+	}
+	return self.options.TokenDecoder(token)
+}
+
+// extractToken decodes an authorization token into a username and password. In strict mode only standard padded
+// base64 of "AWS:<password>" is accepted; otherwise URL-safe and unpadded encodings are tolerated as well. Tokens
+// longer than maxLength are rejected without being decoded.
+func extractToken(token string, strict bool, maxLength int) (string, string, error) {
+	if len(token) > maxLength {
+		return "", "", fmt.Errorf("%w: %d bytes exceeds %d", ErrTokenTooLarge, len(token), maxLength)
+	}
+	var decodedToken []byte
+	var err error
+	if strict {
+		decodedToken, err = base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return "", "", ErrMalformedToken
+		}
+	} else {
+		decodedToken, err = decodeToken(token)
+		if err != nil {
+			return "", "", err
+		}
+	}
+
 	parts := strings.SplitN(string(decodedToken), ":", 2)
+	if len(parts) != 2 {
+		return "", "", ErrMalformedToken
+	}
+	if strict && (parts[0] != "AWS" || parts[1] == "") {
+		return "", "", ErrMalformedToken
+	}
 	return parts[0], parts[1], nil
 }
+
+var tokenEncodings = []*base64.Encoding{
+	base64.StdEncoding,
+	base64.URLEncoding,
+	base64.RawStdEncoding,
+	base64.RawURLEncoding,
+}
+
+func decodeToken(token string) ([]byte, error) {
+	var err error
+	for _, encoding := range tokenEncodings {
+		var decodedToken []byte
+		decodedToken, err = encoding.DecodeString(token)
+		if err == nil {
+			return decodedToken, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %v", ErrMalformedToken, err)
+}
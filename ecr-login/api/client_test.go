@@ -15,11 +15,17 @@ package api
 
 import (
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/ecr"
 	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api/mocks"
 	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache"
@@ -44,6 +50,7 @@ func TestGetAuthConfigSuccess(t *testing.T) {
 	client := &defaultClient{
 		ecrClient:       ecrClient,
 		credentialCache: credentialCache,
+		options:         ClientOptions{AllowCrossAccount: true},
 	}
 
 	testProxyEndpoint := proxyEndpointScheme + proxyEndpoint
@@ -75,16 +82,19 @@ func TestGetAuthConfigSuccess(t *testing.T) {
 		AuthorizationToken: authorizationToken,
 	}
 
+	credentialCache.EXPECT().GetValid(registryID, gomock.Any()).Return(nil)
 	credentialCache.EXPECT().Get(registryID).Return(nil)
 	credentialCache.EXPECT().Set(registryID, gomock.Any()).Do(
 		func(_ string, actual *cache.AuthEntry) {
 			compareAuthEntry(t, actual, authEntry)
 		})
 
-	username, password, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	creds, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
 	assert.Nil(t, err)
-	assert.Equal(t, username, expectedUsername)
-	assert.Equal(t, password, expectedPassword)
+	assert.Equal(t, creds.Username, expectedUsername)
+	assert.Equal(t, creds.Password, expectedPassword)
+	assert.Equal(t, testProxyEndpoint, creds.ProxyEndpoint)
+	assert.Empty(t, creds.Warnings)
 }
 
 func TestGetAuthConfigNoMatchAuthorizationToken(t *testing.T) {
@@ -96,6 +106,7 @@ func TestGetAuthConfigNoMatchAuthorizationToken(t *testing.T) {
 	client := &defaultClient{
 		ecrClient:       ecrClient,
 		credentialCache: credentialCache,
+		options:         ClientOptions{AllowCrossAccount: true},
 	}
 
 	ecrClient.EXPECT().GetAuthorizationToken(gomock.Any()).Do(
@@ -115,13 +126,13 @@ func TestGetAuthConfigNoMatchAuthorizationToken(t *testing.T) {
 		},
 	}, nil)
 
+	credentialCache.EXPECT().GetValid(registryID, gomock.Any()).Return(nil)
 	credentialCache.EXPECT().Get(registryID).Return(nil)
 
-	username, password, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
-	assert.NotNil(t, err)
+	creds, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	assert.True(t, errors.Is(err, ErrProxyEndpointMismatch))
 	t.Log(err)
-	assert.Empty(t, username)
-	assert.Empty(t, password)
+	assert.Nil(t, creds)
 }
 
 func TestGetAuthConfigGetCacheSuccess(t *testing.T) {
@@ -146,12 +157,40 @@ func TestGetAuthConfigGetCacheSuccess(t *testing.T) {
 		AuthorizationToken: authorizationToken,
 	}
 
-	credentialCache.EXPECT().Get(registryID).Return(authEntry)
+	credentialCache.EXPECT().GetValid(registryID, gomock.Any()).Return(authEntry)
+
+	creds, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	assert.Nil(t, err)
+	assert.Equal(t, creds.Username, expectedUsername)
+	assert.Equal(t, creds.Password, expectedPassword)
+}
+
+func TestGetCredentialsDefaultRegistry(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: cache.NewNullCredentialsCache(),
+	}
+
+	ecrClient.EXPECT().GetAuthorizationToken(gomock.Any()).Do(
+		func(input *ecr.GetAuthorizationTokenInput) {
+			assert.Empty(t, input.RegistryIds)
+		}).Return(&ecr.GetAuthorizationTokenOutput{
+		AuthorizationData: []*ecr.AuthorizationData{
+			&ecr.AuthorizationData{
+				ProxyEndpoint:      aws.String(proxyEndpointScheme + "registry.example.com"),
+				ExpiresAt:          aws.Time(time.Now().Add(12 * time.Hour)),
+				AuthorizationToken: aws.String(base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword))),
+			},
+		},
+	}, nil)
 
-	username, password, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	creds, err := client.GetCredentials("", "registry.example.com/myimage")
 	assert.Nil(t, err)
-	assert.Equal(t, username, expectedUsername)
-	assert.Equal(t, password, expectedPassword)
+	assert.Equal(t, expectedPassword, creds.Password)
 }
 
 func TestGetAuthConfigSuccessInvalidCacheHit(t *testing.T) {
@@ -163,6 +202,7 @@ func TestGetAuthConfigSuccessInvalidCacheHit(t *testing.T) {
 	client := &defaultClient{
 		ecrClient:       ecrClient,
 		credentialCache: credentialCache,
+		options:         ClientOptions{AllowCrossAccount: true},
 	}
 
 	testProxyEndpoint := proxyEndpointScheme + proxyEndpoint
@@ -201,16 +241,17 @@ func TestGetAuthConfigSuccessInvalidCacheHit(t *testing.T) {
 		AuthorizationToken: authorizationToken,
 	}
 
+	credentialCache.EXPECT().GetValid(registryID, gomock.Any()).Return(nil)
 	credentialCache.EXPECT().Get(registryID).Return(expiredAuthEntry)
 	credentialCache.EXPECT().Set(registryID, gomock.Any()).Do(
 		func(_ string, actual *cache.AuthEntry) {
 			compareAuthEntry(t, actual, authEntry)
 		})
 
-	username, password, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	creds, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
 	assert.Nil(t, err)
-	assert.Equal(t, username, expectedUsername)
-	assert.Equal(t, password, expectedPassword)
+	assert.Equal(t, creds.Username, expectedUsername)
+	assert.Equal(t, creds.Password, expectedPassword)
 }
 
 func TestGetAuthConfigBadBase64(t *testing.T) {
@@ -222,6 +263,7 @@ func TestGetAuthConfigBadBase64(t *testing.T) {
 	client := &defaultClient{
 		ecrClient:       ecrClient,
 		credentialCache: credentialCache,
+		options:         ClientOptions{AllowCrossAccount: true},
 	}
 
 	ecrClient.EXPECT().GetAuthorizationToken(gomock.Any()).Do(
@@ -241,13 +283,13 @@ func TestGetAuthConfigBadBase64(t *testing.T) {
 		},
 	}, nil)
 
+	credentialCache.EXPECT().GetValid(registryID, gomock.Any()).Return(nil)
 	credentialCache.EXPECT().Get(registryID).Return(nil)
 
-	username, password, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	creds, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
 	assert.NotNil(t, err)
 	t.Log(err)
-	assert.Empty(t, username)
-	assert.Empty(t, password)
+	assert.Nil(t, creds)
 }
 
 func TestGetAuthConfigMissingResponse(t *testing.T) {
@@ -259,6 +301,7 @@ func TestGetAuthConfigMissingResponse(t *testing.T) {
 	client := &defaultClient{
 		ecrClient:       ecrClient,
 		credentialCache: credentialCache,
+		options:         ClientOptions{AllowCrossAccount: true},
 	}
 
 	ecrClient.EXPECT().GetAuthorizationToken(gomock.Any()).Do(
@@ -271,13 +314,13 @@ func TestGetAuthConfigMissingResponse(t *testing.T) {
 			}
 		})
 
+	credentialCache.EXPECT().GetValid(registryID, gomock.Any()).Return(nil)
 	credentialCache.EXPECT().Get(registryID).Return(nil)
 
-	username, password, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	creds, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
 	assert.NotNil(t, err)
 	t.Log(err)
-	assert.Empty(t, username)
-	assert.Empty(t, password)
+	assert.Nil(t, creds)
 }
 
 func TestGetAuthConfigECRError(t *testing.T) {
@@ -289,6 +332,7 @@ func TestGetAuthConfigECRError(t *testing.T) {
 	client := &defaultClient{
 		ecrClient:       ecrClient,
 		credentialCache: credentialCache,
+		options:         ClientOptions{AllowCrossAccount: true},
 	}
 
 	ecrClient.EXPECT().GetAuthorizationToken(gomock.Any()).Do(
@@ -301,13 +345,13 @@ func TestGetAuthConfigECRError(t *testing.T) {
 			}
 		}).Return(nil, errors.New("test error"))
 
+	credentialCache.EXPECT().GetValid(registryID, gomock.Any()).Return(nil)
 	credentialCache.EXPECT().Get(registryID).Return(nil)
 
-	username, password, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	creds, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
 	assert.NotNil(t, err)
 	t.Log(err)
-	assert.Empty(t, username)
-	assert.Empty(t, password)
+	assert.Nil(t, creds)
 }
 
 func TestGetAuthConfigSuccessInvalidCacheHitFallback(t *testing.T) {
@@ -319,6 +363,7 @@ func TestGetAuthConfigSuccessInvalidCacheHitFallback(t *testing.T) {
 	client := &defaultClient{
 		ecrClient:       ecrClient,
 		credentialCache: credentialCache,
+		options:         ClientOptions{AllowCrossAccount: true},
 	}
 
 	testProxyEndpoint := proxyEndpointScheme + proxyEndpoint
@@ -341,12 +386,149 @@ func TestGetAuthConfigSuccessInvalidCacheHitFallback(t *testing.T) {
 		AuthorizationToken: authorizationToken,
 	}
 
+	credentialCache.EXPECT().GetValid(registryID, gomock.Any()).Return(nil)
 	credentialCache.EXPECT().Get(registryID).Return(expiredAuthEntry)
 
-	username, password, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	creds, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	assert.Nil(t, err)
+	assert.Equal(t, creds.Username, expectedUsername)
+	assert.Equal(t, creds.Password, expectedPassword)
+	assert.Len(t, creds.Warnings, 1)
+}
+
+func TestGetAuthConfigStaleGracePeriod(t *testing.T) {
+	testCases := []struct {
+		name      string
+		expiredAt time.Duration
+		served    bool
+	}{
+		{"not yet expired", -time.Minute, true},
+		{"within grace", 10 * time.Minute, true},
+		{"beyond grace", 20 * time.Minute, false},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+			credentialCache := mock_cache.NewMockCredentialsCache(ctrl)
+
+			client := &defaultClient{
+				ecrClient:       ecrClient,
+				credentialCache: credentialCache,
+				options:         ClientOptions{AllowCrossAccount: true, StaleGracePeriod: 15 * time.Minute},
+			}
+
+			credentialCache.EXPECT().GetValid(registryID, gomock.Any()).Return(nil)
+			credentialCache.EXPECT().Get(registryID).Return(&cache.AuthEntry{
+				ProxyEndpoint:      proxyEndpointScheme + proxyEndpoint,
+				RequestedAt:        time.Now().Add(-12 * time.Hour),
+				ExpiresAt:          time.Now().Add(-testCase.expiredAt),
+				AuthorizationToken: base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword)),
+			})
+			ecrClient.EXPECT().GetAuthorizationToken(gomock.Any()).Return(nil, errors.New("Service error"))
+
+			creds, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+			if testCase.served {
+				assert.Nil(t, err)
+				if assert.NotNil(t, creds) {
+					assert.Equal(t, expectedPassword, creds.Password)
+				}
+			} else {
+				assert.NotNil(t, err)
+				assert.Nil(t, creds)
+			}
+		})
+	}
+}
+
+func TestGetAuthConfigEmptyResponseFallsBackToCache(t *testing.T) {
+	testCases := []struct {
+		name      string
+		expiresIn time.Duration
+		served    bool
+	}{
+		{"valid", 10 * time.Minute, true},
+		{"expired", -10 * time.Minute, false},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+			credentialCache := mock_cache.NewMockCredentialsCache(ctrl)
+
+			client := &defaultClient{
+				ecrClient:       ecrClient,
+				credentialCache: credentialCache,
+				options:         ClientOptions{AllowCrossAccount: true},
+			}
+
+			credentialCache.EXPECT().GetValid(registryID, gomock.Any()).Return(nil)
+			credentialCache.EXPECT().Get(registryID).Return(&cache.AuthEntry{
+				ProxyEndpoint:      proxyEndpointScheme + proxyEndpoint,
+				RequestedAt:        time.Now().Add(-12 * time.Hour),
+				ExpiresAt:          time.Now().Add(testCase.expiresIn),
+				AuthorizationToken: base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword)),
+			})
+			ecrClient.EXPECT().GetAuthorizationToken(gomock.Any()).Return(&ecr.GetAuthorizationTokenOutput{}, nil)
+
+			creds, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+			if testCase.served {
+				assert.Nil(t, err)
+				if assert.NotNil(t, creds) {
+					assert.Equal(t, expectedPassword, creds.Password)
+				}
+			} else {
+				assert.True(t, errors.Is(err, ErrProxyEndpointMismatch), "%v", err)
+				assert.Nil(t, creds)
+			}
+		})
+	}
+}
+
+func TestGetAuthConfigTokenDecoder(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+
+	// The vendor format wraps the standard token as "v1." followed by its hex encoding.
+	vendorDecoder := func(token string) (string, string, error) {
+		if !strings.HasPrefix(token, "v1.") {
+			return "", "", ErrMalformedToken
+		}
+		inner, err := hex.DecodeString(strings.TrimPrefix(token, "v1."))
+		if err != nil {
+			return "", "", ErrMalformedToken
+		}
+		return extractToken(string(inner), false, defaultMaxTokenLength)
+	}
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: cache.NewNullCredentialsCache(),
+		options:         ClientOptions{AllowCrossAccount: true, TokenDecoder: vendorDecoder},
+	}
+
+	standardToken := base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword))
+	ecrClient.EXPECT().GetAuthorizationToken(gomock.Any()).Return(&ecr.GetAuthorizationTokenOutput{
+		AuthorizationData: []*ecr.AuthorizationData{
+			&ecr.AuthorizationData{
+				ProxyEndpoint:      aws.String(proxyEndpointScheme + proxyEndpoint),
+				ExpiresAt:          aws.Time(time.Now().Add(12 * time.Hour)),
+				AuthorizationToken: aws.String("v1." + hex.EncodeToString([]byte(standardToken))),
+			},
+		},
+	}, nil)
+
+	creds, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
 	assert.Nil(t, err)
-	assert.Equal(t, username, expectedUsername)
-	assert.Equal(t, password, expectedPassword)
+	if assert.NotNil(t, creds) {
+		assert.Equal(t, expectedUsername, creds.Username)
+		assert.Equal(t, expectedPassword, creds.Password)
+	}
+
+	_, _, err = client.decodeAuthorizationToken(standardToken)
+	assert.True(t, errors.Is(err, ErrMalformedToken), "the standard format is no longer accepted")
 }
 
 func compareAuthEntry(t *testing.T, actual *cache.AuthEntry, expected *cache.AuthEntry) {
@@ -356,3 +538,1133 @@ func compareAuthEntry(t *testing.T, actual *cache.AuthEntry, expected *cache.Aut
 	assert.Equal(t, expected.ExpiresAt, actual.ExpiresAt)
 	assert.WithinDuration(t, expected.RequestedAt, actual.RequestedAt, 5*time.Second)
 }
+
+func TestExtractTokenModes(t *testing.T) {
+	testCases := []struct {
+		name          string
+		token         string
+		lenientResult []string
+	}{
+		{"url-safe", base64.URLEncoding.EncodeToString([]byte("AWS:pass>?~word")), []string{"AWS", "pass>?~word"}},
+		{"unpadded", base64.RawStdEncoding.EncodeToString([]byte("AWS:password1")), []string{"AWS", "password1"}},
+		{"unexpected username", base64.StdEncoding.EncodeToString([]byte("username:password")), []string{"username", "password"}},
+		{"empty password", base64.StdEncoding.EncodeToString([]byte("AWS:")), []string{"AWS", ""}},
+		{"missing separator", base64.StdEncoding.EncodeToString([]byte("AWSpassword")), nil},
+	}
+
+	for _, testCase := range testCases {
+		username, password, err := extractToken(testCase.token, true, defaultMaxTokenLength)
+		assert.Equal(t, ErrMalformedToken, err, testCase.name)
+		assert.Empty(t, username, testCase.name)
+		assert.Empty(t, password, testCase.name)
+
+		username, password, err = extractToken(testCase.token, false, defaultMaxTokenLength)
+		if testCase.lenientResult == nil {
+			assert.Equal(t, ErrMalformedToken, err, testCase.name)
+			continue
+		}
+		assert.Nil(t, err, testCase.name)
+		assert.Equal(t, testCase.lenientResult[0], username, testCase.name)
+		assert.Equal(t, testCase.lenientResult[1], password, testCase.name)
+	}
+}
+
+func TestExtractTokenStrictSuccess(t *testing.T) {
+	token := base64.StdEncoding.EncodeToString([]byte("AWS:" + expectedPassword))
+	username, password, err := extractToken(token, true, defaultMaxTokenLength)
+	assert.Nil(t, err)
+	assert.Equal(t, "AWS", username)
+	assert.Equal(t, expectedPassword, password)
+}
+
+func TestExtractTokenTooLarge(t *testing.T) {
+	token := base64.StdEncoding.EncodeToString([]byte("AWS:" + strings.Repeat("x", defaultMaxTokenLength)))
+	for _, strict := range []bool{true, false} {
+		_, _, err := extractToken(token, strict, defaultMaxTokenLength)
+		assert.True(t, errors.Is(err, ErrTokenTooLarge), "strict %v: %v", strict, err)
+	}
+}
+
+func TestGetCredentialsTokenTooLarge(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+	credentialCache := mock_cache.NewMockCredentialsCache(ctrl)
+
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: credentialCache,
+		options:         ClientOptions{AllowCrossAccount: true, MaxTokenLength: 64},
+	}
+
+	credentialCache.EXPECT().GetValid(registryID, gomock.Any()).Return(nil)
+	credentialCache.EXPECT().Get(registryID).Return(nil)
+	ecrClient.EXPECT().GetAuthorizationToken(gomock.Any()).Return(&ecr.GetAuthorizationTokenOutput{
+		AuthorizationData: []*ecr.AuthorizationData{
+			&ecr.AuthorizationData{
+				ProxyEndpoint:      aws.String(proxyEndpointScheme + proxyEndpoint),
+				ExpiresAt:          aws.Time(time.Now().Add(12 * time.Hour)),
+				AuthorizationToken: aws.String(base64.StdEncoding.EncodeToString([]byte("AWS:" + strings.Repeat("x", 64)))),
+			},
+		},
+	}, nil)
+
+	creds, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	assert.True(t, errors.Is(err, ErrTokenTooLarge), "%v", err)
+	assert.Nil(t, creds)
+}
+
+func TestGetAuthConfigRefreshAfter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+	credentialCache := mock_cache.NewMockCredentialsCache(ctrl)
+
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: credentialCache,
+	}
+
+	requestedAt := time.Now().Add(-1 * time.Hour)
+	expiresAt := requestedAt.Add(12 * time.Hour)
+	authEntry := &cache.AuthEntry{
+		ProxyEndpoint:      proxyEndpointScheme + proxyEndpoint,
+		RequestedAt:        requestedAt,
+		ExpiresAt:          expiresAt,
+		AuthorizationToken: base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword)),
+	}
+
+	credentialCache.EXPECT().GetValid(registryID, gomock.Any()).Return(authEntry)
+
+	creds, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	assert.Nil(t, err)
+	assert.Equal(t, expiresAt, creds.ExpiresAt)
+	assert.Equal(t, authEntry.ProxyEndpoint, creds.ProxyEndpoint)
+
+	margin := expiresAt.Sub(creds.RefreshAfter)
+	assert.True(t, margin >= 6*time.Hour, "refresh margin %s is shorter than half the validity window", margin)
+	assert.True(t, margin <= 6*time.Hour+refreshJitter, "refresh margin %s exceeds the jitter bound", margin)
+}
+
+func TestMatchesProxyEndpoint(t *testing.T) {
+	testCases := []struct {
+		image         string
+		proxyEndpoint string
+		stripAnyPort  bool
+		matches       bool
+	}{
+		{proxyEndpoint + "/myimage", proxyEndpointScheme + proxyEndpoint, false, true},
+		{proxyEndpointScheme + proxyEndpoint + "/myimage", proxyEndpointScheme + proxyEndpoint, false, true},
+		{proxyEndpoint + "/myimage", proxyEndpointScheme + proxyEndpoint + "/", false, true},
+		{"localhost:4566/myimage", "http://localhost:4566", false, true},
+		{"000000000000.dkr.ecr.us-east-1.localhost.localstack.cloud:4566/myimage", "http://000000000000.dkr.ecr.us-east-1.localhost.localstack.cloud:4566", false, true},
+		{proxyEndpoint + "/myimage", proxyEndpointScheme + "notproxy", false, false},
+		{proxyEndpoint + "extra/myimage", proxyEndpointScheme + proxyEndpoint, false, false},
+		{proxyEndpoint + ":443/myimage", proxyEndpointScheme + proxyEndpoint, false, true},
+		{proxyEndpoint + ":8443/myimage", proxyEndpointScheme + proxyEndpoint, false, false},
+		{proxyEndpoint + ":8443/myimage", proxyEndpointScheme + proxyEndpoint, true, true},
+		{"localhost:443/myimage", "http://localhost:4566", true, false},
+	}
+
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.matches, matchesProxyEndpoint(testCase.image, testCase.proxyEndpoint, testCase.stripAnyPort),
+			"%s against %s", testCase.image, testCase.proxyEndpoint)
+	}
+}
+
+func TestGetAuthConfigRegistryImageMismatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+	credentialCache := mock_cache.NewMockCredentialsCache(ctrl)
+
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: credentialCache,
+	}
+
+	creds, err := client.GetCredentials("111111111111", "222222222222.dkr.ecr.us-west-2.amazonaws.com/myimage")
+	assert.True(t, errors.Is(err, ErrRegistryImageMismatch))
+	assert.Contains(t, err.Error(), "111111111111")
+	assert.Contains(t, err.Error(), "222222222222")
+	assert.Nil(t, creds)
+}
+
+func TestGetAuthConfigTrustImageRegistry(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+	credentialCache := mock_cache.NewMockCredentialsCache(ctrl)
+
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: credentialCache,
+		options:         ClientOptions{AllowCrossAccount: true, TrustImageRegistry: true},
+	}
+
+	imageHost := "222222222222.dkr.ecr.us-west-2.amazonaws.com"
+	ecrClient.EXPECT().GetAuthorizationToken(gomock.Any()).Do(
+		func(input *ecr.GetAuthorizationTokenInput) {
+			assert.Equal(t, []string{"222222222222"}, aws.StringValueSlice(input.RegistryIds))
+		}).Return(&ecr.GetAuthorizationTokenOutput{
+		AuthorizationData: []*ecr.AuthorizationData{
+			&ecr.AuthorizationData{
+				ProxyEndpoint:      aws.String(proxyEndpointScheme + imageHost),
+				ExpiresAt:          aws.Time(time.Now().Add(12 * time.Hour)),
+				AuthorizationToken: aws.String(base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword))),
+			},
+		},
+	}, nil)
+	credentialCache.EXPECT().GetValid("222222222222", gomock.Any()).Return(nil)
+	credentialCache.EXPECT().Get("222222222222").Return(nil)
+	credentialCache.EXPECT().Set("222222222222", gomock.Any())
+
+	creds, err := client.GetCredentials("111111111111", imageHost+"/myimage")
+	assert.Nil(t, err)
+	assert.Equal(t, expectedPassword, creds.Password)
+}
+
+func TestGetAuthConfigFetchHooks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+	credentialCache := mock_cache.NewMockCredentialsCache(ctrl)
+
+	var calls []string
+	var postFetchErr error
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: credentialCache,
+		options: ClientOptions{
+			AllowCrossAccount: true,
+			PreFetch: func(registry string) error {
+				calls = append(calls, "pre "+registry)
+				return nil
+			},
+			PostFetch: func(registry string, err error) {
+				calls = append(calls, "post "+registry)
+				postFetchErr = err
+			},
+		},
+	}
+
+	ecrClient.EXPECT().GetAuthorizationToken(gomock.Any()).Return(nil, errors.New("test error"))
+	credentialCache.EXPECT().GetValid(registryID, gomock.Any()).Return(nil)
+	credentialCache.EXPECT().Get(registryID).Return(nil)
+
+	creds, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	assert.NotNil(t, err)
+	assert.Nil(t, creds)
+	assert.Equal(t, []string{"pre " + registryID, "post " + registryID}, calls)
+	assert.Equal(t, err, postFetchErr)
+}
+
+func TestGetAuthConfigPreFetchVeto(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+	credentialCache := mock_cache.NewMockCredentialsCache(ctrl)
+
+	vetoErr := errors.New("registry not approved")
+	postFetchCalled := false
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: credentialCache,
+		options: ClientOptions{
+			PreFetch: func(registry string) error {
+				return vetoErr
+			},
+			PostFetch: func(registry string, err error) {
+				postFetchCalled = true
+			},
+		},
+	}
+
+	creds, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	assert.Equal(t, vetoErr, err)
+	assert.Nil(t, creds)
+	assert.False(t, postFetchCalled)
+}
+
+func TestGetAuthConfigImageForms(t *testing.T) {
+	registryHost := registryID + ".dkr.ecr.us-west-2.amazonaws.com"
+	authorizationToken := base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword))
+
+	for _, image := range []string{"", registryHost, registryHost + "/myimage:latest"} {
+		ctrl := gomock.NewController(t)
+		ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+		credentialCache := mock_cache.NewMockCredentialsCache(ctrl)
+
+		client := &defaultClient{
+			ecrClient:       ecrClient,
+			credentialCache: credentialCache,
+			options:         ClientOptions{AllowCrossAccount: true},
+		}
+
+		ecrClient.EXPECT().GetAuthorizationToken(gomock.Any()).Return(&ecr.GetAuthorizationTokenOutput{
+			AuthorizationData: []*ecr.AuthorizationData{
+				&ecr.AuthorizationData{
+					ProxyEndpoint:      aws.String(proxyEndpointScheme + "111111111111.dkr.ecr.us-west-2.amazonaws.com"),
+					ExpiresAt:          aws.Time(time.Now().Add(12 * time.Hour)),
+					AuthorizationToken: aws.String(base64.StdEncoding.EncodeToString([]byte("other:other"))),
+				},
+				&ecr.AuthorizationData{
+					ProxyEndpoint:      aws.String(proxyEndpointScheme + registryHost),
+					ExpiresAt:          aws.Time(time.Now().Add(12 * time.Hour)),
+					AuthorizationToken: aws.String(authorizationToken),
+				},
+			},
+		}, nil)
+		credentialCache.EXPECT().GetValid(registryID, gomock.Any()).Return(nil)
+		credentialCache.EXPECT().Get(registryID).Return(nil)
+		credentialCache.EXPECT().Set(registryID, gomock.Any())
+
+		creds, err := client.GetCredentials(registryID, image)
+		assert.Nil(t, err, "image %q", image)
+		if assert.NotNil(t, creds, "image %q", image) {
+			assert.Equal(t, expectedPassword, creds.Password, "image %q", image)
+		}
+		ctrl.Finish()
+	}
+}
+
+func TestGetAuthConfigInvalidImage(t *testing.T) {
+	client := &defaultClient{}
+
+	for _, image := range []string{"/myimage", "https:///myimage", "my image", "-proxy/myimage", "proxy:port/myimage"} {
+		creds, err := client.GetCredentials(registryID, image)
+		assert.True(t, errors.Is(err, ErrInvalidImage), "image %q", image)
+		assert.Nil(t, creds)
+	}
+}
+
+func TestGetAuthConfigMinRemainingValidityRefresh(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+	credentialCache := mock_cache.NewMockCredentialsCache(ctrl)
+
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: credentialCache,
+		options:         ClientOptions{AllowCrossAccount: true, MinRemainingValidity: 2 * time.Hour},
+	}
+
+	// Still within its refresh window, but with less than the minimum remaining validity left.
+	cachedEntry := &cache.AuthEntry{
+		ProxyEndpoint:      proxyEndpointScheme + proxyEndpoint,
+		RequestedAt:        time.Now().Add(-1 * time.Minute),
+		ExpiresAt:          time.Now().Add(1 * time.Hour),
+		AuthorizationToken: base64.StdEncoding.EncodeToString([]byte("cached:cached")),
+	}
+	assert.True(t, cachedEntry.IsValid(time.Now()))
+
+	credentialCache.EXPECT().GetValid(registryID, gomock.Any()).Return(cachedEntry)
+	ecrClient.EXPECT().GetAuthorizationToken(gomock.Any()).Return(&ecr.GetAuthorizationTokenOutput{
+		AuthorizationData: []*ecr.AuthorizationData{
+			&ecr.AuthorizationData{
+				ProxyEndpoint:      aws.String(proxyEndpointScheme + proxyEndpoint),
+				ExpiresAt:          aws.Time(time.Now().Add(12 * time.Hour)),
+				AuthorizationToken: aws.String(base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword))),
+			},
+		},
+	}, nil)
+	credentialCache.EXPECT().Set(registryID, gomock.Any())
+
+	creds, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	assert.Nil(t, err)
+	assert.Equal(t, expectedPassword, creds.Password)
+}
+
+func TestGetAuthConfigShortLivedToken(t *testing.T) {
+	for _, reject := range []bool{false, true} {
+		ctrl := gomock.NewController(t)
+		ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+		credentialCache := mock_cache.NewMockCredentialsCache(ctrl)
+
+		client := &defaultClient{
+			ecrClient:       ecrClient,
+			credentialCache: credentialCache,
+			options:         ClientOptions{AllowCrossAccount: true, RejectShortLivedTokens: reject},
+		}
+
+		// Valid for 90 seconds, leaving 45 seconds once the refresh margin is applied.
+		credentialCache.EXPECT().GetValid(registryID, gomock.Any()).Return(nil)
+		credentialCache.EXPECT().Get(registryID).Return(nil)
+		ecrClient.EXPECT().GetAuthorizationToken(gomock.Any()).Return(&ecr.GetAuthorizationTokenOutput{
+			AuthorizationData: []*ecr.AuthorizationData{
+				&ecr.AuthorizationData{
+					ProxyEndpoint:      aws.String(proxyEndpointScheme + proxyEndpoint),
+					ExpiresAt:          aws.Time(time.Now().Add(90 * time.Second)),
+					AuthorizationToken: aws.String(base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword))),
+				},
+			},
+		}, nil)
+
+		creds, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+		if reject {
+			assert.True(t, errors.Is(err, ErrTokenTooShortLived), "%v", err)
+			assert.Nil(t, creds)
+		} else {
+			assert.Nil(t, err)
+			if assert.NotNil(t, creds) {
+				assert.Equal(t, expectedPassword, creds.Password)
+				assert.Len(t, creds.Warnings, 1)
+			}
+		}
+		ctrl.Finish()
+	}
+}
+
+func TestGetAuthConfigMinTokenValidity(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+	credentialCache := mock_cache.NewMockCredentialsCache(ctrl)
+
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: credentialCache,
+		options:         ClientOptions{AllowCrossAccount: true, MinTokenValidity: 30 * time.Second},
+	}
+
+	credentialCache.EXPECT().GetValid(registryID, gomock.Any()).Return(nil)
+	credentialCache.EXPECT().Get(registryID).Return(nil)
+	ecrClient.EXPECT().GetAuthorizationToken(gomock.Any()).Return(&ecr.GetAuthorizationTokenOutput{
+		AuthorizationData: []*ecr.AuthorizationData{
+			&ecr.AuthorizationData{
+				ProxyEndpoint:      aws.String(proxyEndpointScheme + proxyEndpoint),
+				ExpiresAt:          aws.Time(time.Now().Add(90 * time.Second)),
+				AuthorizationToken: aws.String(base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword))),
+			},
+		},
+	}, nil)
+	credentialCache.EXPECT().Set(registryID, gomock.Any())
+
+	creds, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	assert.Nil(t, err)
+	assert.Empty(t, creds.Warnings)
+}
+
+func TestGetAuthConfigSkipsCorruptToken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+	credentialCache := mock_cache.NewMockCredentialsCache(ctrl)
+
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: credentialCache,
+		options:         ClientOptions{AllowCrossAccount: true},
+	}
+
+	credentialCache.EXPECT().GetValid(registryID, gomock.Any()).Return(nil)
+	credentialCache.EXPECT().Get(registryID).Return(nil)
+	ecrClient.EXPECT().GetAuthorizationToken(gomock.Any()).Return(&ecr.GetAuthorizationTokenOutput{
+		AuthorizationData: []*ecr.AuthorizationData{
+			&ecr.AuthorizationData{
+				ProxyEndpoint:      aws.String(proxyEndpointScheme + proxyEndpoint),
+				ExpiresAt:          aws.Time(time.Now().Add(24 * time.Hour)),
+				AuthorizationToken: aws.String("corrupt token!"),
+			},
+			&ecr.AuthorizationData{
+				ProxyEndpoint:      aws.String(proxyEndpointScheme + proxyEndpoint),
+				ExpiresAt:          aws.Time(time.Now().Add(12 * time.Hour)),
+				AuthorizationToken: aws.String(base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword))),
+			},
+		},
+	}, nil)
+	credentialCache.EXPECT().Set(registryID, gomock.Any())
+
+	creds, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	assert.Nil(t, err)
+	if assert.NotNil(t, creds) {
+		assert.Equal(t, expectedPassword, creds.Password)
+	}
+}
+
+func TestGetAuthConfigOnlyCorruptTokens(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+	credentialCache := mock_cache.NewMockCredentialsCache(ctrl)
+
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: credentialCache,
+		options:         ClientOptions{AllowCrossAccount: true},
+	}
+
+	credentialCache.EXPECT().GetValid(registryID, gomock.Any()).Return(nil)
+	credentialCache.EXPECT().Get(registryID).Return(nil)
+	ecrClient.EXPECT().GetAuthorizationToken(gomock.Any()).Return(&ecr.GetAuthorizationTokenOutput{
+		AuthorizationData: []*ecr.AuthorizationData{
+			&ecr.AuthorizationData{
+				ProxyEndpoint:      aws.String(proxyEndpointScheme + proxyEndpoint),
+				ExpiresAt:          aws.Time(time.Now().Add(12 * time.Hour)),
+				AuthorizationToken: aws.String("corrupt token!"),
+			},
+		},
+	}, nil)
+
+	creds, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	assert.True(t, errors.Is(err, ErrMalformedToken), "%v", err)
+	assert.Nil(t, creds)
+}
+
+func TestGetAuthConfigUsernameTransformer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+	credentialCache := mock_cache.NewMockCredentialsCache(ctrl)
+
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: credentialCache,
+		options: ClientOptions{UsernameTransformer: func(username string) string {
+			return "proxy-" + strings.ToLower(username)
+		}},
+	}
+
+	credentialCache.EXPECT().GetValid(registryID, gomock.Any()).Return(&cache.AuthEntry{
+		ProxyEndpoint:      proxyEndpointScheme + proxyEndpoint,
+		RequestedAt:        time.Now(),
+		ExpiresAt:          time.Now().Add(12 * time.Hour),
+		AuthorizationToken: base64.StdEncoding.EncodeToString([]byte("AWS:" + expectedPassword)),
+	})
+
+	creds, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	assert.Nil(t, err)
+	assert.Equal(t, "proxy-aws", creds.Username)
+	assert.Equal(t, expectedPassword, creds.Password)
+}
+
+func TestSelectAuthDataDeterministicOrder(t *testing.T) {
+	client := &defaultClient{options: ClientOptions{EndpointMatcher: EndpointMatcherFunc(
+		func(image string, authData *ecr.AuthorizationData) bool { return true })}}
+	token := aws.String(base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword)))
+	expiresAt := time.Now().Add(12 * time.Hour)
+
+	var authorizationData []*ecr.AuthorizationData
+	for _, endpoint := range []string{"https://c.example.com", "https://a.example.com", "https://d.example.com", "https://b.example.com"} {
+		authorizationData = append(authorizationData, &ecr.AuthorizationData{
+			ProxyEndpoint:      aws.String(endpoint),
+			ExpiresAt:          aws.Time(expiresAt),
+			AuthorizationToken: token,
+		})
+	}
+
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		random.Shuffle(len(authorizationData), func(i, j int) {
+			authorizationData[i], authorizationData[j] = authorizationData[j], authorizationData[i]
+		})
+		shuffled := append([]*ecr.AuthorizationData(nil), authorizationData...)
+
+		selected, err := client.selectAuthData(registryID, "registry.example.com/myimage", &ecr.GetAuthorizationTokenOutput{AuthorizationData: shuffled})
+		assert.Nil(t, err)
+		assert.Equal(t, "https://a.example.com", aws.StringValue(selected.ProxyEndpoint))
+		assert.Equal(t, authorizationData, shuffled, "the response is left in its order")
+	}
+
+	// A longer lived entry still wins among equally specific endpoints.
+	authorizationData[0].ExpiresAt = aws.Time(expiresAt.Add(time.Hour))
+	selected, err := client.selectAuthData(registryID, "registry.example.com/myimage", &ecr.GetAuthorizationTokenOutput{AuthorizationData: authorizationData})
+	assert.Nil(t, err)
+	assert.Equal(t, authorizationData[0], selected)
+}
+
+func TestSelectAuthDataMostSpecificEndpoint(t *testing.T) {
+	client := &defaultClient{options: ClientOptions{MatchMode: MatchModeSuffix}}
+	token := aws.String(base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword)))
+	expiresAt := time.Now().Add(12 * time.Hour)
+
+	// The less specific endpoint lives longer, which must not make it win.
+	authorizationData := []*ecr.AuthorizationData{
+		&ecr.AuthorizationData{ProxyEndpoint: aws.String("https://b.example.com"), ExpiresAt: aws.Time(expiresAt.Add(time.Hour)), AuthorizationToken: token},
+		&ecr.AuthorizationData{ProxyEndpoint: aws.String("https://a.b.example.com"), ExpiresAt: aws.Time(expiresAt), AuthorizationToken: token},
+		&ecr.AuthorizationData{ProxyEndpoint: aws.String("https://a.b.example.com"), ExpiresAt: aws.Time(expiresAt.Add(-time.Hour)), AuthorizationToken: token},
+		&ecr.AuthorizationData{ProxyEndpoint: aws.String("https://xa.b.example.org"), ExpiresAt: aws.Time(expiresAt.Add(time.Hour)), AuthorizationToken: token},
+	}
+
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		random.Shuffle(len(authorizationData), func(i, j int) {
+			authorizationData[i], authorizationData[j] = authorizationData[j], authorizationData[i]
+		})
+		selected, err := client.selectAuthData(registryID, "a.b.example.com/myimage", &ecr.GetAuthorizationTokenOutput{AuthorizationData: authorizationData})
+		assert.Nil(t, err)
+		if assert.NotNil(t, selected) {
+			assert.Equal(t, "https://a.b.example.com", aws.StringValue(selected.ProxyEndpoint))
+			assert.Equal(t, expiresAt, aws.TimeValue(selected.ExpiresAt), "expiry settles ties between equally specific endpoints")
+		}
+	}
+}
+
+func TestGetAuthConfigLongestLivedToken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+	credentialCache := mock_cache.NewMockCredentialsCache(ctrl)
+
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: credentialCache,
+		options:         ClientOptions{AllowCrossAccount: true},
+	}
+
+	longestExpiry := time.Now().Add(12 * time.Hour)
+	credentialCache.EXPECT().GetValid(registryID, gomock.Any()).Return(nil)
+	credentialCache.EXPECT().Get(registryID).Return(nil)
+	ecrClient.EXPECT().GetAuthorizationToken(gomock.Any()).Return(&ecr.GetAuthorizationTokenOutput{
+		AuthorizationData: []*ecr.AuthorizationData{
+			&ecr.AuthorizationData{
+				ProxyEndpoint:      aws.String(proxyEndpointScheme + proxyEndpoint),
+				ExpiresAt:          aws.Time(time.Now().Add(1 * time.Hour)),
+				AuthorizationToken: aws.String(base64.StdEncoding.EncodeToString([]byte("short:short"))),
+			},
+			&ecr.AuthorizationData{
+				ProxyEndpoint:      aws.String(proxyEndpointScheme + proxyEndpoint),
+				ExpiresAt:          aws.Time(longestExpiry),
+				AuthorizationToken: aws.String(base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword))),
+			},
+		},
+	}, nil)
+	credentialCache.EXPECT().Set(registryID, gomock.Any())
+
+	creds, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	assert.Nil(t, err)
+	assert.Equal(t, expectedPassword, creds.Password)
+	assert.Equal(t, longestExpiry, creds.ExpiresAt)
+}
+
+func TestIsCached(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	credentialCache := mock_cache.NewMockCredentialsCache(ctrl)
+
+	// No ECR client: IsCached must never call ECR.
+	client := &defaultClient{credentialCache: credentialCache}
+
+	validEntry := &cache.AuthEntry{
+		ProxyEndpoint:      proxyEndpointScheme + proxyEndpoint,
+		RequestedAt:        time.Now(),
+		ExpiresAt:          time.Now().Add(12 * time.Hour),
+		AuthorizationToken: base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword)),
+	}
+	expiredEntry := &cache.AuthEntry{
+		ProxyEndpoint:      proxyEndpointScheme + proxyEndpoint,
+		RequestedAt:        time.Now().Add(-11 * time.Hour),
+		ExpiresAt:          time.Now().Add(1 * time.Hour),
+		AuthorizationToken: base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword)),
+	}
+
+	credentialCache.EXPECT().GetValid(registryID, gomock.Any()).Return(validEntry)
+	assert.True(t, client.IsCached(registryID))
+
+	credentialCache.EXPECT().GetValid(registryID, gomock.Any()).Return(nil)
+	credentialCache.EXPECT().Get(registryID).Return(expiredEntry)
+	assert.False(t, client.IsCached(registryID), "an entry past its refresh time is not usable")
+
+	credentialCache.EXPECT().GetValid(registryID, gomock.Any()).Return(nil)
+	credentialCache.EXPECT().Get(registryID).Return(nil)
+	assert.False(t, client.IsCached(registryID))
+
+	client.options.MinRemainingValidity = 24 * time.Hour
+	credentialCache.EXPECT().GetValid(registryID, gomock.Any()).Return(validEntry)
+	assert.False(t, client.IsCached(registryID), "an entry expiring within the minimum remaining validity is not usable")
+}
+
+func TestGetAuthConfigDegradedWarnings(t *testing.T) {
+	testCases := []struct {
+		name      string
+		expiresAt *time.Time
+		options   ClientOptions
+		cached    bool
+	}{
+		{"missing expiry", nil, ClientOptions{AllowCrossAccount: true}, false},
+		{"clock skew", aws.Time(time.Now().Add(-1 * time.Hour)), ClientOptions{AllowCrossAccount: true}, true},
+		{"short validity", aws.Time(time.Now().Add(1 * time.Hour)), ClientOptions{AllowCrossAccount: true, MinRemainingValidity: 2 * time.Hour}, true},
+	}
+
+	for _, testCase := range testCases {
+		ctrl := gomock.NewController(t)
+		ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+		credentialCache := mock_cache.NewMockCredentialsCache(ctrl)
+
+		client := &defaultClient{
+			ecrClient:       ecrClient,
+			credentialCache: credentialCache,
+			options:         testCase.options,
+		}
+
+		credentialCache.EXPECT().GetValid(registryID, gomock.Any()).Return(nil)
+		credentialCache.EXPECT().Get(registryID).Return(nil)
+		ecrClient.EXPECT().GetAuthorizationToken(gomock.Any()).Return(&ecr.GetAuthorizationTokenOutput{
+			AuthorizationData: []*ecr.AuthorizationData{
+				&ecr.AuthorizationData{
+					ProxyEndpoint:      aws.String(proxyEndpointScheme + proxyEndpoint),
+					ExpiresAt:          testCase.expiresAt,
+					AuthorizationToken: aws.String(base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword))),
+				},
+			},
+		}, nil)
+		if testCase.cached {
+			credentialCache.EXPECT().Set(registryID, gomock.Any())
+		}
+
+		creds, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+		assert.Nil(t, err, testCase.name)
+		if assert.NotNil(t, creds, testCase.name) {
+			assert.Len(t, creds.Warnings, 1, testCase.name)
+		}
+		ctrl.Finish()
+	}
+}
+
+func TestGetAuthConfigRetryProxyEndpointMismatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+	credentialCache := mock_cache.NewMockCredentialsCache(ctrl)
+
+	defer func(delay time.Duration) { endpointMismatchRetryDelay = delay }(endpointMismatchRetryDelay)
+	endpointMismatchRetryDelay = 0
+
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: credentialCache,
+		options:         ClientOptions{RetryProxyEndpointMismatch: true},
+	}
+
+	authorizationToken := aws.String(base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword)))
+	credentialCache.EXPECT().GetValid(registryID, gomock.Any()).Return(nil)
+	credentialCache.EXPECT().Get(registryID).Return(nil)
+	gomock.InOrder(
+		ecrClient.EXPECT().GetAuthorizationToken(gomock.Any()).Return(&ecr.GetAuthorizationTokenOutput{
+			AuthorizationData: []*ecr.AuthorizationData{
+				&ecr.AuthorizationData{
+					ProxyEndpoint:      aws.String(proxyEndpointScheme + "notproxy"),
+					ExpiresAt:          aws.Time(time.Now().Add(12 * time.Hour)),
+					AuthorizationToken: authorizationToken,
+				},
+			},
+		}, nil),
+		ecrClient.EXPECT().GetAuthorizationToken(gomock.Any()).Return(&ecr.GetAuthorizationTokenOutput{
+			AuthorizationData: []*ecr.AuthorizationData{
+				&ecr.AuthorizationData{
+					ProxyEndpoint:      aws.String(proxyEndpointScheme + proxyEndpoint),
+					ExpiresAt:          aws.Time(time.Now().Add(12 * time.Hour)),
+					AuthorizationToken: authorizationToken,
+				},
+			},
+		}, nil),
+	)
+	credentialCache.EXPECT().Set(registryID, gomock.Any())
+
+	creds, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	assert.Nil(t, err)
+	assert.Equal(t, expectedPassword, creds.Password)
+}
+
+func TestGetAuthConfigRetryProxyEndpointMismatchFails(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+	credentialCache := mock_cache.NewMockCredentialsCache(ctrl)
+
+	defer func(delay time.Duration) { endpointMismatchRetryDelay = delay }(endpointMismatchRetryDelay)
+	endpointMismatchRetryDelay = 0
+
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: credentialCache,
+		options:         ClientOptions{RetryProxyEndpointMismatch: true},
+	}
+
+	credentialCache.EXPECT().GetValid(registryID, gomock.Any()).Return(nil)
+	credentialCache.EXPECT().Get(registryID).Return(nil)
+	gomock.InOrder(
+		ecrClient.EXPECT().GetAuthorizationToken(gomock.Any()).Return(&ecr.GetAuthorizationTokenOutput{
+			AuthorizationData: []*ecr.AuthorizationData{
+				&ecr.AuthorizationData{
+					ProxyEndpoint:      aws.String(proxyEndpointScheme + "notproxy"),
+					ExpiresAt:          aws.Time(time.Now().Add(12 * time.Hour)),
+					AuthorizationToken: aws.String(base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword))),
+				},
+			},
+		}, nil),
+		ecrClient.EXPECT().GetAuthorizationToken(gomock.Any()).Return(nil,
+			awserr.New("AccessDeniedException", "not authorized to perform ecr:GetAuthorizationToken", nil)),
+	)
+
+	_, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	var configErr *RegistryConfigError
+	assert.True(t, errors.As(err, &configErr), "the error of the retry is returned: %v", err)
+	assert.False(t, errors.Is(err, ErrProxyEndpointMismatch), "%v", err)
+}
+
+func TestGetAuthConfigAllowedRegistryIDs(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	credentialCache := mock_cache.NewMockCredentialsCache(ctrl)
+
+	client := &defaultClient{
+		credentialCache: credentialCache,
+		options:         ClientOptions{AllowedRegistryIDs: []string{"111111111111", registryID}},
+	}
+
+	// Served from the cache, no ECR client needed.
+	credentialCache.EXPECT().GetValid(registryID, gomock.Any()).Return(&cache.AuthEntry{
+		ProxyEndpoint:      proxyEndpointScheme + proxyEndpoint,
+		RequestedAt:        time.Now(),
+		ExpiresAt:          time.Now().Add(12 * time.Hour),
+		AuthorizationToken: base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword)),
+	})
+	creds, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	assert.Nil(t, err)
+	assert.Equal(t, expectedPassword, creds.Password)
+
+	// Denied before the cache or ECR are consulted.
+	creds, err = client.GetCredentials("222222222222", proxyEndpoint+"/myimage")
+	assert.True(t, errors.Is(err, ErrRegistryNotAllowed))
+	assert.Nil(t, creds)
+}
+
+func TestGetAuthConfigAllowedRegions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	credentialCache := mock_cache.NewMockCredentialsCache(ctrl)
+
+	options := ClientOptions{AllowedRegions: []string{"us-west-2", "eu-central-1"}}
+	allowed := &defaultClient{credentialCache: credentialCache, options: options, region: "eu-central-1"}
+	credentialCache.EXPECT().GetValid(registryID, gomock.Any()).Return(&cache.AuthEntry{
+		ProxyEndpoint:      proxyEndpointScheme + proxyEndpoint,
+		RequestedAt:        time.Now(),
+		ExpiresAt:          time.Now().Add(12 * time.Hour),
+		AuthorizationToken: base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword)),
+	})
+	creds, err := allowed.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	assert.Nil(t, err)
+	assert.Equal(t, expectedPassword, creds.Password)
+
+	// Denied before the cache or ECR are consulted, even for cached tokens in offline mode.
+	options.Offline = true
+	denied := &defaultClient{credentialCache: credentialCache, options: options, region: "us-east-1"}
+	creds, err = denied.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	assert.True(t, errors.Is(err, ErrRegionNotAllowed))
+	assert.Contains(t, err.Error(), "us-east-1")
+	assert.Nil(t, creds)
+}
+
+func TestGetAuthConfigObserveCacheAge(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+	credentialCache := mock_cache.NewMockCredentialsCache(ctrl)
+
+	var observed []time.Duration
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: credentialCache,
+		options: ClientOptions{
+			AllowCrossAccount: true,
+			ObserveCacheAge: func(registry string, age time.Duration) {
+				assert.Equal(t, registryID, registry)
+				observed = append(observed, age)
+			},
+		},
+	}
+
+	authorizationToken := base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword))
+	credentialCache.EXPECT().GetValid(registryID, gomock.Any()).Return(&cache.AuthEntry{
+		ProxyEndpoint:      proxyEndpointScheme + proxyEndpoint,
+		RequestedAt:        time.Now().Add(-1 * time.Hour),
+		ExpiresAt:          time.Now().Add(11 * time.Hour),
+		AuthorizationToken: authorizationToken,
+	})
+	_, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	assert.Nil(t, err)
+
+	// Tokens fetched from ECR are not observed.
+	credentialCache.EXPECT().GetValid(registryID, gomock.Any()).Return(nil)
+	credentialCache.EXPECT().Get(registryID).Return(nil)
+	ecrClient.EXPECT().GetAuthorizationToken(gomock.Any()).Return(&ecr.GetAuthorizationTokenOutput{
+		AuthorizationData: []*ecr.AuthorizationData{
+			&ecr.AuthorizationData{
+				ProxyEndpoint:      aws.String(proxyEndpointScheme + proxyEndpoint),
+				ExpiresAt:          aws.Time(time.Now().Add(12 * time.Hour)),
+				AuthorizationToken: aws.String(authorizationToken),
+			},
+		},
+	}, nil)
+	credentialCache.EXPECT().Set(registryID, gomock.Any())
+	_, err = client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	assert.Nil(t, err)
+
+	if assert.Len(t, observed, 1) {
+		assert.True(t, observed[0] >= time.Hour && observed[0] < time.Hour+time.Minute, "observed age %s", observed[0])
+	}
+}
+
+func TestGetCredentialsOffline(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+	credentialCache := mock_cache.NewMockCredentialsCache(ctrl)
+
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: credentialCache,
+		options:         ClientOptions{Offline: true, MinRemainingValidity: time.Hour},
+	}
+
+	// The token is due for refresh and expires within MinRemainingValidity, but offline it is still served.
+	credentialCache.EXPECT().GetValid(registryID, gomock.Any()).Return(nil)
+	credentialCache.EXPECT().Get(registryID).Return(&cache.AuthEntry{
+		ProxyEndpoint:      proxyEndpointScheme + proxyEndpoint,
+		RequestedAt:        time.Now().Add(-11 * time.Hour),
+		ExpiresAt:          time.Now().Add(time.Minute),
+		AuthorizationToken: base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword)),
+	})
+
+	creds, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	assert.Nil(t, err)
+	assert.Equal(t, expectedPassword, creds.Password)
+}
+
+func TestGetCredentialsOfflineCacheMiss(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+	credentialCache := mock_cache.NewMockCredentialsCache(ctrl)
+
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: credentialCache,
+		options:         ClientOptions{Offline: true},
+	}
+
+	credentialCache.EXPECT().GetValid(registryID, gomock.Any()).Return(nil)
+	credentialCache.EXPECT().Get(registryID).Return(nil)
+
+	creds, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	assert.True(t, errors.Is(err, ErrOfflineCacheMiss), "%v", err)
+	assert.Nil(t, creds)
+}
+
+func TestGetCredentialsOfflineExpired(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+	credentialCache := mock_cache.NewMockCredentialsCache(ctrl)
+
+	expiredEntry := &cache.AuthEntry{
+		ProxyEndpoint:      proxyEndpointScheme + proxyEndpoint,
+		RequestedAt:        time.Now().Add(-13 * time.Hour),
+		ExpiresAt:          time.Now().Add(-time.Hour),
+		AuthorizationToken: base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword)),
+	}
+	credentialCache.EXPECT().GetValid(registryID, gomock.Any()).Return(nil).Times(2)
+	credentialCache.EXPECT().Get(registryID).Return(expiredEntry).Times(2)
+
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: credentialCache,
+		options:         ClientOptions{Offline: true},
+	}
+	_, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	assert.True(t, errors.Is(err, ErrOfflineCacheMiss), "%v", err)
+
+	client.options.OfflineAllowStale = true
+	creds, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	assert.Nil(t, err)
+	assert.Equal(t, expectedPassword, creds.Password)
+}
+
+func TestGetCredentialsCorruptedCacheFile(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+
+	cacheDir := t.TempDir()
+	err := ioutil.WriteFile(filepath.Join(cacheDir, "cache.json"), []byte(`{"Registries":{"`), 0600)
+	assert.Nil(t, err)
+
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: cache.NewFileCredentialsCache(cacheDir, "cache.json", "prefix-"),
+		options:         ClientOptions{AllowCrossAccount: true},
+	}
+
+	ecrClient.EXPECT().GetAuthorizationToken(gomock.Any()).Return(&ecr.GetAuthorizationTokenOutput{
+		AuthorizationData: []*ecr.AuthorizationData{
+			&ecr.AuthorizationData{
+				ProxyEndpoint:      aws.String(proxyEndpointScheme + proxyEndpoint),
+				ExpiresAt:          aws.Time(time.Now().Add(12 * time.Hour)),
+				AuthorizationToken: aws.String(base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword))),
+			},
+		},
+	}, nil)
+
+	// The corrupted file is replaced by the fresh token, which the second call is served from.
+	for i := 0; i < 2; i++ {
+		creds, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+		assert.Nil(t, err)
+		assert.Equal(t, expectedPassword, creds.Password)
+	}
+}
+
+func TestGetCredentialsNonBlockingMiss(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: cache.NewMemoryCredentialsCache(),
+		options:         ClientOptions{AllowCrossAccount: true, NonBlockingMiss: true},
+	}
+
+	release := make(chan struct{})
+	ecrClient.EXPECT().GetAuthorizationToken(gomock.Any()).Do(func(input *ecr.GetAuthorizationTokenInput) {
+		<-release
+	}).Return(&ecr.GetAuthorizationTokenOutput{
+		AuthorizationData: []*ecr.AuthorizationData{
+			&ecr.AuthorizationData{
+				ProxyEndpoint:      aws.String(proxyEndpointScheme + proxyEndpoint),
+				ExpiresAt:          aws.Time(time.Now().Add(12 * time.Hour)),
+				AuthorizationToken: aws.String(base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword))),
+			},
+		},
+	}, nil)
+
+	// Both calls miss while the single background fetch is running.
+	for i := 0; i < 2; i++ {
+		creds, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+		assert.True(t, errors.Is(err, ErrCacheMissWarming), "%v", err)
+		assert.Nil(t, creds)
+	}
+	close(release)
+
+	deadline := time.Now().Add(time.Second)
+	for !client.IsCached(registryID) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	creds, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	assert.Nil(t, err)
+	if assert.NotNil(t, creds) {
+		assert.Equal(t, expectedPassword, creds.Password)
+	}
+}
+
+func TestGetCredentialsReadAndRefreshMargins(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+	credentialCache := cache.NewMemoryCredentialsCache()
+
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: credentialCache,
+		options:         ClientOptions{AllowCrossAccount: true, ReadMargin: 5 * time.Minute, RefreshMargin: 30 * time.Minute},
+	}
+
+	// Past half of its validity and within the refresh margin, but still outside the read margin.
+	credentialCache.Set(registryID, &cache.AuthEntry{
+		ProxyEndpoint:      proxyEndpointScheme + proxyEndpoint,
+		RequestedAt:        time.Now().Add(-11 * time.Hour),
+		ExpiresAt:          time.Now().Add(10 * time.Minute),
+		AuthorizationToken: base64.StdEncoding.EncodeToString([]byte("AWS:cached")),
+	})
+
+	refreshed := make(chan struct{})
+	ecrClient.EXPECT().GetAuthorizationToken(gomock.Any()).Do(func(input *ecr.GetAuthorizationTokenInput) {
+		close(refreshed)
+	}).Return(&ecr.GetAuthorizationTokenOutput{
+		AuthorizationData: []*ecr.AuthorizationData{
+			&ecr.AuthorizationData{
+				ProxyEndpoint:      aws.String(proxyEndpointScheme + proxyEndpoint),
+				ExpiresAt:          aws.Time(time.Now().Add(12 * time.Hour)),
+				AuthorizationToken: aws.String(base64.StdEncoding.EncodeToString([]byte("AWS:fresh"))),
+			},
+		},
+	}, nil)
+
+	creds, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	assert.Nil(t, err)
+	if assert.NotNil(t, creds) {
+		assert.Equal(t, "cached", creds.Password, "the cached token is served while it is refreshed")
+	}
+
+	select {
+	case <-refreshed:
+	case <-time.After(time.Second):
+		t.Fatal("the token was not refreshed in the background")
+	}
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if entry := credentialCache.Get(registryID); entry != nil && entry.ExpiresAt.After(time.Now().Add(time.Hour)) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	creds, err = client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	assert.Nil(t, err)
+	assert.Equal(t, "fresh", creds.Password)
+}
+
+func TestGetCredentialsSynchronousRefresh(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+	credentialCache := cache.NewMemoryCredentialsCache()
+
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: credentialCache,
+		options:         ClientOptions{AllowCrossAccount: true, ReadMargin: 5 * time.Minute, RefreshMargin: 30 * time.Minute, SynchronousRefresh: true},
+	}
+	cachedEntry := &cache.AuthEntry{
+		ProxyEndpoint:      proxyEndpointScheme + proxyEndpoint,
+		RequestedAt:        time.Now().Add(-11 * time.Hour),
+		ExpiresAt:          time.Now().Add(10 * time.Minute),
+		AuthorizationToken: base64.StdEncoding.EncodeToString([]byte("AWS:cached")),
+	}
+	credentialCache.Set(registryID, cachedEntry)
+
+	// The refresh is done before returning, and a failed one falls back to the cached token.
+	ecrClient.EXPECT().GetAuthorizationToken(gomock.Any()).Return(nil, errors.New("unavailable"))
+	creds, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	assert.Nil(t, err)
+	assert.Equal(t, "cached", creds.Password)
+
+	ecrClient.EXPECT().GetAuthorizationToken(gomock.Any()).Return(&ecr.GetAuthorizationTokenOutput{
+		AuthorizationData: []*ecr.AuthorizationData{
+			&ecr.AuthorizationData{
+				ProxyEndpoint:      aws.String(proxyEndpointScheme + proxyEndpoint),
+				ExpiresAt:          aws.Time(time.Now().Add(12 * time.Hour)),
+				AuthorizationToken: aws.String(base64.StdEncoding.EncodeToString([]byte("AWS:fresh"))),
+			},
+		},
+	}, nil)
+	creds, err = client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	assert.Nil(t, err)
+	assert.Equal(t, "fresh", creds.Password)
+	assert.True(t, credentialCache.Get(registryID).ExpiresAt.After(time.Now().Add(time.Hour)))
+}
+
+func TestServableReadMargin(t *testing.T) {
+	now := time.Now()
+	entry := &cache.AuthEntry{RequestedAt: now.Add(-11 * time.Hour), ExpiresAt: now.Add(10 * time.Minute)}
+
+	client := &defaultClient{}
+	assert.False(t, client.servable(entry, now), "without a read margin tokens expire at half their validity")
+	assert.False(t, client.dueForRefresh(entry, now))
+
+	client.options = ClientOptions{ReadMargin: 5 * time.Minute, RefreshMargin: 30 * time.Minute}
+	assert.True(t, client.servable(entry, now))
+	assert.True(t, client.dueForRefresh(entry, now))
+	assert.False(t, client.servable(entry, now.Add(6*time.Minute)))
+	assert.False(t, client.dueForRefresh(entry, now.Add(-time.Hour)))
+}
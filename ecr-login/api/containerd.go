@@ -0,0 +1,50 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+const containerdRegistryConfig = `plugins."io.containerd.grpc.v1.cri".registry`
+
+// GenerateContainerdHostConfig returns the containerd CRI registry configuration, in TOML, authenticating to the
+// registry serving image. The host is taken from the proxy endpoint ECR returned for the registry. Amazon ECR Public
+// images can be pulled anonymously through public.ecr.aws, so they get a mirror entry without credentials instead.
+func (self *defaultClient) GenerateContainerdHostConfig(registry, image string) ([]byte, error) {
+	var config bytes.Buffer
+	if IsPublicRegistry(image) {
+		fmt.Fprintf(&config, "[%s.mirrors.%s]\n", containerdRegistryConfig, tomlString(PublicRegistryHost))
+		fmt.Fprintf(&config, "  endpoint = [%s]\n", tomlString(proxyEndpointScheme+PublicRegistryHost))
+		return config.Bytes(), nil
+	}
+
+	creds, err := self.GetCredentials(registry, image)
+	if err != nil {
+		return nil, err
+	}
+
+	host := strings.TrimSuffix(trimScheme(creds.ProxyEndpoint), "/")
+	fmt.Fprintf(&config, "[%s.configs.%s.auth]\n", containerdRegistryConfig, tomlString(host))
+	fmt.Fprintf(&config, "  username = %s\n", tomlString(creds.Username))
+	fmt.Fprintf(&config, "  password = %s\n", tomlString(creds.Password))
+	return config.Bytes(), nil
+}
+
+// tomlString quotes value as a TOML basic string.
+func tomlString(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
@@ -0,0 +1,96 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api/mocks"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateContainerdHostConfig(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+	credentialCache := mock_cache.NewMockCredentialsCache(ctrl)
+
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: credentialCache,
+		options:         ClientOptions{AllowCrossAccount: true},
+	}
+
+	ecrClient.EXPECT().GetAuthorizationToken(gomock.Any()).Return(&ecr.GetAuthorizationTokenOutput{
+		AuthorizationData: []*ecr.AuthorizationData{
+			&ecr.AuthorizationData{
+				ProxyEndpoint:      aws.String(proxyEndpointScheme + proxyEndpoint),
+				ExpiresAt:          aws.Time(time.Now().Add(12 * time.Hour)),
+				AuthorizationToken: aws.String(base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword))),
+			},
+		},
+	}, nil)
+	credentialCache.EXPECT().GetValid(registryID, gomock.Any()).Return(nil)
+	credentialCache.EXPECT().Get(registryID).Return(nil)
+	credentialCache.EXPECT().Set(registryID, gomock.Any())
+
+	config, err := client.GenerateContainerdHostConfig(registryID, proxyEndpoint+"/myimage")
+	assert.Nil(t, err)
+	assert.Equal(t, `[plugins."io.containerd.grpc.v1.cri".registry.configs."proxy".auth]
+  username = "username"
+  password = "password"
+`, string(config))
+}
+
+func TestGenerateContainerdHostConfigPublicECR(t *testing.T) {
+	client := &defaultClient{credentialCache: cache.NewNullCredentialsCache()}
+
+	config, err := client.GenerateContainerdHostConfig("", "public.ecr.aws/amazonlinux/amazonlinux:latest")
+	assert.Nil(t, err)
+	assert.Equal(t, `[plugins."io.containerd.grpc.v1.cri".registry.mirrors."public.ecr.aws"]
+  endpoint = ["https://public.ecr.aws"]
+`, string(config))
+}
+
+func TestGenerateContainerdHostConfigError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+	credentialCache := mock_cache.NewMockCredentialsCache(ctrl)
+
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: credentialCache,
+		options:         ClientOptions{AllowCrossAccount: true},
+	}
+
+	ecrClient.EXPECT().GetAuthorizationToken(gomock.Any()).Return(&ecr.GetAuthorizationTokenOutput{}, nil)
+	credentialCache.EXPECT().GetValid(registryID, gomock.Any()).Return(nil)
+	credentialCache.EXPECT().Get(registryID).Return(nil)
+
+	config, err := client.GenerateContainerdHostConfig(registryID, proxyEndpoint+"/myimage")
+	assert.NotNil(t, err)
+	assert.Nil(t, config)
+}
+
+func TestTOMLString(t *testing.T) {
+	assert.Equal(t, `"a\"b\\c"`, tomlString(`a"b\c`))
+}
@@ -0,0 +1,47 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import "time"
+
+// CredentialInfo is the non-secret metadata of the credentials for a registry, for diagnosing which token a request
+// would use. ECR tokens grant access to the whole registry, so there are no finer scopes to report.
+type CredentialInfo struct {
+	Registry      string    `json:"registry"`
+	Username      string    `json:"username"`
+	ProxyEndpoint string    `json:"proxyEndpoint"`
+	ExpiresAt     time.Time `json:"expiresAt"`
+	RefreshAfter  time.Time `json:"refreshAfter"`
+	Warnings      []string  `json:"warnings,omitempty"`
+}
+
+// DescribeCredentials returns the metadata of the credentials GetCredentials returns for registry and image. The
+// password is left out entirely. Registry is the account encoded in the proxy endpoint when it encodes one.
+func (self *defaultClient) DescribeCredentials(registry, image string) (CredentialInfo, error) {
+	creds, err := self.GetCredentials(registry, image)
+	if err != nil {
+		return CredentialInfo{}, err
+	}
+	if endpointRegistry := registryFromImage(creds.ProxyEndpoint); endpointRegistry != "" {
+		registry = endpointRegistry
+	}
+	return CredentialInfo{
+		Registry:      registry,
+		Username:      creds.Username,
+		ProxyEndpoint: creds.ProxyEndpoint,
+		ExpiresAt:     creds.ExpiresAt,
+		RefreshAfter:  creds.RefreshAfter,
+		Warnings:      creds.Warnings,
+	}, nil
+}
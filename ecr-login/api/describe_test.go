@@ -0,0 +1,49 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api/mocks"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDescribeCredentials(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: cache.NewNullCredentialsCache(),
+		options:         ClientOptions{AllowCrossAccount: true},
+	}
+	expectRegistryToken(ecrClient, registryID)
+
+	info, err := client.DescribeCredentials(registryID, registryHost(registryID)+"/myimage")
+	assert.Nil(t, err)
+	assert.Equal(t, registryID, info.Registry)
+	assert.Equal(t, expectedUsername, info.Username)
+	assert.Equal(t, proxyEndpointScheme+registryHost(registryID), info.ProxyEndpoint)
+	assert.False(t, info.ExpiresAt.IsZero())
+
+	encoded, err := json.Marshal(info)
+	assert.Nil(t, err)
+	assert.False(t, strings.Contains(string(encoded), expectedPassword), "the password must not be described")
+}
@@ -0,0 +1,57 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+// SessionInfo describes how the clients built for a region reach ECR, for diagnostics. It holds no secret: the
+// access key ID is redacted to its last characters.
+type SessionInfo struct {
+	Endpoint           string
+	CredentialProvider string
+	AccessKeyID        string
+}
+
+// SessionInfo resolves the ECR endpoint and the credentials the clients built for region use. The vendored SDK has
+// no STS client to look up the principal ARN, so the credentials are identified by their provider and redacted
+// access key ID. The endpoint is returned even when the credentials cannot be resolved.
+func (defaultClientFactory DefaultClientFactory) SessionInfo(region string) (SessionInfo, error) {
+	options := defaultClientFactory.clientOptions()
+	awsSession := session.New(options.sessionConfig())
+	info := SessionInfo{
+		Endpoint: ecr.New(awsSession, &aws.Config{Region: aws.String(region)}).Endpoint,
+	}
+
+	value, err := awsSession.Config.Credentials.Get()
+	if err != nil {
+		return info, err
+	}
+	info.CredentialProvider = value.ProviderName
+	info.AccessKeyID = redactAccessKeyID(value.AccessKeyID)
+	return info, nil
+}
+
+// redactAccessKeyID keeps the last 4 characters of accessKeyID, which is enough to tell keys apart.
+func redactAccessKeyID(accessKeyID string) string {
+	if len(accessKeyID) <= 4 {
+		return strings.Repeat("*", len(accessKeyID))
+	}
+	return strings.Repeat("*", len(accessKeyID)-4) + accessKeyID[len(accessKeyID)-4:]
+}
@@ -0,0 +1,147 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/cihub/seelog"
+)
+
+// ErrRegistriesNotFetched is returned, wrapped with the registries and their errors, when WriteDockerConfig could
+// not fetch credentials for some of the requested registries.
+var ErrRegistriesNotFetched = errors.New("could not fetch credentials for registries")
+
+// dockerConfig is the subset of the docker config.json holding registry credentials.
+type dockerConfig struct {
+	Auths map[string]dockerAuth `json:"auths"`
+}
+
+type dockerAuth struct {
+	Auth string `json:"auth"`
+}
+
+// GenerateDockerAuthConfig returns a docker config.json, in JSON, holding the credentials of the registry serving
+// image. The entry is keyed by the host of the proxy endpoint ECR returned for the registry.
+func (self *defaultClient) GenerateDockerAuthConfig(registry, image string) ([]byte, error) {
+	config := dockerConfig{Auths: map[string]dockerAuth{}}
+	if err := self.addDockerAuth(&config, registry, image); err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(config, "", "\t")
+}
+
+// WriteDockerConfig writes a docker config.json with fresh credentials for each of registries to path, for build
+// tools that read their credentials once at start instead of calling a credential helper. The file is replaced
+// atomically and is only readable by its owner. Registries that cannot be fetched are left out and reported in an
+// error wrapping ErrRegistriesNotFetched; nothing is written if none of them can be fetched.
+func (self *defaultClient) WriteDockerConfig(path string, registries []string) error {
+	config := dockerConfig{Auths: map[string]dockerAuth{}}
+	var failures []string
+	for _, registry := range registries {
+		if err := self.addDockerAuth(&config, registry, ""); err != nil {
+			log.Debugf("Could not fetch credentials for %s: %v", registry, err)
+			failures = append(failures, fmt.Sprintf("%s (%v)", registry, err))
+		}
+	}
+
+	var notFetched error
+	if len(failures) > 0 {
+		notFetched = fmt.Errorf("%w: %s", ErrRegistriesNotFetched, strings.Join(failures, ", "))
+		if len(config.Auths) == 0 {
+			return notFetched
+		}
+	}
+
+	if err := config.write(path); err != nil {
+		return err
+	}
+	return notFetched
+}
+
+// WriteDockerConfigFile writes a docker config.json holding the credentials of each host of auths to path, like
+// WriteDockerConfig, for credentials fetched by clients of several regions.
+func WriteDockerConfigFile(path string, auths map[string]*Credentials) error {
+	config := dockerConfig{Auths: map[string]dockerAuth{}}
+	for host, creds := range auths {
+		config.add(host, creds)
+	}
+	return config.write(path)
+}
+
+func (self *defaultClient) addDockerAuth(config *dockerConfig, registry, image string) error {
+	creds, err := self.GetCredentials(registry, image)
+	if err != nil {
+		return err
+	}
+	config.add(strings.TrimSuffix(trimScheme(creds.ProxyEndpoint), "/"), creds)
+	return nil
+}
+
+func (config *dockerConfig) add(host string, creds *Credentials) {
+	config.Auths[host] = dockerAuth{
+		Auth: base64.StdEncoding.EncodeToString([]byte(creds.Username + ":" + creds.Password)),
+	}
+}
+
+// write replaces the file at path with config, atomically, only readable by its owner.
+func (config *dockerConfig) write(path string) error {
+	contents, err := json.MarshalIndent(config, "", "\t")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, contents)
+}
+
+// DecodeDockerAuth decodes the auth value of a docker config.json entry, the base64 username:password written by
+// GenerateDockerAuthConfig, into Credentials holding only the username and password. It tolerates the same
+// encodings as ECR tokens and fails with ErrMalformedToken, or ErrTokenTooLarge, when auth cannot be decoded or has
+// no username.
+func DecodeDockerAuth(auth string) (Credentials, error) {
+	username, password, err := extractToken(auth, false, defaultMaxTokenLength)
+	if err != nil {
+		return Credentials{}, err
+	}
+	if username == "" {
+		return Credentials{}, fmt.Errorf("%w: missing username", ErrMalformedToken)
+	}
+	return Credentials{Username: username, Password: password}, nil
+}
+
+// writeFileAtomic writes contents to a temporary file next to path and renames it over path, so readers never see
+// a partially written file. The temporary file is created with 0600 permissions.
+func writeFileAtomic(path string, contents []byte) error {
+	file, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	if _, err = file.Write(contents); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+	if err = file.Close(); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
@@ -0,0 +1,210 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api/mocks"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+const otherRegistryID = "111111111111"
+
+func registryHost(registry string) string {
+	return registry + ".dkr.ecr.us-west-2.amazonaws.com"
+}
+
+// expectRegistryToken expects a GetAuthorizationToken call for registry, answered with a token for its host.
+func expectRegistryToken(ecrClient *mock_ecriface.MockECRAPI, registry string) {
+	ecrClient.EXPECT().GetAuthorizationToken(&ecr.GetAuthorizationTokenInput{
+		RegistryIds: []*string{aws.String(registry)},
+	}).Return(&ecr.GetAuthorizationTokenOutput{
+		AuthorizationData: []*ecr.AuthorizationData{
+			&ecr.AuthorizationData{
+				ProxyEndpoint:      aws.String(proxyEndpointScheme + registryHost(registry)),
+				ExpiresAt:          aws.Time(time.Now().Add(12 * time.Hour)),
+				AuthorizationToken: aws.String(base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword))),
+			},
+		},
+	}, nil)
+}
+
+func readDockerConfig(t *testing.T, contents []byte) dockerConfig {
+	var config dockerConfig
+	assert.Nil(t, json.Unmarshal(contents, &config))
+	return config
+}
+
+func TestGenerateDockerAuthConfig(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: cache.NewNullCredentialsCache(),
+		options:         ClientOptions{AllowCrossAccount: true},
+	}
+	expectRegistryToken(ecrClient, registryID)
+
+	contents, err := client.GenerateDockerAuthConfig(registryID, registryHost(registryID)+"/myimage")
+	assert.Nil(t, err)
+	assert.Equal(t, dockerConfig{Auths: map[string]dockerAuth{
+		registryHost(registryID): dockerAuth{Auth: base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword))},
+	}}, readDockerConfig(t, contents))
+}
+
+func TestWriteDockerConfig(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: cache.NewNullCredentialsCache(),
+		options:         ClientOptions{AllowCrossAccount: true},
+	}
+	expectRegistryToken(ecrClient, registryID)
+	expectRegistryToken(ecrClient, otherRegistryID)
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	assert.Nil(t, ioutil.WriteFile(path, []byte("{}"), 0644))
+	assert.Nil(t, client.WriteDockerConfig(path, []string{registryID, otherRegistryID}))
+
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	contents, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	config := readDockerConfig(t, contents)
+	assert.Len(t, config.Auths, 2)
+	assert.Contains(t, config.Auths, registryHost(registryID))
+	assert.Contains(t, config.Auths, registryHost(otherRegistryID))
+
+	files, _ := filepath.Glob(filepath.Join(filepath.Dir(path), "*"))
+	assert.Equal(t, []string{path}, files, "temporary files should not be left behind")
+}
+
+func TestWriteDockerConfigPartialFailure(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: cache.NewNullCredentialsCache(),
+		options:         ClientOptions{AllowCrossAccount: true},
+	}
+	expectRegistryToken(ecrClient, registryID)
+	ecrClient.EXPECT().GetAuthorizationToken(gomock.Any()).Return(nil, errors.New("access denied"))
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	err := client.WriteDockerConfig(path, []string{registryID, otherRegistryID})
+	assert.True(t, errors.Is(err, ErrRegistriesNotFetched))
+	assert.True(t, strings.Contains(err.Error(), otherRegistryID), "error %q should name the failed registry", err)
+
+	contents, readErr := ioutil.ReadFile(path)
+	assert.Nil(t, readErr)
+	config := readDockerConfig(t, contents)
+	assert.Len(t, config.Auths, 1)
+	assert.Contains(t, config.Auths, registryHost(registryID))
+}
+
+func TestWriteDockerConfigAllFailed(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: cache.NewNullCredentialsCache(),
+		options:         ClientOptions{AllowCrossAccount: true},
+	}
+	ecrClient.EXPECT().GetAuthorizationToken(gomock.Any()).Return(nil, errors.New("access denied"))
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	err := client.WriteDockerConfig(path, []string{registryID})
+	assert.True(t, errors.Is(err, ErrRegistriesNotFetched))
+
+	_, statErr := os.Stat(path)
+	assert.True(t, os.IsNotExist(statErr))
+}
+
+func TestDecodeDockerAuth(t *testing.T) {
+	testCases := []struct {
+		auth     string
+		username string
+		password string
+	}{
+		{base64.StdEncoding.EncodeToString([]byte("AWS:password")), "AWS", "password"},
+		{base64.StdEncoding.EncodeToString([]byte("user:pass:word")), "user", "pass:word"},
+		{base64.URLEncoding.EncodeToString([]byte("AWS:pass>?~word")), "AWS", "pass>?~word"},
+		{base64.RawStdEncoding.EncodeToString([]byte("AWS:password1")), "AWS", "password1"},
+	}
+	for _, testCase := range testCases {
+		creds, err := DecodeDockerAuth(testCase.auth)
+		assert.Nil(t, err, testCase.auth)
+		assert.Equal(t, Credentials{Username: testCase.username, Password: testCase.password}, creds)
+	}
+}
+
+func TestDecodeDockerAuthMalformed(t *testing.T) {
+	for _, auth := range []string{
+		"",
+		"not base64!",
+		base64.StdEncoding.EncodeToString([]byte("AWSpassword")),
+		base64.StdEncoding.EncodeToString([]byte(":password")),
+	} {
+		_, err := DecodeDockerAuth(auth)
+		assert.True(t, errors.Is(err, ErrMalformedToken), "%q: %v", auth, err)
+	}
+
+	_, err := DecodeDockerAuth(strings.Repeat("A", defaultMaxTokenLength+1))
+	assert.True(t, errors.Is(err, ErrTokenTooLarge))
+}
+
+func TestDecodeDockerAuthRoundTrip(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: cache.NewNullCredentialsCache(),
+		options:         ClientOptions{AllowCrossAccount: true},
+	}
+	expectRegistryToken(ecrClient, registryID)
+
+	contents, err := client.GenerateDockerAuthConfig(registryID, registryHost(registryID)+"/myimage")
+	assert.Nil(t, err)
+	config := readDockerConfig(t, contents)
+	creds, err := DecodeDockerAuth(config.Auths[registryHost(registryID)].Auth)
+	assert.Nil(t, err)
+	assert.Equal(t, expectedUsername, creds.Username)
+	assert.Equal(t, expectedPassword, creds.Password)
+}
@@ -0,0 +1,71 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/ecr/ecriface"
+)
+
+// ErrInvalidEndpointOverrides is returned for a malformed ECR_ENDPOINT_OVERRIDES.
+var ErrInvalidEndpointOverrides = errors.New("invalid endpoint overrides")
+
+var registryIDPattern = regexp.MustCompile(`^[0-9]{12}$`)
+
+// parseEndpointOverrides parses per-registry ECR endpoints given as semicolon separated registry=endpoint pairs,
+// such as 111111111111=https://vpce-a.api.ecr.us-east-1.vpce.amazonaws.com. Empty entries are ignored.
+func parseEndpointOverrides(value string) (map[string]string, error) {
+	overrides := make(map[string]string)
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("%w: %q is not registry=endpoint", ErrInvalidEndpointOverrides, entry)
+		}
+		registry, endpoint := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if !registryIDPattern.MatchString(registry) {
+			return nil, fmt.Errorf("%w: %q is not a registry ID", ErrInvalidEndpointOverrides, registry)
+		}
+		if parsed, err := url.Parse(endpoint); err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+			return nil, fmt.Errorf("%w: %q is not an http or https URL", ErrInvalidEndpointOverrides, endpoint)
+		}
+		if _, duplicate := overrides[registry]; duplicate {
+			return nil, fmt.Errorf("%w: registry %s is listed twice", ErrInvalidEndpointOverrides, registry)
+		}
+		overrides[registry] = endpoint
+	}
+	return overrides, nil
+}
+
+// ecrClientFor returns the ECR client built for the endpoint override of registry, or the default client.
+func (self *defaultClient) ecrClientFor(registry string) ecriface.ECRAPI {
+	if ecrClient, ok := self.registryClients[registry]; ok {
+		return ecrClient
+	}
+	return self.ecrClient
+}
+
+// overridesEndpoint reports whether registry is called through a RegistryEndpoints override.
+func (self *defaultClient) overridesEndpoint(registry string) bool {
+	_, ok := self.registryClients[registry]
+	return ok
+}
@@ -0,0 +1,125 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/ecr/ecriface"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api/mocks"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEndpointOverrides(t *testing.T) {
+	overrides, err := parseEndpointOverrides(" 111111111111=https://vpce-a.example.com ; 222222222222=http://localhost:4566;")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		"111111111111": "https://vpce-a.example.com",
+		"222222222222": "http://localhost:4566",
+	}, overrides)
+
+	for _, malformed := range []string{
+		"111111111111",
+		"registry=https://vpce-a.example.com",
+		"1111=https://vpce-a.example.com",
+		"111111111111=vpce-a.example.com",
+		"111111111111=ftp://vpce-a.example.com",
+		"111111111111=https://",
+		"111111111111=https://a.example.com;111111111111=https://b.example.com",
+	} {
+		_, err := parseEndpointOverrides(malformed)
+		assert.True(t, errors.Is(err, ErrInvalidEndpointOverrides), "%q: %v", malformed, err)
+	}
+}
+
+func TestClientOptionsEndpointOverrides(t *testing.T) {
+	t.Setenv("ECR_ENDPOINT_OVERRIDES", "111111111111=https://vpce-a.example.com")
+	options := DefaultClientFactory{}.clientOptions()
+	assert.Equal(t, map[string]string{"111111111111": "https://vpce-a.example.com"}, options.RegistryEndpoints)
+
+	t.Setenv("ECR_ENDPOINT_OVERRIDES", "111111111111")
+	options = DefaultClientFactory{Options: ClientOptions{RegistryEndpoints: map[string]string{registryID: "https://vpce-b.example.com"}}}.clientOptions()
+	assert.Equal(t, map[string]string{registryID: "https://vpce-b.example.com"}, options.RegistryEndpoints)
+}
+
+func TestGetCredentialsEndpointOverride(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	defaultECRClient := mock_ecriface.NewMockECRAPI(ctrl)
+	overriddenECRClient := mock_ecriface.NewMockECRAPI(ctrl)
+
+	client := &defaultClient{
+		ecrClient:       defaultECRClient,
+		registryClients: map[string]ecriface.ECRAPI{registryID: overriddenECRClient},
+		credentialCache: cache.NewNullCredentialsCache(),
+		options:         ClientOptions{AllowCrossAccount: true},
+	}
+	expectRegistryToken(overriddenECRClient, registryID)
+	expectRegistryToken(overriddenECRClient, registryID)
+	expectRegistryToken(defaultECRClient, otherRegistryID)
+
+	creds, err := client.GetCredentials(registryID, registryHost(registryID)+"/myimage")
+	assert.Nil(t, err)
+	assert.Equal(t, expectedPassword, creds.Password)
+
+	// Images named after the overridden endpoint are served by the registry it was configured for.
+	creds, err = client.GetCredentials(registryID, "registry.vpce-a.example.com/myimage")
+	assert.Nil(t, err)
+	assert.Equal(t, expectedPassword, creds.Password)
+
+	creds, err = client.GetCredentials(otherRegistryID, registryHost(otherRegistryID)+"/myimage")
+	assert.Nil(t, err)
+	assert.Equal(t, expectedPassword, creds.Password)
+}
+
+func TestNewClientEndpointOverrides(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "SECRET")
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_ECR_DISABLE_CACHE", "true")
+
+	calls := map[string]int{}
+	newServer := func(name, registry string) *httptest.Server {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls[name]++
+			token := base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword))
+			fmt.Fprintf(w, `{"authorizationData":[{"authorizationToken":%q,"expiresAt":%d,"proxyEndpoint":%q}]}`,
+				token, time.Now().Add(12*time.Hour).Unix(), proxyEndpointScheme+registryHost(registry))
+		}))
+		t.Cleanup(server.Close)
+		return server
+	}
+	defaultServer := newServer("default", otherRegistryID)
+	overrideServer := newServer("override", registryID)
+
+	client := DefaultClientFactory{Options: ClientOptions{
+		AllowCrossAccount: true,
+		Endpoint:          defaultServer.URL,
+		RegistryEndpoints: map[string]string{registryID: overrideServer.URL},
+	}}.NewClient("us-west-2")
+
+	_, err := client.GetCredentials(registryID, registryHost(registryID)+"/myimage")
+	assert.Nil(t, err)
+	_, err = client.GetCredentials(otherRegistryID, registryHost(otherRegistryID)+"/myimage")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int{"default": 1, "override": 1}, calls)
+}
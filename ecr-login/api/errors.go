@@ -0,0 +1,109 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// RegistryConfigError is returned when GetAuthorizationToken fails because of how the account, region or principal
+// is configured rather than because of the image requested. Token issuance is not governed by repository policies,
+// so Guidance points at the setting to check instead.
+type RegistryConfigError struct {
+	Code     string
+	Guidance string
+	Err      error
+}
+
+func (e *RegistryConfigError) Error() string {
+	return fmt.Sprintf("%s (%s): %v", e.Guidance, e.Code, e.Err)
+}
+
+func (e *RegistryConfigError) Unwrap() error {
+	return e.Err
+}
+
+// AttemptsError is the terminal error of an ECR request, annotated with the number of attempts made and the time
+// spent on them, to tell an exhausted retry budget from an error no retry was made for. It remains an awserr.Error.
+type AttemptsError struct {
+	Err      awserr.Error
+	Attempts int
+	Elapsed  time.Duration
+}
+
+func (e *AttemptsError) Error() string {
+	return fmt.Sprintf("%v (after %d attempts over %s)", e.Err, e.Attempts, e.Elapsed.Round(time.Millisecond))
+}
+
+func (e *AttemptsError) Code() string {
+	return e.Err.Code()
+}
+
+func (e *AttemptsError) Message() string {
+	return e.Err.Message()
+}
+
+func (e *AttemptsError) OrigErr() error {
+	return e.Err.OrigErr()
+}
+
+func (e *AttemptsError) Unwrap() error {
+	return e.Err
+}
+
+// recordAttempts wraps the terminal errors of the requests sent with handlers in an AttemptsError.
+func recordAttempts(handlers *request.Handlers) {
+	handlers.AfterRetry.PushBack(func(req *request.Request) {
+		awsErr, ok := req.Error.(awserr.Error)
+		if !ok {
+			return
+		}
+		req.Error = &AttemptsError{Err: awsErr, Attempts: req.RetryCount + 1, Elapsed: time.Since(req.Time)}
+	})
+}
+
+var registryConfigGuidance = map[string]string{
+	"OptInRequired":                 "the region is not enabled for the account, enable it or use a registry in another region",
+	"SubscriptionRequiredException": "the account is not subscribed to Amazon ECR in this region",
+	"UnrecognizedClientException":   "the AWS credentials are not recognized in this region or partition, check the access key and the region of the registry",
+	"InvalidClientTokenId":          "the AWS credentials are not recognized in this region or partition, check the access key and the region of the registry",
+	"ExpiredTokenException":         "the AWS session credentials have expired, refresh them",
+	"AccessDeniedException":         "the principal is not allowed ecr:GetAuthorizationToken, which is granted by IAM policies on the principal rather than by repository policies",
+}
+
+// organizationDenyGuidance replaces the AccessDeniedException guidance when the denial comes from the organization.
+const organizationDenyGuidance = "a service control policy or explicit deny blocks ecr:GetAuthorizationToken for the account, this is not a repository permission"
+
+// classifyECRError wraps errors of GetAuthorizationToken caused by account or principal configuration in a
+// RegistryConfigError. Other errors are returned unchanged.
+func classifyECRError(err error) error {
+	awsErr, ok := err.(awserr.Error)
+	if !ok {
+		return err
+	}
+	guidance, ok := registryConfigGuidance[awsErr.Code()]
+	if !ok {
+		return err
+	}
+	message := strings.ToLower(awsErr.Message())
+	if awsErr.Code() == "AccessDeniedException" && (strings.Contains(message, "service control policy") || strings.Contains(message, "explicit deny")) {
+		guidance = organizationDenyGuidance
+	}
+	return &RegistryConfigError{Code: awsErr.Code(), Guidance: guidance, Err: err}
+}
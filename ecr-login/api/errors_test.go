@@ -0,0 +1,116 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api/mocks"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyECRError(t *testing.T) {
+	testCases := []struct {
+		err      error
+		guidance string
+	}{
+		{awserr.New("OptInRequired", "region not enabled", nil), registryConfigGuidance["OptInRequired"]},
+		{awserr.New("UnrecognizedClientException", "invalid token", nil), registryConfigGuidance["UnrecognizedClientException"]},
+		{awserr.New("AccessDeniedException", "not authorized to perform ecr:GetAuthorizationToken", nil), registryConfigGuidance["AccessDeniedException"]},
+		{awserr.New("AccessDeniedException", "with an explicit deny in a service control policy", nil), organizationDenyGuidance},
+	}
+
+	for _, testCase := range testCases {
+		var configErr *RegistryConfigError
+		err := classifyECRError(testCase.err)
+		if assert.True(t, errors.As(err, &configErr), "%v", testCase.err) {
+			assert.Equal(t, testCase.guidance, configErr.Guidance)
+			assert.Equal(t, testCase.err, errors.Unwrap(err))
+		}
+	}
+}
+
+func TestClassifyECRErrorUnchanged(t *testing.T) {
+	for _, err := range []error{
+		errors.New("test error"),
+		awserr.New("ServerException", "internal error", nil),
+	} {
+		assert.Equal(t, err, classifyECRError(err))
+	}
+}
+
+func TestGetAuthConfigRegistryConfigError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+	credentialCache := mock_cache.NewMockCredentialsCache(ctrl)
+
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: credentialCache,
+		options:         ClientOptions{AllowCrossAccount: true},
+	}
+
+	credentialCache.EXPECT().GetValid(registryID, gomock.Any()).Return(nil)
+	credentialCache.EXPECT().Get(registryID).Return(nil)
+	ecrClient.EXPECT().GetAuthorizationToken(gomock.Any()).Return(nil, awserr.New("OptInRequired", "region not enabled", nil))
+
+	creds, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	var configErr *RegistryConfigError
+	assert.True(t, errors.As(err, &configErr))
+	assert.Equal(t, "OptInRequired", configErr.Code)
+	assert.Nil(t, creds)
+}
+
+func TestAttemptsError(t *testing.T) {
+	testCases := []struct {
+		name     string
+		status   int
+		code     string
+		attempts int
+	}{
+		{"retries exhausted", http.StatusInternalServerError, "ServerException", defaultAPIRetries + 1},
+		{"terminal", http.StatusBadRequest, "AccessDeniedException", 1},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			requests := 0
+			transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				requests++
+				response := okResponse(`{"__type":"` + testCase.code + `","message":"failed"}`)
+				response.StatusCode = testCase.status
+				return response, nil
+			})
+			ecrClient := newTestECRClient(transport, func(time.Duration) {})
+			recordAttempts(&ecrClient.Handlers)
+
+			_, err := ecrClient.GetAuthorizationToken(&ecr.GetAuthorizationTokenInput{})
+			var attemptsErr *AttemptsError
+			if assert.True(t, errors.As(err, &attemptsErr), "%v", err) {
+				assert.Equal(t, testCase.attempts, attemptsErr.Attempts)
+				assert.Equal(t, requests, attemptsErr.Attempts)
+				assert.Equal(t, testCase.code, attemptsErr.Code(), "the error remains an awserr.Error")
+				assert.Contains(t, err.Error(), fmt.Sprintf("after %d attempts", testCase.attempts))
+			}
+		})
+	}
+}
@@ -18,12 +18,19 @@ import (
 	"encoding/base64"
 	"fmt"
 	"os"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/ec2rolecreds"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/aws/aws-sdk-go/service/ecr/ecriface"
 	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache/redis"
 	"github.com/mitchellh/go-homedir"
 
 	log "github.com/cihub/seelog"
@@ -32,18 +39,593 @@ import (
 type ClientFactory interface {
 	NewClient(region string) Client
 }
-type DefaultClientFactory struct{}
+
+// ClientOptions holds optional behavior for the clients built by DefaultClientFactory. The zero value keeps the
+// default behavior.
+type ClientOptions struct {
+	// StrictTokenParsing rejects authorization tokens that are not standard padded base64 of "AWS:<password>".
+	// It can also be enabled by setting AWS_ECR_STRICT_TOKEN_PARSING.
+	StrictTokenParsing bool
+
+	// MaxTokenLength bounds the length of the authorization tokens accepted from ECR, which fail with
+	// ErrTokenTooLarge beyond it. It defaults to 64 KiB, far above the size of real tokens.
+	MaxTokenLength int
+
+	// UsernameTransformer, when set, rewrites the username decoded from the token, which ECR always sets to AWS,
+	// for registry proxies expecting another username. The password is returned unchanged.
+	UsernameTransformer func(username string) string
+
+	// TokenDecoder, when set, replaces the decoding of the authorization tokens into a username and password, for
+	// ECR-compatible registries encoding them differently. Tokens longer than MaxTokenLength are still rejected
+	// before being decoded, and StrictTokenParsing is ignored.
+	TokenDecoder func(token string) (username, password string, err error)
+
+	// Endpoint overrides the endpoint of every AWS service the helper calls, for example http://localhost:4566 to
+	// test against LocalStack. It can also be set with AWS_ECR_ENDPOINT.
+	Endpoint string
+
+	// RegistryEndpoints overrides the ECR endpoint by registry ID, such as the interface VPC endpoint each
+	// registry is reached through. Tokens for other registries are requested from the default endpoint. It can
+	// also be set with ECR_ENDPOINT_OVERRIDES, as semicolon separated registry=endpoint pairs.
+	RegistryEndpoints map[string]string
+
+	// FreshSessionPerCall builds a new session and credential chain for every call of the client, instead of once
+	// per client, so that credentials resolved and cached by the SDK are never shared between calls, such as across
+	// the forked workers of a long-lived process. Every call then resolves credentials again, at the cost of
+	// latency, while tokens are still shared through the credentials cache. It can also be set with AWS_ECR_FRESH_SESSION.
+	FreshSessionPerCall bool
+
+	// EndpointResolver, when set, resolves the ECR endpoint of the region a client is built for, instead of the
+	// endpoint the SDK derives from the region name. An error means ECR has no endpoint in the region, and
+	// credentials then fail with ErrECRUnavailableInRegion without calling ECR. It is ignored when Endpoint is set,
+	// and RegistryEndpoints take precedence over it.
+	EndpointResolver func(region string) (endpoint string, err error)
+
+	// fixtures replace or record the responses of ECR, for tests.
+	fixtures fixtureSettings
+
+	// endpointOverride is the endpoint of the registry an ECR client is built for, from RegistryEndpoints.
+	endpointOverride string
+
+	// TrustImageRegistry uses the registry encoded in the image host when it differs from the requested registry,
+	// instead of failing with ErrRegistryImageMismatch. It can also be enabled by setting AWS_ECR_TRUST_IMAGE_REGISTRY.
+	TrustImageRegistry bool
+
+	// Network forces the IP version used to connect to ECR: "tcp4" for IPv4 or "tcp6" for IPv6. This works around
+	// broken paths on dual-stack networks. It can also be set with AWS_ECR_NETWORK.
+	Network string
+
+	// DialTimeout and TLSHandshakeTimeout bound establishing connections to ECR, separately from waiting for its
+	// responses, so that an unreachable network fails fast while a slow response is still awaited. They default to
+	// 30 and 10 seconds. They can also be set with AWS_ECR_DIAL_TIMEOUT and AWS_ECR_TLS_HANDSHAKE_TIMEOUT, as
+	// durations such as 2s.
+	DialTimeout         time.Duration
+	TLSHandshakeTimeout time.Duration
+
+	// MinTLSVersion is the lowest TLS version, such as tls.VersionTLS13, accepted for connections to ECR, whatever the
+	// defaults of Go. It defaults to TLS 1.2, and every connection fails with ErrInvalidTLSVersion when it is below
+	// TLS 1.2. It can also be set with AWS_ECR_MIN_TLS_VERSION, as 1.2 or 1.3; every connection then fails if the
+	// version is invalid.
+	MinTLSVersion uint16
+
+	// tlsVersionError is the error parsing AWS_ECR_MIN_TLS_VERSION, which fails every connection.
+	tlsVersionError error
+
+	// PinnedPublicKeys, when set, rejects TLS connections to ECR unless a certificate of the verified chain has one
+	// of these public keys, failing with ErrCertificatePinMismatch, to detect interception. Each pin is the base64
+	// SHA-256 hash of a DER encoded SubjectPublicKeyInfo. They can also be set with AWS_ECR_PINNED_PUBLIC_KEYS, as a
+	// comma separated list, or loaded from the file at AWS_ECR_PINNED_PUBLIC_KEYS_FILE, one per line; every
+	// connection then fails if the pins are invalid.
+	PinnedPublicKeys []string
+
+	// pinError is the error loading the pins named by the environment, which fails every connection.
+	pinError error
+
+	// MaxIdleConns, MaxIdleConnsPerHost and IdleConnTimeout size the pool of connections kept open to ECR. Zero
+	// values keep the defaults of net/http, which allow only 2 idle connections per host. Long running processes
+	// serving many concurrent requests should raise MaxIdleConnsPerHost, for example to 32 with MaxIdleConns at 100
+	// and IdleConnTimeout at 90 seconds.
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+
+	// StripImagePort ignores any port in the image host when matching it against a proxy endpoint without a port.
+	// An explicit :443 is always ignored. It can also be enabled by setting AWS_ECR_STRIP_IMAGE_PORT.
+	StripImagePort bool
+
+	// MatchMode selects how the default EndpointMatcher compares image hosts with proxy endpoints: strict, the
+	// default, host-only or suffix. It can also be set with AWS_ECR_MATCH_MODE.
+	MatchMode MatchMode
+
+	// EndpointMatcher, when set, decides which authorization data returned by ECR serves an image, instead of
+	// matching the image host against the proxy endpoint. It is not consulted for requests without an image.
+	EndpointMatcher EndpointMatcher
+
+	// ReadMargin and RefreshMargin separate serving a cached token from refreshing it. When ReadMargin is set, cached
+	// tokens are served until ReadMargin before they expire, instead of only until half of their validity has
+	// passed. When RefreshMargin is set, a token served within RefreshMargin of its expiry is also refreshed in the
+	// background, so RefreshMargin should exceed ReadMargin. The background refresh outlives a call only in long
+	// running processes, see SynchronousRefresh. They can also be set with AWS_ECR_READ_MARGIN and
+	// AWS_ECR_REFRESH_MARGIN, as durations such as 15m.
+	ReadMargin    time.Duration
+	RefreshMargin time.Duration
+
+	// SynchronousRefresh refreshes a token within RefreshMargin of its expiry before returning, instead of in the
+	// background, for processes exiting as soon as a call returns, such as the helper binary. The refreshed token is
+	// returned, or the cached one when the refresh fails.
+	SynchronousRefresh bool
+
+	// MinRemainingValidity refreshes cached tokens expiring within this duration, so that long running pulls do not
+	// outlast their token. A warning is logged when even a fresh token expires sooner. It can also be set with
+	// AWS_ECR_MIN_REMAINING_VALIDITY, as a duration such as 2h.
+	MinRemainingValidity time.Duration
+
+	// MinTokenValidity is the shortest time, once the refresh margin of half its validity is applied, that a token
+	// returned by ECR must remain valid to be cached. Shorter lived tokens are returned with a warning but not cached,
+	// or fail with ErrTokenTooShortLived when RejectShortLivedTokens is set. It defaults to a minute. They can also be
+	// set with AWS_ECR_MIN_TOKEN_VALIDITY, as a duration such as 5m, and AWS_ECR_REJECT_SHORT_LIVED_TOKENS.
+	MinTokenValidity       time.Duration
+	RejectShortLivedTokens bool
+
+	// StaleGracePeriod bounds the fallback to a cached token when fetching a new one fails: a token that expired
+	// longer ago than this is not served and the error is returned instead. Zero serves cached tokens however long
+	// ago they expired. It can also be set with AWS_ECR_STALE_GRACE_PERIOD, as a duration such as 15m.
+	StaleGracePeriod time.Duration
+
+	// RetryProxyEndpointMismatch calls ECR once more, after a short delay, when none of the authorization data it
+	// returned matches the image, before failing with ErrProxyEndpointMismatch. This covers newly created registries
+	// missing from the first response. It can also be enabled by setting AWS_ECR_RETRY_ENDPOINT_MISMATCH.
+	RetryProxyEndpointMismatch bool
+
+	// AllowedRegistryIDs, when not empty, restricts the registries credentials are retrieved for. Other registries
+	// fail with ErrRegistryNotAllowed before any call to ECR. It can also be set with ECR_ALLOWED_REGISTRY_IDS, as a
+	// comma separated list.
+	AllowedRegistryIDs []string
+
+	// AllowedRegions, when set, lists the only regions credentials are retrieved in, for data residency. Clients
+	// built for other regions fail with ErrRegionNotAllowed before any call to ECR. It can also be set with
+	// ECR_ALLOWED_REGIONS, as a comma separated list.
+	AllowedRegions []string
+
+	// AllowCrossAccount allows fetching tokens for registries outside the account of the credentials. Unless it is
+	// set, such fetches fail with ErrCrossAccountNotAllowed, to prevent accidental cross-account pulls. The account
+	// is looked up with an extra call to ECR and reused for IdentityTTL. When it cannot be determined the check is
+	// skipped with a warning. It can also be enabled by setting ECR_ALLOW_CROSS_ACCOUNT to true.
+	AllowCrossAccount bool
+
+	// IdentityTTL is how long the account of the credentials is reused by the clients of the same credentials,
+	// for the cross-account check and audit records. It defaults to 12 hours, and can also be set with
+	// AWS_ECR_IDENTITY_TTL.
+	IdentityTTL time.Duration
+
+	// RetryClassifier, when set, is consulted for ECR API errors the SDK does not retry. Errors it reports as
+	// retryable are retried within the same budget, which gives an escape hatch for environment-specific transient
+	// errors.
+	RetryClassifier func(err error) bool
+
+	// MaxRetryAfter caps the delay honored when ECR throttles a request with a Retry-After header. It defaults to
+	// 30 seconds.
+	MaxRetryAfter time.Duration
+
+	// IMDSTimeout bounds each request to the instance metadata service, which serves instance profile credentials
+	// through IMDSv2. It defaults to 5 seconds; lower it to fail fast where the metadata service is blocked. It can
+	// also be set with AWS_ECR_IMDS_TIMEOUT, as a duration such as 1s.
+	IMDSTimeout time.Duration
+
+	// CredentialSources, when not empty, replaces the default credential chain with an ordered list of sources.
+	// ECR is called with the first source, and with the next one only when a call fails because of its credentials,
+	// for example to fall back from expired SSO credentials to an instance role. ECR service errors do not fail
+	// over. It can also be set with AWS_ECR_CREDENTIAL_SOURCES, as a comma separated list of profile names, where
+	// "default" stands for the default chain and "instance" for the instance profile.
+	CredentialSources []*credentials.Credentials
+
+	// NonBlockingMiss returns ErrCacheMissWarming right away when no token is cached for a registry, instead of
+	// waiting for ECR, and fetches one in the background so that the next call is served from the cache. Only one
+	// background fetch runs per registry. This suits latency-sensitive, long-running callers: the background fetch
+	// does not outlive the process.
+	NonBlockingMiss bool
+
+	// Offline serves credentials only from the cache, without ever calling ECR, for intermittently connected
+	// environments. Tokens are served until they expire, ignoring the refresh margin and MinRemainingValidity, and
+	// ErrOfflineCacheMiss is returned when none is cached. OfflineAllowStale also serves expired tokens. Cache
+	// entries are still keyed by the access key of the resolved credentials, so they must be available locally. These
+	// can also be enabled by setting ECR_OFFLINE and ECR_OFFLINE_ALLOW_STALE.
+	Offline           bool
+	OfflineAllowStale bool
+
+	// AuditSink, when set, receives an AuditRecord for every successful GetCredentials, for compliance. Records
+	// never include the token. It can also be set with ECR_AUDIT_LOG, the path of a file records are appended to as
+	// JSON lines.
+	AuditSink AuditSink
+
+	// Policy, when set, further restricts the registries credentials are retrieved for and how long tokens are
+	// served from the cache. It can also be loaded from the signed policy at ECR_POLICY_FILE, verified against the
+	// base64 ed25519 public key in ECR_POLICY_PUBLIC_KEY; every registry is then refused if the policy is invalid.
+	Policy *Policy
+
+	// policyError is the error loading the policy named by the environment, which fails every retrieval.
+	policyError error
+
+	// CacheNamespace, when set, isolates cache entries, for example per tenant on shared build hosts, so that tokens
+	// cached under one namespace are never served under another. The file cache then uses a file of its own. It may
+	// only contain letters, digits, dots, dashes and underscores; the cache is disabled otherwise. It can also be set
+	// with ECR_CACHE_NAMESPACE.
+	CacheNamespace string
+
+	// CachePerPrincipal keeps the entries of the Redis cache under a checksum of the access key of the credentials,
+	// rather than under their account, so that principals of one account sharing the server never see each other's
+	// tokens. Hosts then only share tokens when they use the same access key. The file cache is always kept per
+	// access key. It can also be enabled by setting AWS_ECR_CACHE_PER_PRINCIPAL.
+	CachePerPrincipal bool
+
+	// OnCacheSet, when set, is called after every token written to the cache, for example to notify other instances
+	// sharing a Redis cache that an entry was refreshed. The entry includes the token.
+	OnCacheSet func(registry string, entry *cache.AuthEntry)
+
+	// PreFetch, when set, is called before credentials are retrieved for a registry. A non-nil error aborts the
+	// retrieval and is returned to the caller, which allows enforcing policy or emitting audit events.
+	PreFetch func(registry string) error
+
+	// PostFetch, when set, is called after credentials are retrieved for a registry with the error of the
+	// retrieval, if any.
+	PostFetch func(registry string, err error)
+
+	// ObserveCacheAge, when set, is called with the age of every token served from the cache, measured from when it
+	// was requested from ECR. This helps tune refresh margins.
+	ObserveCacheAge func(registry string, age time.Duration)
+}
+
+// cacheNamespacePattern matches the values of CacheNamespace that are safe in a file name and a cache key.
+var cacheNamespacePattern = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
+
+// DefaultClientFactory builds clients backed by Amazon ECR. It holds no state other than Options and builds every
+// client from scratch, so it is safe for concurrent use without any initialization.
+type DefaultClientFactory struct {
+	Options ClientOptions
+}
 
 func (defaultClientFactory DefaultClientFactory) NewClient(region string) Client {
-	awsSession := session.New()
+	options := defaultClientFactory.clientOptions()
+	if options.FreshSessionPerCall {
+		fresh := &freshSessionClient{}
+		fresh.newClient = func() *defaultClient {
+			client := defaultClientFactory.newClient(region, options)
+			client.warming = &fresh.warming
+			return client
+		}
+		return fresh
+	}
+	return defaultClientFactory.newClient(region, options)
+}
+
+func (defaultClientFactory DefaultClientFactory) newClient(region string, options ClientOptions) *defaultClient {
+	// A new session is built for every client rather than shared, so the credential chain (including AWS_PROFILE)
+	// is resolved for each invocation. File cache entries are keyed by the resolved access key, see
+	// credentialsCachePrefix.
+	// The ECR client, the cache and audit records share the credentials of the session, so they are resolved once,
+	// here, to log which provider of the chain supplied them.
+	awsSession := session.New(options.sessionConfig())
+
+	throttle := &throttleTracker{}
+	principal := resolvePrincipal(awsSession.Config.Credentials)
+	regionEndpoint, unavailable := options.resolveRegionEndpoint(region)
+	ecrOptions := options
+	if regionEndpoint != "" {
+		log.Debugf("Using endpoint %s for region %s", regionEndpoint, region)
+		ecrOptions = options.withEndpoint(regionEndpoint)
+	}
+	client := &defaultClient{
+		ecrClient:       defaultClientFactory.buildECRClient(awsSession, region, ecrOptions, throttle),
+		options:         options,
+		principal:       principal,
+		region:          region,
+		throttle:        throttle,
+		unavailable:     unavailable,
+		ecrPublicClient: defaultClientFactory.buildECRPublicClient(awsSession, options, throttle),
+	}
+	client.credentialCache = defaultClientFactory.buildCredentialsCache(awsSession, region, options, client.ownAccount)
+	client.identityCache = defaultClientFactory.buildIdentityCache(awsSession, region, options)
+	if !options.FreshSessionPerCall {
+		// Fresh sessions share nothing resolved from the credentials, including their account.
+		client.identity = sharedIdentity(principal, options.identityTTL(), time.Now())
+	}
+	for registry, endpoint := range options.RegistryEndpoints {
+		if client.registryClients == nil {
+			client.registryClients = make(map[string]ecriface.ECRAPI)
+		}
+		log.Debugf("Using endpoint %s for registry %s", endpoint, registry)
+		client.registryClients[registry] = defaultClientFactory.buildECRClient(awsSession, region, options.withEndpoint(endpoint), throttle)
+	}
+	return client
+}
+
+// sessionConfig is the configuration shared by all service clients built from the session.
+func (options ClientOptions) sessionConfig() *aws.Config {
+	config := &aws.Config{
+		Credentials: credentialChain(os.Getenv("AWS_CONFIG_FILE"), newEC2MetadataClient("", options.IMDSTimeout)),
+	}
+	if len(options.CredentialSources) > 0 {
+		config.Credentials = options.CredentialSources[0]
+	}
+	if options.Endpoint != "" {
+		config.Endpoint = aws.String(options.Endpoint)
+	}
+	return config
+}
+
+// credentialChain returns the default credential chain, with instance profile credentials fetched through
+// metadataClient. When configFile is set, credentials from the profile in that shared config file are tried after
+// the shared credentials file: the vendored SDK predates shared config support and would otherwise ignore
+// AWS_CONFIG_FILE. AWS_SHARED_CREDENTIALS_FILE is honored by the SDK itself.
+func credentialChain(configFile string, metadataClient *ec2metadata.EC2Metadata) *credentials.Credentials {
+	providers := []credentials.Provider{
+		&credentials.EnvProvider{},
+		&credentials.SharedCredentialsProvider{},
+	}
+	if configFile != "" {
+		profile := os.Getenv("AWS_PROFILE")
+		section := "default"
+		if profile != "" && profile != "default" {
+			section = "profile " + profile
+		}
+		providers = append(providers, &credentials.SharedCredentialsProvider{Filename: configFile, Profile: section})
+	}
+	providers = append(providers, &ec2rolecreds.EC2RoleProvider{
+		Client:       metadataClient,
+		ExpiryWindow: 5 * time.Minute,
+	})
+	return credentials.NewCredentials(&credentials.ChainProvider{Providers: providers})
+}
+
+// buildECRClient returns the ECR client for region. The throttling of the real clients is recorded in throttle, and
+// their terminal errors are annotated with an AttemptsError. Replayed fixtures replace the real clients entirely,
+// including their failover between CredentialSources, while recorded fixtures are taken from the real clients.
+func (defaultClientFactory DefaultClientFactory) buildECRClient(awsSession *session.Session, region string, options ClientOptions, throttle *throttleTracker) ecriface.ECRAPI {
+	if fixtures := options.fixtures.replay; fixtures != "" {
+		log.Debugf("Replaying ECR responses from %s", fixtures)
+		return newReplayingECRClient(fixtures)
+	}
+
+	ecrConfig := &aws.Config{Region: aws.String(region), Retryer: newRetryer(options), HTTPClient: options.httpClient()}
+	if options.endpointOverride != "" {
+		ecrConfig.Endpoint = aws.String(options.endpointOverride)
+	}
+	newClient := func(config *aws.Config) ecriface.ECRAPI {
+		ecrClient := ecr.New(awsSession, config)
+		throttle.attach(&ecrClient.Handlers)
+		recordAttempts(&ecrClient.Handlers)
+		return ecrClient
+	}
+	ecrClient := newClient(ecrConfig)
+	if len(options.CredentialSources) > 1 {
+		clients := []ecriface.ECRAPI{ecrClient}
+		for _, source := range options.CredentialSources[1:] {
+			clients = append(clients, newClient(ecrConfig.Copy(&aws.Config{Credentials: source})))
+		}
+		ecrClient = newFailoverECRClient(clients)
+	}
+	if fixtures := options.fixtures.record; fixtures != "" {
+		log.Debugf("Recording ECR responses to %s", fixtures)
+		ecrClient = newRecordingECRClient(ecrClient, fixtures, options.fixtures.redact)
+	}
+	return ecrClient
+}
+
+// withEndpoint returns options with ECR called at endpoint.
+func (options ClientOptions) withEndpoint(endpoint string) ClientOptions {
+	options.endpointOverride = endpoint
+	return options
+}
+
+// buildECRPublicClient returns the Amazon ECR Public client, with the retries and transport of the ECR clients.
+func (defaultClientFactory DefaultClientFactory) buildECRPublicClient(awsSession *session.Session, options ClientOptions, throttle *throttleTracker) ecrPublicAPI {
+	if options.fixtures.replay != "" {
+		return noFixturesPublicClient{}
+	}
+	publicClient := newECRPublicClient(awsSession, &aws.Config{
+		Region:     aws.String(PublicRegion),
+		Retryer:    newRetryer(options),
+		HTTPClient: options.httpClient(),
+	})
+	throttle.attach(&publicClient.Handlers)
+	recordAttempts(&publicClient.Handlers)
+	return publicClient
+}
+
+// clientOptions returns the configured options with any overrides from the environment applied.
+func (defaultClientFactory DefaultClientFactory) clientOptions() ClientOptions {
+	options := defaultClientFactory.Options
+	if fixtures, ok := fixturesFromEnvironment(); ok {
+		options.fixtures = fixtures
+	}
+	if os.Getenv("AWS_ECR_STRICT_TOKEN_PARSING") != "" {
+		options.StrictTokenParsing = true
+	}
+	if os.Getenv("AWS_ECR_TRUST_IMAGE_REGISTRY") != "" {
+		options.TrustImageRegistry = true
+	}
+	if os.Getenv("AWS_ECR_STRIP_IMAGE_PORT") != "" {
+		options.StripImagePort = true
+	}
+	if mode := os.Getenv("AWS_ECR_MATCH_MODE"); mode != "" {
+		if parsed, err := parseMatchMode(mode); err == nil {
+			options.MatchMode = parsed
+		} else {
+			log.Warnf("Ignoring invalid AWS_ECR_MATCH_MODE %q: %v", mode, err)
+		}
+	}
+	if os.Getenv("ECR_ALLOW_CROSS_ACCOUNT") == "true" {
+		options.AllowCrossAccount = true
+	}
+	if ttl := os.Getenv("AWS_ECR_IDENTITY_TTL"); ttl != "" {
+		if parsed, err := time.ParseDuration(ttl); err == nil {
+			options.IdentityTTL = parsed
+		} else {
+			log.Warnf("Ignoring invalid AWS_ECR_IDENTITY_TTL %q: %v", ttl, err)
+		}
+	}
+	if os.Getenv("ECR_OFFLINE") != "" {
+		options.Offline = true
+	}
+	if os.Getenv("ECR_OFFLINE_ALLOW_STALE") != "" {
+		options.OfflineAllowStale = true
+	}
+	if os.Getenv("AWS_ECR_FRESH_SESSION") != "" {
+		options.FreshSessionPerCall = true
+	}
+	if os.Getenv("AWS_ECR_RETRY_ENDPOINT_MISMATCH") != "" {
+		options.RetryProxyEndpointMismatch = true
+	}
+	if network := os.Getenv("AWS_ECR_NETWORK"); network != "" {
+		options.Network = network
+	}
+	if endpoint := os.Getenv("AWS_ECR_ENDPOINT"); endpoint != "" {
+		options.Endpoint = endpoint
+	}
+	if value := os.Getenv("ECR_ENDPOINT_OVERRIDES"); value != "" {
+		if overrides, err := parseEndpointOverrides(value); err == nil {
+			options.RegistryEndpoints = overrides
+		} else {
+			log.Warnf("Ignoring invalid ECR_ENDPOINT_OVERRIDES %q: %v", value, err)
+		}
+	}
+	if timeout := os.Getenv("AWS_ECR_IMDS_TIMEOUT"); timeout != "" {
+		if duration, err := time.ParseDuration(timeout); err == nil {
+			options.IMDSTimeout = duration
+		} else {
+			log.Warnf("Ignoring invalid AWS_ECR_IMDS_TIMEOUT %q: %v", timeout, err)
+		}
+	}
+	if timeout := os.Getenv("AWS_ECR_DIAL_TIMEOUT"); timeout != "" {
+		if duration, err := time.ParseDuration(timeout); err == nil {
+			options.DialTimeout = duration
+		} else {
+			log.Warnf("Ignoring invalid AWS_ECR_DIAL_TIMEOUT %q: %v", timeout, err)
+		}
+	}
+	if timeout := os.Getenv("AWS_ECR_TLS_HANDSHAKE_TIMEOUT"); timeout != "" {
+		if duration, err := time.ParseDuration(timeout); err == nil {
+			options.TLSHandshakeTimeout = duration
+		} else {
+			log.Warnf("Ignoring invalid AWS_ECR_TLS_HANDSHAKE_TIMEOUT %q: %v", timeout, err)
+		}
+	}
+	if version := os.Getenv("AWS_ECR_MIN_TLS_VERSION"); version != "" {
+		options.MinTLSVersion, options.tlsVersionError = parseTLSVersion(version)
+	}
+	if pins := os.Getenv("AWS_ECR_PINNED_PUBLIC_KEYS"); pins != "" {
+		options.PinnedPublicKeys, options.pinError = parsePins(pins)
+	}
+	if pinsFile := os.Getenv("AWS_ECR_PINNED_PUBLIC_KEYS_FILE"); pinsFile != "" {
+		options.PinnedPublicKeys, options.pinError = loadPinsFile(pinsFile)
+	}
+	if options.pinError != nil {
+		log.Errorf("Refusing every connection to ECR: %v", options.pinError)
+	}
+	if allowed := os.Getenv("ECR_ALLOWED_REGISTRY_IDS"); allowed != "" {
+		options.AllowedRegistryIDs = nil
+		for _, registry := range strings.Split(allowed, ",") {
+			if registry = strings.TrimSpace(registry); registry != "" {
+				options.AllowedRegistryIDs = append(options.AllowedRegistryIDs, registry)
+			}
+		}
+	}
+	if allowed := os.Getenv("ECR_ALLOWED_REGIONS"); allowed != "" {
+		options.AllowedRegions = nil
+		for _, region := range strings.Split(allowed, ",") {
+			if region = strings.TrimSpace(region); region != "" {
+				options.AllowedRegions = append(options.AllowedRegions, region)
+			}
+		}
+	}
+	if margin := os.Getenv("AWS_ECR_READ_MARGIN"); margin != "" {
+		if duration, err := time.ParseDuration(margin); err == nil {
+			options.ReadMargin = duration
+		} else {
+			log.Warnf("Ignoring invalid AWS_ECR_READ_MARGIN %q: %v", margin, err)
+		}
+	}
+	if margin := os.Getenv("AWS_ECR_REFRESH_MARGIN"); margin != "" {
+		if duration, err := time.ParseDuration(margin); err == nil {
+			options.RefreshMargin = duration
+		} else {
+			log.Warnf("Ignoring invalid AWS_ECR_REFRESH_MARGIN %q: %v", margin, err)
+		}
+	}
+	if validity := os.Getenv("AWS_ECR_MIN_REMAINING_VALIDITY"); validity != "" {
+		if duration, err := time.ParseDuration(validity); err == nil {
+			options.MinRemainingValidity = duration
+		} else {
+			log.Warnf("Ignoring invalid AWS_ECR_MIN_REMAINING_VALIDITY %q: %v", validity, err)
+		}
+	}
+	if validity := os.Getenv("AWS_ECR_MIN_TOKEN_VALIDITY"); validity != "" {
+		if duration, err := time.ParseDuration(validity); err == nil {
+			options.MinTokenValidity = duration
+		} else {
+			log.Warnf("Ignoring invalid AWS_ECR_MIN_TOKEN_VALIDITY %q: %v", validity, err)
+		}
+	}
+	if os.Getenv("AWS_ECR_REJECT_SHORT_LIVED_TOKENS") != "" {
+		options.RejectShortLivedTokens = true
+	}
+	if grace := os.Getenv("AWS_ECR_STALE_GRACE_PERIOD"); grace != "" {
+		if duration, err := time.ParseDuration(grace); err == nil {
+			options.StaleGracePeriod = duration
+		} else {
+			log.Warnf("Ignoring invalid AWS_ECR_STALE_GRACE_PERIOD %q: %v", grace, err)
+		}
+	}
+	if namespace := os.Getenv("ECR_CACHE_NAMESPACE"); namespace != "" {
+		options.CacheNamespace = namespace
+	}
+	if os.Getenv("AWS_ECR_CACHE_PER_PRINCIPAL") != "" {
+		options.CachePerPrincipal = true
+	}
+	if auditLog := os.Getenv("ECR_AUDIT_LOG"); auditLog != "" {
+		options.AuditSink = NewAuditLog(auditLog)
+	}
+	if policyFile := os.Getenv("ECR_POLICY_FILE"); policyFile != "" {
+		options.Policy, options.policyError = loadPolicyFromEnvironment(policyFile)
+		if options.policyError != nil {
+			log.Errorf("Refusing every registry: %v", options.policyError)
+		}
+	}
+	if sources := os.Getenv("AWS_ECR_CREDENTIAL_SOURCES"); sources != "" {
+		options.CredentialSources = nil
+		for _, source := range strings.Split(sources, ",") {
+			if source = strings.TrimSpace(source); source != "" {
+				options.CredentialSources = append(options.CredentialSources, options.credentialSource(source))
+			}
+		}
+	}
+	return options
+}
 
-	return &defaultClient{
-		ecrClient:       ecr.New(awsSession, &aws.Config{Region: aws.String(region)}),
-		credentialCache: defaultClientFactory.buildCredentialsCache(awsSession, region),
+// credentialSource returns the credentials named by an entry of AWS_ECR_CREDENTIAL_SOURCES: the default chain for
+// "default", instance profile credentials for "instance", and the named profile otherwise.
+func (options ClientOptions) credentialSource(name string) *credentials.Credentials {
+	configFile := os.Getenv("AWS_CONFIG_FILE")
+	metadataClient := newEC2MetadataClient("", options.IMDSTimeout)
+	switch name {
+	case "default":
+		return credentialChain(configFile, metadataClient)
+	case "instance":
+		return credentials.NewCredentials(&ec2rolecreds.EC2RoleProvider{
+			Client:       metadataClient,
+			ExpiryWindow: 5 * time.Minute,
+		})
+	}
+	providers := []credentials.Provider{&credentials.SharedCredentialsProvider{Profile: name}}
+	if configFile != "" {
+		providers = append(providers, &credentials.SharedCredentialsProvider{Filename: configFile, Profile: "profile " + name})
 	}
+	return credentials.NewCredentials(&credentials.ChainProvider{Providers: providers})
 }
 
-func (defaultClientFactory DefaultClientFactory) buildCredentialsCache(awsSession *session.Session, region string) cache.CredentialsCache {
+// buildCredentialsCache returns the cache of the tokens of the client. Entries of the Redis cache, which is shared
+// between hosts, are kept under the account of the credentials, resolved with account.
+func (defaultClientFactory DefaultClientFactory) buildCredentialsCache(awsSession *session.Session, region string, options ClientOptions, account func() (string, error)) cache.CredentialsCache {
 	if os.Getenv("AWS_ECR_DISABLE_CACHE") != "" {
 		log.Debug("Cache disabled due to AWS_ECR_DISABLE_CACHE")
 		return cache.NewNullCredentialsCache()
@@ -57,6 +639,13 @@ func (defaultClientFactory DefaultClientFactory) buildCredentialsCache(awsSessio
 	}
 
 	cacheFilename := "cache.json"
+	if options.CacheNamespace != "" {
+		if !cacheNamespacePattern.MatchString(options.CacheNamespace) {
+			log.Warnf("Disabling cache, invalid cache namespace %q", options.CacheNamespace)
+			return cache.NewNullCredentialsCache()
+		}
+		cacheFilename = "cache-" + options.CacheNamespace + ".json"
+	}
 
 	credentials, err := awsSession.Config.Credentials.Get()
 	if err != nil {
@@ -65,7 +654,124 @@ func (defaultClientFactory DefaultClientFactory) buildCredentialsCache(awsSessio
 		return cache.NewNullCredentialsCache()
 	}
 
-	return cache.NewFileCredentialsCache(cacheDir, cacheFilename, defaultClientFactory.credentialsCachePrefix(region, &credentials))
+	var credentialsCache cache.CredentialsCache
+	if redisAddress := os.Getenv("AWS_ECR_CACHE_REDIS_ADDRESS"); redisAddress != "" {
+		log.Debugf("Using redis cache at %s", redisAddress)
+		if options.CachePerPrincipal {
+			credentialsCache = redis.NewCredentialsCache(redisAddress, principalCachePrefix(region, options.CacheNamespace, &credentials))
+		} else {
+			credentialsCache = newAccountCredentialsCache(func(account string) cache.CredentialsCache {
+				return redis.NewCredentialsCache(redisAddress, sharedCachePrefix(region, options.CacheNamespace)+account+"/")
+			}, account)
+		}
+	} else {
+		cachePrefixKey := defaultClientFactory.credentialsCachePrefix(region, &credentials)
+		if options.CacheNamespace != "" {
+			cachePrefixKey = options.CacheNamespace + "/" + cachePrefixKey
+		}
+		credentialsCache = cache.NewFileCredentialsCache(cacheDir, cacheFilename, cachePrefixKey)
+	}
+
+	if secret := os.Getenv("AWS_ECR_CACHE_ENCRYPTION_KEY"); secret != "" {
+		credentialsCache = cache.NewEncryptedCredentialsCache(credentialsCache, secret)
+	}
+
+	credentialsCache = cache.NewObservedCredentialsCache(credentialsCache, options.OnCacheSet)
+
+	if os.Getenv("AWS_ECR_CACHE_KEEP_LONGEST_EXPIRY") != "" {
+		credentialsCache = cache.NewLongestExpiryCredentialsCache(credentialsCache)
+	}
+	return credentialsCache
+}
+
+// buildIdentityCache returns the cache keeping the account of the credentials between processes, or nil when tokens
+// are not cached in Redis. Its entries are kept under the access key of the credentials, so that the hosts sharing
+// the Redis cache each resolve the account of their own credentials.
+func (defaultClientFactory DefaultClientFactory) buildIdentityCache(awsSession *session.Session, region string, options ClientOptions) cache.CredentialsCache {
+	redisAddress := os.Getenv("AWS_ECR_CACHE_REDIS_ADDRESS")
+	if os.Getenv("AWS_ECR_DISABLE_CACHE") != "" || redisAddress == "" {
+		return nil
+	}
+	if options.CacheNamespace != "" && !cacheNamespacePattern.MatchString(options.CacheNamespace) {
+		return nil
+	}
+	credentials, err := awsSession.Config.Credentials.Get()
+	if err != nil {
+		return nil
+	}
+	return redis.NewCredentialsCache(redisAddress, identityCachePrefix(region, options.CacheNamespace, &credentials))
+}
+
+// endpointMatcher returns EndpointMatcher, or a ProxyEndpointMatcher honoring StripImagePort and MatchMode when
+// unset.
+func (options ClientOptions) endpointMatcher() EndpointMatcher {
+	if options.EndpointMatcher == nil {
+		return ProxyEndpointMatcher{StripAnyPort: options.StripImagePort, Mode: options.MatchMode}
+	}
+	return options.EndpointMatcher
+}
+
+// maxTokenLength returns MaxTokenLength, or its default when unset.
+func (options ClientOptions) maxTokenLength() int {
+	if options.MaxTokenLength <= 0 {
+		return defaultMaxTokenLength
+	}
+	return options.MaxTokenLength
+}
+
+// minTokenValidity returns MinTokenValidity, or its default when unset.
+func (options ClientOptions) minTokenValidity() time.Duration {
+	if options.MinTokenValidity <= 0 {
+		return defaultMinTokenValidity
+	}
+	return options.MinTokenValidity
+}
+
+// loadPolicyFromEnvironment loads the policy at path with the public key in ECR_POLICY_PUBLIC_KEY.
+func loadPolicyFromEnvironment(path string) (*Policy, error) {
+	publicKey, err := base64.StdEncoding.DecodeString(os.Getenv("ECR_POLICY_PUBLIC_KEY"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: ECR_POLICY_PUBLIC_KEY: %v", ErrInvalidPolicy, err)
+	}
+	return LoadPolicy(path, publicKey)
+}
+
+// checkRegistry returns an error if credentials must not be retrieved for registry, because of AllowedRegistryIDs,
+// the Policy, or an invalid policy.
+func (options ClientOptions) checkRegistry(registry string) error {
+	if options.policyError != nil {
+		return options.policyError
+	}
+	if !options.allowsRegistry(registry) || !options.Policy.allowsRegistry(registry) {
+		return fmt.Errorf("%w: %s", ErrRegistryNotAllowed, registry)
+	}
+	return nil
+}
+
+// checkRegion returns an error wrapping ErrRegionNotAllowed if AllowedRegions does not include region.
+func (options ClientOptions) checkRegion(region string) error {
+	if len(options.AllowedRegions) == 0 {
+		return nil
+	}
+	for _, allowed := range options.AllowedRegions {
+		if allowed == region {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrRegionNotAllowed, region)
+}
+
+// allowsRegistry reports whether AllowedRegistryIDs permits retrieving credentials for registry.
+func (options ClientOptions) allowsRegistry(registry string) bool {
+	if len(options.AllowedRegistryIDs) == 0 {
+		return true
+	}
+	for _, allowed := range options.AllowedRegistryIDs {
+		if allowed == registry {
+			return true
+		}
+	}
+	return false
 }
 
 // Determine a key prefix for a credentials cache. Because auth tokens are scoped to an account and region, rely on provided
@@ -74,6 +780,29 @@ func (defaultClientFactory DefaultClientFactory) credentialsCachePrefix(region s
 	return fmt.Sprintf("%s-%s-", region, checksum(credentials.AccessKeyID))
 }
 
+// sharedCachePrefix returns the key prefix of a cache shared between hosts, such as the Redis cache. The tokens of the
+// region are kept under it by account, see accountCredentialsCache, so that they are shared by every host with
+// credentials of the account, whatever their access key: instance profile and other temporary credentials have a
+// different access key on every host and after every rotation, so keying on it would keep hosts from ever sharing
+// an entry. Hosts whose tokens must not be shared use different namespaces, or CachePerPrincipal.
+func sharedCachePrefix(region, namespace string) string {
+	prefix := "ecr-credential-helper/" + region + "/"
+	if namespace != "" {
+		prefix += namespace + "/"
+	}
+	return prefix
+}
+
+// principalCachePrefix returns the key prefix of the tokens of credentials in a shared cache, for CachePerPrincipal.
+func principalCachePrefix(region, namespace string, credentials *credentials.Value) string {
+	return sharedCachePrefix(region, namespace) + "principals/" + checksum(credentials.AccessKeyID) + "/"
+}
+
+// identityCachePrefix returns the key prefix under which the account of credentials is kept in a shared cache.
+func identityCachePrefix(region, namespace string, credentials *credentials.Value) string {
+	return sharedCachePrefix(region, namespace) + "identities/" + checksum(credentials.AccessKeyID) + "/"
+}
+
 // Base64 encodes an MD5 checksum. Relied on for uniqueness, and not for cryptographic security.
 func checksum(text string) string {
 	hasher := md5.New()
@@ -0,0 +1,304 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache"
+	"github.com/mitchellh/go-homedir"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSharedCredentials = `[first]
+aws_access_key_id = AKIDFIRST
+aws_secret_access_key = SECRETFIRST
+
+[second]
+aws_access_key_id = AKIDSECOND
+aws_secret_access_key = SECRETSECOND
+`
+
+func setupSharedCredentials(t *testing.T) {
+	credentialsFile := filepath.Join(t.TempDir(), "credentials")
+	err := ioutil.WriteFile(credentialsFile, []byte(testSharedCredentials), 0600)
+	assert.NoError(t, err)
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_ACCESS_KEY", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	t.Setenv("AWS_SECRET_KEY", "")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", credentialsFile)
+	t.Setenv("AWS_CONFIG_FILE", "")
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_ECR_DISABLE_CACHE", "true")
+}
+
+func clientCredentials(t *testing.T, client Client) credentials.Value {
+	ecrClient, ok := client.(*defaultClient).ecrClient.(*ecr.ECR)
+	assert.True(t, ok)
+	value, err := ecrClient.Config.Credentials.Get()
+	assert.NoError(t, err)
+	return value
+}
+
+func TestNewClientHonorsProfileChanges(t *testing.T) {
+	setupSharedCredentials(t)
+	factory := DefaultClientFactory{}
+
+	t.Setenv("AWS_PROFILE", "first")
+	first := clientCredentials(t, factory.NewClient("us-west-2"))
+	assert.Equal(t, "AKIDFIRST", first.AccessKeyID)
+
+	t.Setenv("AWS_PROFILE", "second")
+	second := clientCredentials(t, factory.NewClient("us-west-2"))
+	assert.Equal(t, "AKIDSECOND", second.AccessKeyID)
+
+	assert.NotEqual(t,
+		factory.credentialsCachePrefix("us-west-2", &first),
+		factory.credentialsCachePrefix("us-west-2", &second))
+}
+
+func TestSharedFileCacheSeparatesPrincipals(t *testing.T) {
+	factory := DefaultClientFactory{}
+	first := credentials.Value{AccessKeyID: "AKIDFIRST"}
+	second := credentials.Value{AccessKeyID: "AKIDSECOND"}
+
+	cacheDir := t.TempDir()
+	firstCache := cache.NewFileCredentialsCache(cacheDir, "cache.json", factory.credentialsCachePrefix("us-west-2", &first))
+	secondCache := cache.NewFileCredentialsCache(cacheDir, "cache.json", factory.credentialsCachePrefix("us-west-2", &second))
+
+	firstCache.Set(registryID, &cache.AuthEntry{AuthorizationToken: "first"})
+	assert.Nil(t, secondCache.Get(registryID), "a token cached by one principal must not be served to another")
+
+	secondCache.Set(registryID, &cache.AuthEntry{AuthorizationToken: "second"})
+	assert.Equal(t, "first", firstCache.Get(registryID).AuthorizationToken)
+	assert.Equal(t, "second", secondCache.Get(registryID).AuthorizationToken)
+}
+
+func TestCacheNamespacesSeparateEntries(t *testing.T) {
+	t.Setenv("AWS_ECR_DISABLE_CACHE", "")
+	t.Setenv("AWS_ECR_CACHE_REDIS_ADDRESS", "")
+	home := t.TempDir()
+	assert.NoError(t, os.Mkdir(filepath.Join(home, ".ecr"), 0700))
+	t.Setenv("HOME", home)
+	homedir.DisableCache = true
+	defer func() { homedir.DisableCache = false }()
+
+	awsSession := session.New(&aws.Config{Credentials: credentials.NewStaticCredentials("AKID", "SECRET", "")})
+	buildCache := func(namespace string) cache.CredentialsCache {
+		factory := DefaultClientFactory{}
+		return factory.buildCredentialsCache(awsSession, "us-west-2", ClientOptions{CacheNamespace: namespace}, nil)
+	}
+	tenantA := buildCache("tenant-a")
+	tenantB := buildCache("tenant-b")
+	shared := buildCache("")
+
+	tenantA.Set(registryID, &cache.AuthEntry{AuthorizationToken: "a"})
+	assert.Nil(t, tenantB.Get(registryID), "a token cached in one namespace must not be served in another")
+	assert.Nil(t, shared.Get(registryID))
+
+	tenantB.Set(registryID, &cache.AuthEntry{AuthorizationToken: "b"})
+	assert.Equal(t, "a", tenantA.Get(registryID).AuthorizationToken)
+	assert.Equal(t, "b", buildCache("tenant-b").Get(registryID).AuthorizationToken)
+
+	for _, filename := range []string{"cache-tenant-a.json", "cache-tenant-b.json"} {
+		_, err := os.Stat(filepath.Join(home, ".ecr", filename))
+		assert.NoError(t, err, filename)
+	}
+	_, err := os.Stat(filepath.Join(home, ".ecr", "cache.json"))
+	assert.True(t, os.IsNotExist(err), "without a namespace the default file is untouched")
+}
+
+func TestCacheNamespaceInvalid(t *testing.T) {
+	t.Setenv("AWS_ECR_DISABLE_CACHE", "")
+	t.Setenv("HOME", t.TempDir())
+	homedir.DisableCache = true
+	defer func() { homedir.DisableCache = false }()
+	t.Setenv("ECR_CACHE_NAMESPACE", "../tenant")
+	options := DefaultClientFactory{}.clientOptions()
+	assert.Equal(t, "../tenant", options.CacheNamespace)
+
+	awsSession := session.New(&aws.Config{Credentials: credentials.NewStaticCredentials("AKID", "SECRET", "")})
+	credentialsCache := DefaultClientFactory{}.buildCredentialsCache(awsSession, "us-west-2", options, nil)
+	credentialsCache.Set(registryID, &cache.AuthEntry{AuthorizationToken: "token"})
+	assert.Nil(t, credentialsCache.Get(registryID), "an invalid namespace disables the cache")
+}
+
+func TestNewClientSharedCredentialsFile(t *testing.T) {
+	setupSharedCredentials(t)
+	credentialsFile := filepath.Join(t.TempDir(), "mounted-credentials")
+	err := ioutil.WriteFile(credentialsFile, []byte("[default]\naws_access_key_id = AKIDMOUNTED\naws_secret_access_key = SECRET\n"), 0600)
+	assert.NoError(t, err)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", credentialsFile)
+
+	value := clientCredentials(t, DefaultClientFactory{}.NewClient("us-west-2"))
+	assert.Equal(t, "AKIDMOUNTED", value.AccessKeyID)
+}
+
+func TestNewClientConfigFile(t *testing.T) {
+	setupSharedCredentials(t)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "missing"))
+	configFile := filepath.Join(t.TempDir(), "config")
+	err := ioutil.WriteFile(configFile, []byte("[profile dev]\nregion = us-west-2\naws_access_key_id = AKIDCONFIG\naws_secret_access_key = SECRET\n"), 0600)
+	assert.NoError(t, err)
+	t.Setenv("AWS_CONFIG_FILE", configFile)
+	t.Setenv("AWS_PROFILE", "dev")
+
+	value := clientCredentials(t, DefaultClientFactory{}.NewClient("us-west-2"))
+	assert.Equal(t, "AKIDCONFIG", value.AccessKeyID)
+}
+
+func TestNewClientEndpointOverride(t *testing.T) {
+	setupSharedCredentials(t)
+	t.Setenv("AWS_ECR_ENDPOINT", "http://localhost:4566")
+
+	client := DefaultClientFactory{}.NewClient("us-east-1")
+	ecrClient := client.(*defaultClient).ecrClient.(*ecr.ECR)
+	assert.Equal(t, "http://localhost:4566", ecrClient.Endpoint)
+}
+
+// TestLocalStackIntegration runs against a LocalStack instance when AWS_ECR_LOCALSTACK_ENDPOINT is set, for example
+//
+//	docker run -d -p 4566:4566 localstack/localstack
+//	AWS_ECR_LOCALSTACK_ENDPOINT=http://localhost:4566 go test ./api -run LocalStack
+func TestLocalStackIntegration(t *testing.T) {
+	endpoint := os.Getenv("AWS_ECR_LOCALSTACK_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("AWS_ECR_LOCALSTACK_ENDPOINT is not set")
+	}
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_ECR_DISABLE_CACHE", "true")
+
+	client := DefaultClientFactory{Options: ClientOptions{Endpoint: endpoint}}.NewClient("us-east-1")
+	creds, err := client.GetCredentials("000000000000", "000000000000.dkr.ecr.us-east-1.localhost.localstack.cloud:4566/myimage")
+	assert.NoError(t, err)
+	if assert.NotNil(t, creds) {
+		assert.NotEmpty(t, creds.Password)
+	}
+}
+
+func TestNewClientConcurrentFirstUse(t *testing.T) {
+	setupSharedCredentials(t)
+	t.Setenv("AWS_PROFILE", "first")
+	factory := DefaultClientFactory{Options: ClientOptions{AllowCrossAccount: true, fixtures: fixtureSettings{replay: recordFixture(t, false)}}}
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			creds, err := factory.NewClient("us-west-2").GetCredentials(registryID, proxyEndpoint+"/myimage")
+			if assert.NoError(t, err) {
+				assert.Equal(t, expectedPassword, creds.Password)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestClientOptionsAllowedRegions(t *testing.T) {
+	t.Setenv("ECR_ALLOWED_REGIONS", "eu-west-1, eu-central-1,")
+	options := DefaultClientFactory{Options: ClientOptions{AllowedRegions: []string{"us-east-1"}}}.clientOptions()
+	assert.Equal(t, []string{"eu-west-1", "eu-central-1"}, options.AllowedRegions)
+	assert.Nil(t, options.checkRegion("eu-central-1"))
+	assert.True(t, errors.Is(options.checkRegion("us-east-1"), ErrRegionNotAllowed))
+
+	assert.Nil(t, ClientOptions{}.checkRegion("us-east-1"), "an empty allowlist allows every region")
+}
+
+func TestClientOptionsAllowedRegistryIDs(t *testing.T) {
+	t.Setenv("ECR_ALLOWED_REGISTRY_IDS", "111111111111, 222222222222,")
+	options := DefaultClientFactory{Options: ClientOptions{AllowedRegistryIDs: []string{"333333333333"}}}.clientOptions()
+	assert.Equal(t, []string{"111111111111", "222222222222"}, options.AllowedRegistryIDs)
+	assert.True(t, options.allowsRegistry("222222222222"))
+	assert.False(t, options.allowsRegistry("333333333333"))
+
+	assert.True(t, ClientOptions{}.allowsRegistry("333333333333"), "an empty allowlist allows every registry")
+}
+
+func TestClientOptionsAllowCrossAccount(t *testing.T) {
+	t.Setenv("ECR_ALLOW_CROSS_ACCOUNT", "")
+	assert.False(t, DefaultClientFactory{}.clientOptions().AllowCrossAccount, "cross-account registries are denied by default")
+
+	t.Setenv("ECR_ALLOW_CROSS_ACCOUNT", "false")
+	assert.False(t, DefaultClientFactory{}.clientOptions().AllowCrossAccount)
+
+	t.Setenv("ECR_ALLOW_CROSS_ACCOUNT", "true")
+	assert.True(t, DefaultClientFactory{}.clientOptions().AllowCrossAccount)
+}
+
+// countingProvider returns static credentials, counting how often they are retrieved.
+type countingProvider struct {
+	lock       sync.Mutex
+	retrievals int
+}
+
+func (p *countingProvider) Retrieve() (credentials.Value, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.retrievals++
+	return credentials.Value{AccessKeyID: "AKIDCOUNTED", SecretAccessKey: "SECRET", ProviderName: "countingProvider"}, nil
+}
+
+func (p *countingProvider) IsExpired() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.retrievals == 0
+}
+
+func TestNewClientResolvesCredentialsOnce(t *testing.T) {
+	setupSharedCredentials(t)
+	t.Setenv("AWS_ECR_DISABLE_CACHE", "")
+	t.Setenv("HOME", t.TempDir())
+	homedir.DisableCache = true
+	defer func() { homedir.DisableCache = false }()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testAuthorizationResponse))
+	}))
+	defer server.Close()
+
+	// The cache prefix, the audit record and the signature of the request to ECR all use the credentials of the
+	// session, which are resolved once.
+	provider := &countingProvider{}
+	factory := DefaultClientFactory{Options: ClientOptions{
+		Endpoint:          server.URL,
+		CredentialSources: []*credentials.Credentials{credentials.NewCredentials(provider)},
+		AuditSink:         &recordingAuditSink{},
+	}}
+	client := factory.NewClient("us-west-2")
+	creds, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	assert.NoError(t, err)
+	assert.Equal(t, "password", creds.Password)
+	assert.Equal(t, 1, provider.retrievals)
+}
+
+func TestSharedCachePrefix(t *testing.T) {
+	// Hosts share the entries of a region whatever their access key, and are only told apart by namespace.
+	assert.Equal(t, "ecr-credential-helper/us-west-2/", sharedCachePrefix("us-west-2", ""))
+	assert.Equal(t, "ecr-credential-helper/us-west-2/tenant-a/", sharedCachePrefix("us-west-2", "tenant-a"))
+	assert.NotEqual(t, sharedCachePrefix("us-west-2", ""), sharedCachePrefix("us-east-1", ""))
+}
@@ -0,0 +1,72 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/aws/aws-sdk-go/service/ecr/ecriface"
+	log "github.com/cihub/seelog"
+)
+
+// credentialErrorCodes are the error codes caused by the credentials a request is signed with, either while
+// retrieving them or when ECR rejects them. Any other error comes from ECR itself and is not failed over.
+var credentialErrorCodes = map[string]bool{
+	"NoCredentialProviders":               true,
+	"EnvAccessKeyNotFound":                true,
+	"EnvSecretNotFound":                   true,
+	"EmptyStaticCreds":                    true,
+	"SharedCredsLoad":                     true,
+	"SharedCredsAccessKey":                true,
+	"SharedCredsSecret":                   true,
+	"EmptyEC2RoleList":                    true,
+	"EC2RoleRequestError":                 true,
+	"UnrecognizedClientException":         true,
+	"InvalidSignatureException":           true,
+	"ExpiredTokenException":               true,
+	"MissingAuthenticationTokenException": true,
+}
+
+// failoverECRClient calls GetAuthorizationToken with each of its clients in order, moving on to the next one only
+// when a call fails because of its credentials. Other methods are served by the first client.
+type failoverECRClient struct {
+	ecriface.ECRAPI
+	clients []ecriface.ECRAPI
+}
+
+// newFailoverECRClient returns a client failing over from the first of clients to the others.
+func newFailoverECRClient(clients []ecriface.ECRAPI) ecriface.ECRAPI {
+	return &failoverECRClient{ECRAPI: clients[0], clients: clients}
+}
+
+func (f *failoverECRClient) GetAuthorizationToken(input *ecr.GetAuthorizationTokenInput) (*ecr.GetAuthorizationTokenOutput, error) {
+	var output *ecr.GetAuthorizationTokenOutput
+	var err error
+	for i, client := range f.clients {
+		output, err = client.GetAuthorizationToken(input)
+		if err == nil || !isCredentialError(err) {
+			return output, err
+		}
+		if i < len(f.clients)-1 {
+			log.Infof("Credential source %d failed, trying the next one: %v", i+1, err)
+		}
+	}
+	return output, err
+}
+
+// isCredentialError reports whether err was caused by the credentials used to sign the request.
+func isCredentialError(err error) bool {
+	awsErr, ok := err.(awserr.Error)
+	return ok && credentialErrorCodes[awsErr.Code()]
+}
@@ -0,0 +1,112 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/aws/aws-sdk-go/service/ecr/ecriface"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFailoverOnCredentialError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	primary := mock_ecriface.NewMockECRAPI(ctrl)
+	secondary := mock_ecriface.NewMockECRAPI(ctrl)
+
+	expected := &ecr.GetAuthorizationTokenOutput{}
+	primary.EXPECT().GetAuthorizationToken(gomock.Any()).Return(nil, awserr.New("ExpiredTokenException", "expired", nil))
+	secondary.EXPECT().GetAuthorizationToken(gomock.Any()).Return(expected, nil)
+
+	output, err := newFailoverECRClient([]ecriface.ECRAPI{primary, secondary}).GetAuthorizationToken(&ecr.GetAuthorizationTokenInput{})
+	assert.Nil(t, err)
+	assert.Equal(t, expected, output)
+}
+
+func TestFailoverKeepsServiceError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	primary := mock_ecriface.NewMockECRAPI(ctrl)
+	secondary := mock_ecriface.NewMockECRAPI(ctrl)
+
+	primary.EXPECT().GetAuthorizationToken(gomock.Any()).Return(nil, awserr.New("ServerException", "internal error", nil))
+
+	_, err := newFailoverECRClient([]ecriface.ECRAPI{primary, secondary}).GetAuthorizationToken(&ecr.GetAuthorizationTokenInput{})
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "ServerException", err.(awserr.Error).Code())
+	}
+}
+
+func TestFailoverAllSourcesFail(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	primary := mock_ecriface.NewMockECRAPI(ctrl)
+	secondary := mock_ecriface.NewMockECRAPI(ctrl)
+
+	primary.EXPECT().GetAuthorizationToken(gomock.Any()).Return(nil, credentials.ErrNoValidProvidersFoundInChain)
+	secondary.EXPECT().GetAuthorizationToken(gomock.Any()).Return(nil, awserr.New("UnrecognizedClientException", "invalid", nil))
+
+	_, err := newFailoverECRClient([]ecriface.ECRAPI{primary, secondary}).GetAuthorizationToken(&ecr.GetAuthorizationTokenInput{})
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "UnrecognizedClientException", err.(awserr.Error).Code())
+	}
+}
+
+func TestFailoverFromMissingProfile(t *testing.T) {
+	setupSharedCredentials(t)
+	t.Setenv("AWS_ECR_CREDENTIAL_SOURCES", "missing, second")
+	options := DefaultClientFactory{}.clientOptions()
+	assert.Len(t, options.CredentialSources, 2)
+
+	var signedWith []string
+	transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		signedWith = append(signedWith, req.Header.Get("Authorization"))
+		return okResponse(testAuthorizationResponse), nil
+	})
+	var clients []ecriface.ECRAPI
+	for _, source := range options.CredentialSources {
+		clients = append(clients, ecr.New(session.New(), &aws.Config{
+			Region:      aws.String("us-west-2"),
+			Credentials: source,
+			HTTPClient:  &http.Client{Transport: transport},
+			SleepDelay:  func(time.Duration) {},
+		}))
+	}
+
+	output, err := newFailoverECRClient(clients).GetAuthorizationToken(&ecr.GetAuthorizationTokenInput{})
+	assert.Nil(t, err)
+	assert.Equal(t, "https://proxy", aws.StringValue(output.AuthorizationData[0].ProxyEndpoint))
+	if assert.Len(t, signedWith, 1, "the missing profile never reaches ECR") {
+		assert.True(t, strings.Contains(signedWith[0], "AKIDSECOND"), signedWith[0])
+	}
+}
+
+func TestIsCredentialError(t *testing.T) {
+	assert.True(t, isCredentialError(credentials.ErrNoValidProvidersFoundInChain))
+	assert.True(t, isCredentialError(awserr.New("ExpiredTokenException", "expired", nil)))
+	assert.False(t, isCredentialError(awserr.New("AccessDeniedException", "denied", nil)))
+	assert.False(t, isCredentialError(awserr.New("ServerException", "internal error", nil)))
+	assert.False(t, isCredentialError(nil))
+}
@@ -0,0 +1,31 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+//go:build fixtures
+
+package api
+
+import "os"
+
+// fixturesFromEnvironment returns the fixtures selected by ECR_FIXTURES, which replays recorded responses from a
+// fixtures file instead of calling ECR, and ECR_FIXTURES_RECORD, which records the responses of ECR to one,
+// redacting the tokens when ECR_FIXTURES_REDACT is set. They are only honored by binaries built with the fixtures
+// build tag.
+func fixturesFromEnvironment() (fixtureSettings, bool) {
+	fixtures := fixtureSettings{
+		replay: os.Getenv("ECR_FIXTURES"),
+		record: os.Getenv("ECR_FIXTURES_RECORD"),
+		redact: os.Getenv("ECR_FIXTURES_REDACT") != "",
+	}
+	return fixtures, fixtures.replay != "" || fixtures.record != ""
+}
@@ -0,0 +1,29 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+//go:build fixtures
+
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFixturesFromEnvironment(t *testing.T) {
+	t.Setenv("ECR_FIXTURES", "replay.json")
+	t.Setenv("ECR_FIXTURES_RECORD", "record.json")
+	t.Setenv("ECR_FIXTURES_REDACT", "true")
+	assert.Equal(t, fixtureSettings{replay: "replay.json", record: "record.json", redact: true}, DefaultClientFactory{}.clientOptions().fixtures)
+}
@@ -0,0 +1,22 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+//go:build !fixtures
+
+package api
+
+// fixturesFromEnvironment ignores ECR_FIXTURES and ECR_FIXTURES_RECORD outside of binaries built with the fixtures
+// build tag, so that setting them cannot replace ECR in a shipped binary.
+func fixturesFromEnvironment() (fixtureSettings, bool) {
+	return fixtureSettings{}, false
+}
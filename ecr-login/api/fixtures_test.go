@@ -0,0 +1,114 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api/mocks"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func recordFixture(t *testing.T, redact bool) string {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+
+	ecrClient.EXPECT().GetAuthorizationToken(gomock.Any()).Return(&ecr.GetAuthorizationTokenOutput{
+		AuthorizationData: []*ecr.AuthorizationData{
+			&ecr.AuthorizationData{
+				ProxyEndpoint:      aws.String(proxyEndpointScheme + proxyEndpoint),
+				ExpiresAt:          aws.Time(time.Now().Add(12 * time.Hour)),
+				AuthorizationToken: aws.String(base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword))),
+			},
+		},
+	}, nil)
+
+	fixtures := filepath.Join(t.TempDir(), "fixtures.json")
+	client := &defaultClient{
+		ecrClient:       newRecordingECRClient(ecrClient, fixtures, redact),
+		credentialCache: cache.NewNullCredentialsCache(),
+		options:         ClientOptions{AllowCrossAccount: true},
+	}
+	creds, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	assert.Nil(t, err)
+	assert.Equal(t, expectedPassword, creds.Password)
+	return fixtures
+}
+
+func TestFixturesRecordAndReplay(t *testing.T) {
+	fixtures := recordFixture(t, false)
+
+	client := &defaultClient{
+		ecrClient:       newReplayingECRClient(fixtures),
+		credentialCache: cache.NewNullCredentialsCache(),
+		options:         ClientOptions{AllowCrossAccount: true},
+	}
+	creds, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	assert.Nil(t, err)
+	assert.Equal(t, expectedUsername, creds.Username)
+	assert.Equal(t, expectedPassword, creds.Password)
+
+	creds, err = client.GetCredentials(registryID, "notproxy/myimage")
+	assert.NotNil(t, err)
+	assert.Nil(t, creds)
+}
+
+func TestFixturesRedactedReplay(t *testing.T) {
+	fixtures := recordFixture(t, true)
+
+	client := &defaultClient{
+		ecrClient:       newReplayingECRClient(fixtures),
+		credentialCache: cache.NewNullCredentialsCache(),
+		options:         ClientOptions{AllowCrossAccount: true},
+	}
+	creds, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	assert.Nil(t, err)
+	assert.Equal(t, "AWS", creds.Username)
+	assert.Equal(t, "REDACTED", creds.Password)
+}
+
+func TestFixturesReplayMissingRegistry(t *testing.T) {
+	fixtures := recordFixture(t, false)
+
+	_, err := newReplayingECRClient(fixtures).GetAuthorizationToken(&ecr.GetAuthorizationTokenInput{
+		RegistryIds: []*string{aws.String("111111111111")},
+	})
+	assert.NotNil(t, err)
+}
+
+func TestFixturesReplayMissingFile(t *testing.T) {
+	_, err := newReplayingECRClient(filepath.Join(t.TempDir(), "missing.json")).GetAuthorizationToken(&ecr.GetAuthorizationTokenInput{})
+	assert.NotNil(t, err)
+}
+
+func TestFixturesReplayPublic(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "SECRET")
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_ECR_DISABLE_CACHE", "true")
+
+	// Amazon ECR Public is not called while ECR responses are replayed.
+	factory := DefaultClientFactory{Options: ClientOptions{AllowCrossAccount: true, fixtures: fixtureSettings{replay: recordFixture(t, false)}}}
+	_, err := factory.NewClient(PublicRegion).GetPublicCredentials()
+	assert.True(t, errors.Is(err, errNoPublicFixtures), "%v", err)
+}
@@ -0,0 +1,85 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"context"
+	"sync"
+)
+
+// freshSessionClient builds a new client, with its own session and credential chain, for every call, for
+// FreshSessionPerCall. Nothing resolved from the credentials outlives a call: neither the credentials the SDK
+// caches nor their account, which is not shared with other clients. Only the registries being warmed are shared
+// between the clients, so that background fetches stay single-flight.
+type freshSessionClient struct {
+	newClient func() *defaultClient
+
+	// warming holds the registries fetched in the background by any of the clients.
+	warming sync.Map
+
+	mu sync.Mutex
+	// last is the client built for the latest call, reporting ThrottleState.
+	last *defaultClient
+}
+
+func (f *freshSessionClient) client() *defaultClient {
+	client := f.newClient()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.last = client
+	return client
+}
+
+func (f *freshSessionClient) GetCredentials(registry, image string) (*Credentials, error) {
+	return f.client().GetCredentials(registry, image)
+}
+
+func (f *freshSessionClient) GenerateContainerdHostConfig(registry, image string) ([]byte, error) {
+	return f.client().GenerateContainerdHostConfig(registry, image)
+}
+
+func (f *freshSessionClient) GenerateDockerAuthConfig(registry, image string) ([]byte, error) {
+	return f.client().GenerateDockerAuthConfig(registry, image)
+}
+
+func (f *freshSessionClient) WriteDockerConfig(path string, registries []string) error {
+	return f.client().WriteDockerConfig(path, registries)
+}
+
+func (f *freshSessionClient) DescribeCredentials(registry, image string) (CredentialInfo, error) {
+	return f.client().DescribeCredentials(registry, image)
+}
+
+// IsCached also builds a new client, as cache entries are keyed by the credentials it resolves.
+func (f *freshSessionClient) IsCached(registry string) bool {
+	return f.client().IsCached(registry)
+}
+
+func (f *freshSessionClient) CheckPullPermissions(ctx context.Context, registries []string) (map[string]error, error) {
+	return f.client().CheckPullPermissions(ctx, registries)
+}
+
+// ThrottleState reports the throttling met by the latest call, or no throttling before the first one.
+func (f *freshSessionClient) ThrottleState() ThrottleState {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.last == nil {
+		return ThrottleState{}
+	}
+	return f.last.ThrottleState()
+}
+
+func (f *freshSessionClient) GetPublicCredentials() (*Credentials, error) {
+	return f.client().GetPublicCredentials()
+}
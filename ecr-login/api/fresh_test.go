@@ -0,0 +1,144 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var signingAccessKey = regexp.MustCompile(`Credential=([A-Z0-9]+)/`)
+
+// signingAccessKeys starts an ECR endpoint recording the access key each request is signed with.
+func signingAccessKeys(t *testing.T) (*httptest.Server, func() []string) {
+	var lock sync.Mutex
+	var keys []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		if match := signingAccessKey.FindStringSubmatch(r.Header.Get("Authorization")); match != nil {
+			keys = append(keys, match[1])
+		}
+		w.Write([]byte(testAuthorizationResponse))
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []string {
+		lock.Lock()
+		defer lock.Unlock()
+		return keys
+	}
+}
+
+func TestNewClientSharesSessionByDefault(t *testing.T) {
+	setupSharedCredentials(t)
+	server, keys := signingAccessKeys(t)
+
+	t.Setenv("AWS_PROFILE", "first")
+	client := DefaultClientFactory{Options: ClientOptions{AllowCrossAccount: true, Endpoint: server.URL}}.NewClient("us-west-2")
+	_, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	assert.NoError(t, err)
+
+	// The credentials resolved by the session of the client are reused.
+	t.Setenv("AWS_PROFILE", "second")
+	_, err = client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"AKIDFIRST", "AKIDFIRST"}, keys())
+}
+
+func TestNewClientFreshSessionPerCall(t *testing.T) {
+	setupSharedCredentials(t)
+	server, keys := signingAccessKeys(t)
+
+	t.Setenv("AWS_PROFILE", "first")
+	client := DefaultClientFactory{Options: ClientOptions{
+		AllowCrossAccount:   true,
+		Endpoint:            server.URL,
+		FreshSessionPerCall: true,
+	}}.NewClient("us-west-2")
+	_, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	assert.NoError(t, err)
+
+	// Every call builds a new session, resolving credentials again.
+	t.Setenv("AWS_PROFILE", "second")
+	_, err = client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"AKIDFIRST", "AKIDSECOND"}, keys())
+
+	client.(*freshSessionClient).mu.Lock()
+	last := client.(*freshSessionClient).last
+	client.(*freshSessionClient).mu.Unlock()
+	assert.Equal(t, "AKIDSECOND", clientCredentials(t, last).AccessKeyID)
+}
+
+func TestFreshSessionPerCallFromEnvironment(t *testing.T) {
+	t.Setenv("AWS_ECR_FRESH_SESSION", "true")
+	assert.True(t, DefaultClientFactory{}.clientOptions().FreshSessionPerCall)
+}
+
+func TestFreshSessionPerCallSharesWarming(t *testing.T) {
+	setupSharedCredentials(t)
+	t.Setenv("AWS_PROFILE", "first")
+
+	release := make(chan struct{})
+	var lock sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requests++
+		lock.Unlock()
+		<-release
+		w.Write([]byte(testAuthorizationResponse))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := DefaultClientFactory{Options: ClientOptions{
+		AllowCrossAccount:   true,
+		Endpoint:            server.URL,
+		FreshSessionPerCall: true,
+		NonBlockingMiss:     true,
+	}}.NewClient("us-west-2")
+
+	// The second call finds the fetch of the first still running, although it is made by another client.
+	for i := 0; i < 2; i++ {
+		_, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+		assert.True(t, errors.Is(err, ErrCacheMissWarming), "%v", err)
+	}
+	// Give a second background fetch, if any, the time to reach the server.
+	deadline := time.Now().Add(200 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		lock.Lock()
+		started := requests
+		lock.Unlock()
+		if started > 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal(t, 1, requests)
+
+	fresh := client.(*freshSessionClient)
+	fresh.mu.Lock()
+	defer fresh.mu.Unlock()
+	assert.Nil(t, fresh.last.identity, "the account of the credentials is not shared")
+}
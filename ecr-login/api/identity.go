@@ -0,0 +1,109 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultIdentityTTL is how long the account of the credentials is reused, see IdentityTTL. The identity behind a
+// set of credentials rarely changes within a process, so it is long.
+const defaultIdentityTTL = 12 * time.Hour
+
+// identityResolver caches the account of a set of credentials for the features depending on it, such as the
+// cross-account check and audit records, so that it is looked up once per TTL rather than on every fetch. Failed
+// lookups are not cached.
+type identityResolver struct {
+	lock       sync.Mutex
+	account    string
+	resolvedAt time.Time
+
+	// sharedAt is when the resolver was last handed to a client by sharedIdentity.
+	sharedAt time.Time
+}
+
+// identities holds the identity resolvers shared by the clients of the same credentials, by access key ID.
+var identities sync.Map
+
+// sharedIdentity returns the identity resolver shared by the clients of p, or nil when p is unknown. Resolvers
+// that were neither shared nor holding an account for ttl are evicted, so that rotating temporary credentials do
+// not leave a resolver behind for every access key of a long-lived process.
+func sharedIdentity(p principal, ttl time.Duration, now time.Time) *identityResolver {
+	if p.accessKeyID == "" {
+		return nil
+	}
+	identities.Range(func(key, value interface{}) bool {
+		if resolver := value.(*identityResolver); resolver.stale(ttl, now) {
+			identities.Delete(key)
+		}
+		return true
+	})
+	value, _ := identities.LoadOrStore(p.accessKeyID, &identityResolver{})
+	resolver := value.(*identityResolver)
+	resolver.lock.Lock()
+	resolver.sharedAt = now
+	resolver.lock.Unlock()
+	return resolver
+}
+
+// stale reports whether the resolver was neither shared nor holding an account for ttl at now.
+func (r *identityResolver) stale(ttl time.Duration, now time.Time) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return now.Sub(r.sharedAt) >= ttl && (r.account == "" || now.Sub(r.resolvedAt) >= ttl)
+}
+
+// resolve returns the account cached at now, or the one returned by lookup once ttl has passed since it was
+// resolved.
+func (r *identityResolver) resolve(ttl time.Duration, now time.Time, lookup func() (string, error)) (string, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.account != "" && now.Sub(r.resolvedAt) < ttl {
+		return r.account, nil
+	}
+	account, err := lookup()
+	if err != nil {
+		return "", err
+	}
+	r.account, r.resolvedAt = account, now
+	return account, nil
+}
+
+// cached returns the account cached at now, without looking it up, or an empty string.
+func (r *identityResolver) cached(ttl time.Duration, now time.Time) string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.account != "" && now.Sub(r.resolvedAt) < ttl {
+		return r.account
+	}
+	return ""
+}
+
+// identityResolver returns the identity resolver shared by the clients of the same credentials, or the own resolver
+// of the client when its credentials are unknown.
+func (self *defaultClient) identityResolver() *identityResolver {
+	if self.identity != nil {
+		return self.identity
+	}
+	return &self.ownIdentity
+}
+
+// identityTTL returns IdentityTTL, or its default when unset.
+func (options ClientOptions) identityTTL() time.Duration {
+	if options.IdentityTTL <= 0 {
+		return defaultIdentityTTL
+	}
+	return options.IdentityTTL
+}
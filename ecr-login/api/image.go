@@ -0,0 +1,47 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import "strings"
+
+// ImageReference is an image reference split into its parts. Tag and Digest are empty when the reference has none.
+type ImageReference struct {
+	Host       string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// ParseImage splits image, such as 123456789012.dkr.ecr.us-west-2.amazonaws.com/my-repository:my-tag@sha256:...,
+// into its host, repository, tag and digest. Any scheme is ignored. Tag and digest references, or both, of the same
+// repository therefore parse to the same host and repository, so they resolve to the same credentials.
+func ParseImage(image string) ImageReference {
+	var reference ImageReference
+	remainder := trimScheme(image)
+	if i := strings.Index(remainder, "@"); i >= 0 {
+		reference.Digest = remainder[i+1:]
+		remainder = remainder[:i]
+	}
+	parts := strings.SplitN(remainder, "/", 2)
+	reference.Host = parts[0]
+	if len(parts) < 2 {
+		return reference
+	}
+	reference.Repository = parts[1]
+	if i := strings.LastIndex(reference.Repository, ":"); i >= 0 && !strings.Contains(reference.Repository[i:], "/") {
+		reference.Tag = reference.Repository[i+1:]
+		reference.Repository = reference.Repository[:i]
+	}
+	return reference
+}
@@ -0,0 +1,58 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testDigest = "sha256:4355a46b19d348dc2f57c046f8ef63d4538ebb936000f3c9ee954a27460dd865"
+
+func TestParseImage(t *testing.T) {
+	testCases := []struct {
+		image    string
+		expected ImageReference
+	}{
+		{proxyEndpoint + "/myimage", ImageReference{Host: proxyEndpoint, Repository: "myimage"}},
+		{proxyEndpoint + "/myimage:latest", ImageReference{Host: proxyEndpoint, Repository: "myimage", Tag: "latest"}},
+		{proxyEndpoint + "/myimage@" + testDigest, ImageReference{Host: proxyEndpoint, Repository: "myimage", Digest: testDigest}},
+		{proxyEndpoint + "/team/myimage:v1@" + testDigest, ImageReference{Host: proxyEndpoint, Repository: "team/myimage", Tag: "v1", Digest: testDigest}},
+		{proxyEndpointScheme + proxyEndpoint + ":443/myimage:v1", ImageReference{Host: proxyEndpoint + ":443", Repository: "myimage", Tag: "v1"}},
+		{"localhost:4566/myimage", ImageReference{Host: "localhost:4566", Repository: "myimage"}},
+		{proxyEndpoint, ImageReference{Host: proxyEndpoint}},
+		{proxyEndpoint + "@" + testDigest, ImageReference{Host: proxyEndpoint, Digest: testDigest}},
+	}
+
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.expected, ParseImage(testCase.image), testCase.image)
+	}
+}
+
+func TestMatchesProxyEndpointReferenceForms(t *testing.T) {
+	host := "123456789012.dkr.ecr.us-west-2.amazonaws.com"
+	for _, image := range []string{
+		host + "/myimage",
+		host + "/myimage:latest",
+		host + "/myimage@" + testDigest,
+		host + "/myimage:latest@" + testDigest,
+		host + ":443/myimage@" + testDigest,
+	} {
+		assert.True(t, matchesProxyEndpoint(image, proxyEndpointScheme+host, false), image)
+		assert.Nil(t, validateImage(image), image)
+		assert.Equal(t, "123456789012", registryFromImage(image), image)
+	}
+	assert.False(t, matchesProxyEndpoint(host+"/myimage@"+testDigest, proxyEndpointScheme+"notproxy", false))
+}
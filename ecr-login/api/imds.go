@@ -0,0 +1,128 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	log "github.com/cihub/seelog"
+)
+
+const (
+	// defaultIMDSTimeout matches the timeout the SDK applies to instance metadata requests.
+	defaultIMDSTimeout = 5 * time.Second
+
+	imdsTokenTTL       = 6 * time.Hour
+	imdsTokenHeader    = "X-aws-ec2-metadata-token"
+	imdsTokenTTLHeader = "X-aws-ec2-metadata-token-ttl-seconds"
+
+	// imdsTokenRetryDelay is how long metadata requests go straight to IMDSv1 after a token request failed. A hop
+	// limit dropping the token response would otherwise make every metadata request wait for the whole timeout.
+	imdsTokenRetryDelay = 5 * time.Minute
+)
+
+// imdsToken fetches and caches the session token of IMDSv2 for an instance metadata endpoint.
+type imdsToken struct {
+	endpoint   string
+	httpClient *http.Client
+
+	lock      sync.Mutex
+	token     string
+	expiresAt time.Time
+
+	// err is the error of the last token request, returned without requesting a token again until retryAt.
+	err     error
+	retryAt time.Time
+}
+
+// newEC2MetadataClient returns an instance metadata client that authenticates with IMDSv2 session tokens, falling
+// back to IMDSv1 when a token cannot be fetched. An empty endpoint uses the SDK default, and timeout bounds every
+// metadata request so that a blocked endpoint fails fast.
+func newEC2MetadataClient(endpoint string, timeout time.Duration) *ec2metadata.EC2Metadata {
+	if timeout <= 0 {
+		timeout = defaultIMDSTimeout
+	}
+	config := &aws.Config{HTTPClient: &http.Client{Timeout: timeout}}
+	if endpoint != "" {
+		config.Endpoint = aws.String(endpoint)
+	}
+	client := ec2metadata.New(session.New(), config)
+
+	token := &imdsToken{endpoint: client.ClientInfo.Endpoint, httpClient: config.HTTPClient}
+	client.Handlers.Sign.PushBack(token.sign)
+	return client
+}
+
+// sign adds the session token to a metadata request.
+func (t *imdsToken) sign(r *request.Request) {
+	token, err := t.get()
+	if err != nil {
+		log.Debugf("Could not fetch an IMDSv2 token, falling back to IMDSv1: %v", err)
+		return
+	}
+	r.HTTPRequest.Header.Set(imdsTokenHeader, token)
+}
+
+func (t *imdsToken) get() (string, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.token != "" && time.Now().Before(t.expiresAt) {
+		return t.token, nil
+	}
+	if t.err != nil && time.Now().Before(t.retryAt) {
+		return "", t.err
+	}
+
+	token, err := t.request()
+	if err != nil {
+		t.err, t.retryAt = err, time.Now().Add(imdsTokenRetryDelay)
+		return "", err
+	}
+	t.token, t.err = token, nil
+	// Refresh ahead of the TTL so a token never expires between being read here and reaching the endpoint.
+	t.expiresAt = time.Now().Add(imdsTokenTTL - time.Minute)
+	return t.token, nil
+}
+
+// request requests a new session token from the endpoint.
+func (t *imdsToken) request() (string, error) {
+	req, err := http.NewRequest(http.MethodPut, strings.TrimSuffix(t.endpoint, "/")+"/api/token", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set(imdsTokenTTLHeader, fmt.Sprintf("%d", int(imdsTokenTTL.Seconds())))
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token request returned %s", resp.Status)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
@@ -0,0 +1,122 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials/ec2rolecreds"
+	"github.com/stretchr/testify/assert"
+)
+
+// newStubIMDS serves instance profile credentials, requiring an IMDSv2 token unless tokens are disabled.
+func newStubIMDS(t *testing.T, tokens bool) (*httptest.Server, *int) {
+	tokenRequests := 0
+	server := httptest.NewServer(stubIMDSHandler(tokens, &tokenRequests))
+	t.Cleanup(server.Close)
+	return server, &tokenRequests
+}
+
+// stubIMDSHandler serves the requests of newStubIMDS, counting token requests in tokenRequests.
+func stubIMDSHandler(tokens bool, tokenRequests *int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/latest/api/token" {
+			*tokenRequests++
+			if !tokens || r.Method != http.MethodPut || r.Header.Get(imdsTokenTTLHeader) == "" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte("imds-token"))
+			return
+		}
+		if tokens && r.Header.Get(imdsTokenHeader) != "imds-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/latest/meta-data/iam/security-credentials":
+			w.Write([]byte("test-role"))
+		case "/latest/meta-data/iam/security-credentials/test-role":
+			w.Write([]byte(`{"Code":"Success","AccessKeyId":"AKIDIMDS","SecretAccessKey":"SECRET","Token":"TOKEN","Expiration":"` +
+				time.Now().Add(time.Hour).UTC().Format(time.RFC3339) + `"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}
+}
+
+func TestEC2MetadataClientUsesIMDSv2(t *testing.T) {
+	server, tokenRequests := newStubIMDS(t, true)
+
+	provider := &ec2rolecreds.EC2RoleProvider{Client: newEC2MetadataClient(server.URL+"/latest", time.Second)}
+	value, err := provider.Retrieve()
+	assert.NoError(t, err)
+	assert.Equal(t, "AKIDIMDS", value.AccessKeyID)
+	assert.Equal(t, 1, *tokenRequests, "the token is reused across metadata requests")
+}
+
+func TestEC2MetadataClientFallsBackToIMDSv1(t *testing.T) {
+	server, tokenRequests := newStubIMDS(t, false)
+
+	provider := &ec2rolecreds.EC2RoleProvider{Client: newEC2MetadataClient(server.URL+"/latest", time.Second)}
+	value, err := provider.Retrieve()
+	assert.NoError(t, err)
+	assert.Equal(t, "AKIDIMDS", value.AccessKeyID)
+	assert.Equal(t, 1, *tokenRequests, "a failed token request is not repeated for every metadata request")
+}
+
+func TestEC2MetadataClientDroppedTokenResponse(t *testing.T) {
+	stub := stubIMDSHandler(false, new(int))
+	var tokenRequests int32
+	blocked := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/latest/api/token" {
+			// The hop limit drops the response to the token request.
+			atomic.AddInt32(&tokenRequests, 1)
+			<-blocked
+			return
+		}
+		stub(w, r)
+	}))
+	defer server.Close()
+	defer close(blocked)
+
+	timeout := 200 * time.Millisecond
+	provider := &ec2rolecreds.EC2RoleProvider{Client: newEC2MetadataClient(server.URL+"/latest", timeout)}
+	start := time.Now()
+	value, err := provider.Retrieve()
+	assert.NoError(t, err)
+	assert.Equal(t, "AKIDIMDS", value.AccessKeyID)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&tokenRequests))
+	assert.True(t, time.Since(start) < 2*timeout, "only the first metadata request waits for the token, took %s", time.Since(start))
+}
+
+func TestEC2MetadataClientTimeout(t *testing.T) {
+	blocked := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-blocked
+	}))
+	defer server.Close()
+	defer close(blocked)
+
+	provider := &ec2rolecreds.EC2RoleProvider{Client: newEC2MetadataClient(server.URL+"/latest", 50*time.Millisecond)}
+	start := time.Now()
+	_, err := provider.Retrieve()
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) < 2*time.Second, "a blocked metadata service should fail fast, took %s", time.Since(start))
+}
@@ -0,0 +1,91 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+// EndpointMatcher decides whether authorization data returned by ECR serves an image, so that callers can match
+// on other fields of the response or with their own rules, such as a regular expression over the host.
+type EndpointMatcher interface {
+	Matches(image string, authData *ecr.AuthorizationData) bool
+}
+
+// EndpointMatcherFunc adapts a function to an EndpointMatcher.
+type EndpointMatcherFunc func(image string, authData *ecr.AuthorizationData) bool
+
+func (f EndpointMatcherFunc) Matches(image string, authData *ecr.AuthorizationData) bool {
+	return f(image, authData)
+}
+
+// MatchMode selects how a ProxyEndpointMatcher compares the host of an image with the host of a proxy endpoint.
+type MatchMode string
+
+const (
+	// MatchModeStrict requires the hosts to be equal, ignoring only an explicit :443 on the image, or any port on
+	// the image with StripAnyPort. It is the default.
+	MatchModeStrict MatchMode = "strict"
+
+	// MatchModeHostOnly compares the hosts without their ports.
+	MatchModeHostOnly MatchMode = "host-only"
+
+	// MatchModeSuffix also accepts image hosts ending with the proxy endpoint host, such as CNAMEs and proxies
+	// named <name>.<proxy endpoint host>. Ports are ignored.
+	MatchModeSuffix MatchMode = "suffix"
+)
+
+// parseMatchMode returns the MatchMode named by mode.
+func parseMatchMode(mode string) (MatchMode, error) {
+	switch parsed := MatchMode(strings.ToLower(strings.TrimSpace(mode))); parsed {
+	case MatchModeStrict, MatchModeHostOnly, MatchModeSuffix:
+		return parsed, nil
+	}
+	return "", fmt.Errorf("unknown match mode, expected %s, %s or %s", MatchModeStrict, MatchModeHostOnly, MatchModeSuffix)
+}
+
+// ProxyEndpointMatcher is the default EndpointMatcher. It matches the host of the image against the host of the
+// proxy endpoint as selected by Mode, ignoring the scheme of either. In the default strict mode an explicit :443 on
+// the image is ignored, and StripAnyPort ignores any other port on the image too, when the proxy endpoint has none.
+type ProxyEndpointMatcher struct {
+	StripAnyPort bool
+	Mode         MatchMode
+}
+
+func (m ProxyEndpointMatcher) Matches(image string, authData *ecr.AuthorizationData) bool {
+	if authData.ProxyEndpoint == nil {
+		return false
+	}
+	proxyEndpoint := aws.StringValue(authData.ProxyEndpoint)
+	switch m.Mode {
+	case MatchModeHostOnly:
+		return hostname(imageHost(image)) == hostname(endpointHost(proxyEndpoint))
+	case MatchModeSuffix:
+		imageHostname, endpointHostname := hostname(imageHost(image)), hostname(endpointHost(proxyEndpoint))
+		return imageHostname == endpointHostname || strings.HasSuffix(imageHostname, "."+endpointHostname)
+	}
+	return matchesProxyEndpoint(image, proxyEndpoint, m.StripAnyPort)
+}
+
+// hostname returns host without its port, if any.
+func hostname(host string) string {
+	if i := strings.LastIndex(host, ":"); i >= 0 && !strings.Contains(host[i:], "]") {
+		return host[:i]
+	}
+	return host
+}
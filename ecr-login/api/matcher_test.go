@@ -0,0 +1,141 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api/mocks"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCustomEndpointMatcher(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+
+	// Mirror hosts such as mirror-0123456789012.example.com are served by the registry in their name.
+	mirrorPattern := regexp.MustCompile(`^mirror-([0-9]+)\.example\.com$`)
+	matcher := EndpointMatcherFunc(func(image string, authData *ecr.AuthorizationData) bool {
+		matches := mirrorPattern.FindStringSubmatch(imageHost(image))
+		return len(matches) == 2 && registryFromImage(aws.StringValue(authData.ProxyEndpoint)) == matches[1]
+	})
+
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: cache.NewNullCredentialsCache(),
+		options:         ClientOptions{AllowCrossAccount: true, EndpointMatcher: matcher},
+	}
+
+	token := func(password string) *string {
+		return aws.String(base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + password)))
+	}
+	ecrClient.EXPECT().GetAuthorizationToken(gomock.Any()).Return(&ecr.GetAuthorizationTokenOutput{
+		AuthorizationData: []*ecr.AuthorizationData{
+			&ecr.AuthorizationData{
+				ProxyEndpoint:      aws.String(proxyEndpointScheme + otherRegistryID + ".dkr.ecr.us-west-2.amazonaws.com"),
+				ExpiresAt:          aws.Time(time.Now().Add(12 * time.Hour)),
+				AuthorizationToken: token("other"),
+			},
+			&ecr.AuthorizationData{
+				ProxyEndpoint:      aws.String(proxyEndpointScheme + registryID + ".dkr.ecr.us-west-2.amazonaws.com"),
+				ExpiresAt:          aws.Time(time.Now().Add(12 * time.Hour)),
+				AuthorizationToken: token(expectedPassword),
+			},
+		},
+	}, nil).Times(2)
+
+	creds, err := client.GetCredentials(registryID, "mirror-"+registryID+".example.com/myimage")
+	assert.Nil(t, err)
+	assert.Equal(t, expectedPassword, creds.Password)
+
+	_, err = client.GetCredentials(registryID, registryID+".dkr.ecr.us-west-2.amazonaws.com/myimage")
+	assert.NotNil(t, err, "the custom matcher replaces the default one")
+}
+
+func TestProxyEndpointMatcher(t *testing.T) {
+	authData := &ecr.AuthorizationData{ProxyEndpoint: aws.String(proxyEndpointScheme + proxyEndpoint)}
+	assert.True(t, ProxyEndpointMatcher{}.Matches(proxyEndpoint+"/myimage", authData))
+	assert.False(t, ProxyEndpointMatcher{}.Matches(proxyEndpoint+":8443/myimage", authData))
+	assert.True(t, ProxyEndpointMatcher{StripAnyPort: true}.Matches(proxyEndpoint+":8443/myimage", authData))
+	assert.False(t, ProxyEndpointMatcher{}.Matches(proxyEndpoint+"/myimage", &ecr.AuthorizationData{}))
+}
+
+func TestProxyEndpointMatcherModes(t *testing.T) {
+	const endpoint = registryID + ".dkr.ecr.us-west-2.amazonaws.com"
+	testCases := []struct {
+		image    string
+		endpoint string
+		strict   bool
+		hostOnly bool
+		suffix   bool
+	}{
+		{endpoint + "/myimage", endpoint, true, true, true},
+		{endpoint + ":443/myimage", endpoint, true, true, true},
+		{endpoint + ":8443/myimage", endpoint, false, true, true},
+		{endpoint + "/myimage", endpoint + ":5000", false, true, true},
+		{"mirror." + endpoint + "/myimage", endpoint, false, false, true},
+		{"mirror" + endpoint + "/myimage", endpoint, false, false, false},
+		{otherRegistryID + ".dkr.ecr.us-west-2.amazonaws.com/myimage", endpoint, false, false, false},
+	}
+	for _, testCase := range testCases {
+		authData := &ecr.AuthorizationData{ProxyEndpoint: aws.String(proxyEndpointScheme + testCase.endpoint)}
+		assert.Equal(t, testCase.strict, ProxyEndpointMatcher{}.Matches(testCase.image, authData), "strict: %s", testCase.image)
+		assert.Equal(t, testCase.strict, ProxyEndpointMatcher{Mode: MatchModeStrict}.Matches(testCase.image, authData), "strict: %s", testCase.image)
+		assert.Equal(t, testCase.hostOnly, ProxyEndpointMatcher{Mode: MatchModeHostOnly}.Matches(testCase.image, authData), "host-only: %s", testCase.image)
+		assert.Equal(t, testCase.suffix, ProxyEndpointMatcher{Mode: MatchModeSuffix}.Matches(testCase.image, authData), "suffix: %s", testCase.image)
+	}
+}
+
+func TestGetCredentialsMatchMode(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: cache.NewNullCredentialsCache(),
+		options:         ClientOptions{AllowCrossAccount: true},
+	}
+	expectRegistryToken(ecrClient, registryID)
+	expectRegistryToken(ecrClient, registryID)
+
+	image := "mirror." + registryHost(registryID) + "/myimage"
+	_, err := client.GetCredentials(registryID, image)
+	assert.True(t, errors.Is(err, ErrProxyEndpointMismatch), "strict by default: %v", err)
+
+	client.options.MatchMode = MatchModeSuffix
+	creds, err := client.GetCredentials(registryID, image)
+	assert.Nil(t, err)
+	if assert.NotNil(t, creds) {
+		assert.Equal(t, expectedPassword, creds.Password)
+	}
+}
+
+func TestClientOptionsMatchMode(t *testing.T) {
+	t.Setenv("AWS_ECR_MATCH_MODE", "Host-Only")
+	assert.Equal(t, MatchModeHostOnly, DefaultClientFactory{}.clientOptions().MatchMode)
+
+	t.Setenv("AWS_ECR_MATCH_MODE", "prefix")
+	options := DefaultClientFactory{Options: ClientOptions{MatchMode: MatchModeSuffix}}.clientOptions()
+	assert.Equal(t, MatchModeSuffix, options.MatchMode)
+}
@@ -0,0 +1,78 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	log "github.com/cihub/seelog"
+)
+
+// CheckPullPermissions reports, for each of registries, whether an authorization token can be issued for it, as a
+// preflight check before pulling. A nil error means the registry can be authenticated to. Tokens fetched for the
+// check are discarded instead of being cached. The returned error is only set when ctx is done before every
+// registry was checked; the vendored SDK cannot cancel a request in flight, so ctx is checked between registries.
+// In offline mode a registry passes the check when a usable token is cached for it.
+func (self *defaultClient) CheckPullPermissions(ctx context.Context, registries []string) (map[string]error, error) {
+	results := make(map[string]error, len(registries))
+	for _, registry := range registries {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		results[registry] = self.checkPullPermission(registry)
+	}
+	return results, nil
+}
+
+func (self *defaultClient) checkPullPermission(registry string) error {
+	if err := self.options.checkRegistry(registry); err != nil {
+		return err
+	}
+	if err := self.options.checkRegion(self.region); err != nil {
+		return err
+	}
+	if self.unavailable != nil && !self.overridesEndpoint(registry) {
+		return self.unavailable
+	}
+
+	if self.options.Offline {
+		_, err := self.offlineAuthEntry(registry, self.credentialCache.Get(registry))
+		return err
+	}
+
+	// GetCredentials refuses registries of other accounts, so they cannot be pulled from whatever ECR answers.
+	if err := self.checkOwnAccount(registry, &warnings{}); err != nil {
+		return err
+	}
+
+	log.Debugf("Checking GetAuthorizationToken permission for %s", registry)
+	output, err := self.ecrClientFor(registry).GetAuthorizationToken(&ecr.GetAuthorizationTokenInput{
+		RegistryIds: []*string{aws.String(registry)},
+	})
+	if err != nil {
+		return classifyECRError(self.classifyRegionError(registry, err))
+	}
+	if output == nil {
+		return fmt.Errorf("Missing AuthorizationData in ECR response for %s", registry)
+	}
+	for _, authData := range output.AuthorizationData {
+		if registryFromImage(aws.StringValue(authData.ProxyEndpoint)) == registry && authData.AuthorizationToken != nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w for %s", ErrProxyEndpointMismatch, registry)
+}
@@ -0,0 +1,124 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api/mocks"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckPullPermissions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+	// No calls are expected on the cache: checked tokens must not be cached.
+	credentialCache := mock_cache.NewMockCredentialsCache(ctrl)
+
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: credentialCache,
+		options:         ClientOptions{AllowCrossAccount: true, AllowedRegistryIDs: []string{registryID, otherRegistryID}},
+	}
+
+	ecrClient.EXPECT().GetAuthorizationToken(&ecr.GetAuthorizationTokenInput{
+		RegistryIds: []*string{aws.String(registryID)},
+	}).Return(&ecr.GetAuthorizationTokenOutput{
+		AuthorizationData: []*ecr.AuthorizationData{
+			&ecr.AuthorizationData{
+				ProxyEndpoint:      aws.String(proxyEndpointScheme + registryHost(registryID)),
+				ExpiresAt:          aws.Time(time.Now().Add(12 * time.Hour)),
+				AuthorizationToken: aws.String(base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword))),
+			},
+		},
+	}, nil)
+	ecrClient.EXPECT().GetAuthorizationToken(&ecr.GetAuthorizationTokenInput{
+		RegistryIds: []*string{aws.String(otherRegistryID)},
+	}).Return(nil, awserr.New("AccessDeniedException", "not authorized", nil))
+
+	results, err := client.CheckPullPermissions(context.Background(), []string{registryID, otherRegistryID, "222222222222"})
+	assert.Nil(t, err)
+	assert.Nil(t, results[registryID])
+
+	var configErr *RegistryConfigError
+	assert.True(t, errors.As(results[otherRegistryID], &configErr))
+	assert.True(t, errors.Is(results["222222222222"], ErrRegistryNotAllowed))
+}
+
+func TestCheckPullPermissionsAgreesWithCrossAccountCheck(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: cache.NewNullCredentialsCache(),
+	}
+
+	expectOwnAccountLookup(ecrClient, registryID)
+	expectRegistryToken(ecrClient, registryID)
+	expectRegistryToken(ecrClient, registryID)
+
+	results, err := client.CheckPullPermissions(context.Background(), []string{registryID, otherRegistryID})
+	assert.Nil(t, err)
+	assert.Nil(t, results[registryID])
+	assert.True(t, errors.Is(results[otherRegistryID], ErrCrossAccountNotAllowed), "%v", results[otherRegistryID])
+
+	_, err = client.GetCredentials(registryID, registryHost(registryID)+"/myimage")
+	assert.Nil(t, err)
+	_, err = client.GetCredentials(otherRegistryID, registryHost(otherRegistryID)+"/myimage")
+	assert.True(t, errors.Is(err, ErrCrossAccountNotAllowed), "%v", err)
+}
+
+func TestCheckPullPermissionsCanceled(t *testing.T) {
+	client := &defaultClient{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results, err := client.CheckPullPermissions(ctx, []string{registryID})
+	assert.Equal(t, context.Canceled, err)
+	assert.Empty(t, results)
+}
+
+func TestCheckPullPermissionsOffline(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+	credentialCache := mock_cache.NewMockCredentialsCache(ctrl)
+
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: credentialCache,
+		options:         ClientOptions{Offline: true},
+	}
+
+	credentialCache.EXPECT().Get(registryID).Return(&cache.AuthEntry{ExpiresAt: time.Now().Add(time.Hour)})
+	credentialCache.EXPECT().Get(otherRegistryID).Return(nil)
+
+	results, err := client.CheckPullPermissions(context.Background(), []string{registryID, otherRegistryID})
+	assert.Nil(t, err)
+	assert.Nil(t, results[registryID])
+	assert.True(t, errors.Is(results[otherRegistryID], ErrOfflineCacheMiss))
+}
@@ -0,0 +1,104 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// ErrCertificatePinMismatch is returned when no certificate presented by ECR matches PinnedPublicKeys.
+var ErrCertificatePinMismatch = errors.New("ecr: certificate does not match any pinned public key")
+
+// ErrInvalidPins is returned when the pinned public keys named by the environment cannot be loaded.
+var ErrInvalidPins = errors.New("ecr: invalid pinned public keys")
+
+// publicKeyPin returns the pin of cert: the base64 SHA-256 hash of its DER encoded SubjectPublicKeyInfo, as used by
+// HTTP Public Key Pinning.
+func publicKeyPin(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// parsePins splits pins, separated by commas or new lines, ignoring blank lines and lines starting with #.
+func parsePins(pins string) ([]string, error) {
+	var parsed []string
+	for _, line := range strings.Split(pins, "\n") {
+		if line = strings.TrimSpace(line); line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		for _, pin := range strings.Split(line, ",") {
+			if pin = strings.TrimSpace(pin); pin == "" {
+				continue
+			}
+			if hash, err := base64.StdEncoding.DecodeString(pin); err != nil || len(hash) != sha256.Size {
+				return nil, fmt.Errorf("%w: %q is not a base64 SHA-256 hash", ErrInvalidPins, pin)
+			}
+			parsed = append(parsed, pin)
+		}
+	}
+	if len(parsed) == 0 {
+		return nil, fmt.Errorf("%w: no pins", ErrInvalidPins)
+	}
+	return parsed, nil
+}
+
+// loadPinsFile reads the pins in the file at path, one per line.
+func loadPinsFile(path string) ([]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPins, err)
+	}
+	return parsePins(string(data))
+}
+
+// verifyPins returns a tls.Config VerifyPeerCertificate function accepting connections whose verified chain
+// contains a certificate matching one of pins. It runs after the standard verification, so pinning an intermediate
+// or root certificate survives the rotation of the leaf. When pinError is set every connection fails with it.
+func verifyPins(pins []string, pinError error) func([][]byte, [][]*x509.Certificate) error {
+	return func(_ [][]byte, verifiedChains [][]*x509.Certificate) error {
+		if pinError != nil {
+			return pinError
+		}
+		for _, chain := range verifiedChains {
+			for _, cert := range chain {
+				presented := publicKeyPin(cert)
+				for _, pin := range pins {
+					if presented == pin {
+						return nil
+					}
+				}
+			}
+		}
+		if len(verifiedChains) > 0 && len(verifiedChains[0]) > 0 {
+			return fmt.Errorf("%w: %s presented %s", ErrCertificatePinMismatch,
+				verifiedChains[0][0].Subject.CommonName, publicKeyPin(verifiedChains[0][0]))
+		}
+		return ErrCertificatePinMismatch
+	}
+}
+
+// verifyPeerCertificate returns the VerifyPeerCertificate function enforcing PinnedPublicKeys, or nil when nothing
+// is pinned.
+func (options ClientOptions) verifyPeerCertificate() func([][]byte, [][]*x509.Certificate) error {
+	if len(options.PinnedPublicKeys) == 0 && options.pinError == nil {
+		return nil
+	}
+	return verifyPins(options.PinnedPublicKeys, options.pinError)
+}
@@ -0,0 +1,84 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// getWithPins requests server through a client built from options, trusting the certificate of server.
+func getWithPins(t *testing.T, server *httptest.Server, options ClientOptions) error {
+	httpClient := options.httpClient()
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	transport := httpClient.Transport.(*http.Transport)
+	transport.TLSClientConfig.RootCAs = roots
+	defer transport.CloseIdleConnections()
+
+	response, err := httpClient.Get(server.URL)
+	if err == nil {
+		response.Body.Close()
+	}
+	return err
+}
+
+func TestPinnedPublicKeys(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	assert.Nil(t, ClientOptions{}.verifyPeerCertificate())
+	pin := publicKeyPin(server.Certificate())
+	assert.Nil(t, getWithPins(t, server, ClientOptions{PinnedPublicKeys: []string{"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=", pin}}))
+
+	err := getWithPins(t, server, ClientOptions{PinnedPublicKeys: []string{"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="}})
+	assert.True(t, errors.Is(err, ErrCertificatePinMismatch), "%v", err)
+
+	err = getWithPins(t, server, ClientOptions{pinError: ErrInvalidPins})
+	assert.True(t, errors.Is(err, ErrInvalidPins), "%v", err)
+}
+
+func TestParsePins(t *testing.T) {
+	pin := "47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="
+	pins, err := parsePins("# ECR\n" + pin + "\n\n" + pin + ", " + pin + "\n")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{pin, pin, pin}, pins)
+
+	for _, invalid := range []string{"", "# none", "not-base64", "dGVzdA=="} {
+		_, err = parsePins(invalid)
+		assert.True(t, errors.Is(err, ErrInvalidPins), invalid)
+	}
+}
+
+func TestClientOptionsPinnedPublicKeys(t *testing.T) {
+	pin := "47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="
+	t.Setenv("AWS_ECR_PINNED_PUBLIC_KEYS", pin)
+	options := DefaultClientFactory{}.clientOptions()
+	assert.Equal(t, []string{pin}, options.PinnedPublicKeys)
+	assert.Nil(t, options.pinError)
+
+	pinsFile := filepath.Join(t.TempDir(), "pins")
+	assert.Nil(t, ioutil.WriteFile(pinsFile, []byte("not a pin\n"), 0600))
+	t.Setenv("AWS_ECR_PINNED_PUBLIC_KEYS_FILE", pinsFile)
+	options = DefaultClientFactory{}.clientOptions()
+	assert.True(t, errors.Is(options.pinError, ErrInvalidPins))
+	assert.NotNil(t, options.verifyPeerCertificate(), "invalid pins fail closed")
+}
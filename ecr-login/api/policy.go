@@ -0,0 +1,128 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// ErrInvalidPolicy is returned, wrapped with the reason, when a policy document cannot be read, is not signed by the
+// configured public key, or is malformed. Clients configured with an invalid policy refuse every registry.
+var ErrInvalidPolicy = errors.New("invalid policy document")
+
+// Policy constrains the credentials the helper issues, for centrally governed environments. The zero value
+// imposes no constraint.
+type Policy struct {
+	// AllowedRegistryIDs, when not empty, restricts the registries credentials are retrieved for, on top of
+	// ClientOptions.AllowedRegistryIDs.
+	AllowedRegistryIDs []string
+
+	// MaxCacheTTL, when positive, bounds how long a token is served from the cache after it was requested.
+	// RegistryMaxCacheTTL overrides it for individual registries.
+	MaxCacheTTL         time.Duration
+	RegistryMaxCacheTTL map[string]time.Duration
+}
+
+// signedPolicy is the file format of a policy: the policy document, base64 encoded, and its ed25519 signature.
+type signedPolicy struct {
+	Policy    string `json:"policy"`
+	Signature string `json:"signature"`
+}
+
+// policyDocument is the signed JSON form of a Policy, with durations such as "1h".
+type policyDocument struct {
+	AllowedRegistryIDs  []string          `json:"allowedRegistryIds"`
+	MaxCacheTTL         string            `json:"maxCacheTtl"`
+	RegistryMaxCacheTTL map[string]string `json:"registryMaxCacheTtl"`
+}
+
+// LoadPolicy reads the signed policy at path and verifies it against publicKey before decoding it.
+func LoadPolicy(path string, publicKey ed25519.PublicKey) (*Policy, error) {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("%w: the public key must be %d bytes", ErrInvalidPolicy, ed25519.PublicKeySize)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPolicy, err)
+	}
+	var signed signedPolicy
+	if err := json.Unmarshal(data, &signed); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPolicy, err)
+	}
+	document, err := base64.StdEncoding.DecodeString(signed.Policy)
+	if err != nil {
+		return nil, fmt.Errorf("%w: policy: %v", ErrInvalidPolicy, err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(signed.Signature)
+	if err != nil || !ed25519.Verify(publicKey, document, signature) {
+		return nil, fmt.Errorf("%w: the signature does not match the public key", ErrInvalidPolicy)
+	}
+	return parsePolicy(document)
+}
+
+// parsePolicy decodes a verified policy document.
+func parsePolicy(document []byte) (*Policy, error) {
+	var parsed policyDocument
+	if err := json.Unmarshal(document, &parsed); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPolicy, err)
+	}
+	policy := &Policy{AllowedRegistryIDs: parsed.AllowedRegistryIDs}
+	var err error
+	if parsed.MaxCacheTTL != "" {
+		if policy.MaxCacheTTL, err = time.ParseDuration(parsed.MaxCacheTTL); err != nil {
+			return nil, fmt.Errorf("%w: maxCacheTtl: %v", ErrInvalidPolicy, err)
+		}
+	}
+	for registry, ttl := range parsed.RegistryMaxCacheTTL {
+		if policy.RegistryMaxCacheTTL == nil {
+			policy.RegistryMaxCacheTTL = make(map[string]time.Duration)
+		}
+		if policy.RegistryMaxCacheTTL[registry], err = time.ParseDuration(ttl); err != nil {
+			return nil, fmt.Errorf("%w: registryMaxCacheTtl of %s: %v", ErrInvalidPolicy, registry, err)
+		}
+	}
+	return policy, nil
+}
+
+// allowsRegistry reports whether the policy permits retrieving credentials for registry.
+func (policy *Policy) allowsRegistry(registry string) bool {
+	if policy == nil || len(policy.AllowedRegistryIDs) == 0 {
+		return true
+	}
+	for _, allowed := range policy.AllowedRegistryIDs {
+		if allowed == registry {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsCacheAge reports whether the policy permits serving a token for registry from the cache age after it was
+// requested.
+func (policy *Policy) allowsCacheAge(registry string, age time.Duration) bool {
+	if policy == nil {
+		return true
+	}
+	ttl, ok := policy.RegistryMaxCacheTTL[registry]
+	if !ok {
+		ttl = policy.MaxCacheTTL
+	}
+	return ttl <= 0 || age <= ttl
+}
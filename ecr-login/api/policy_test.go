@@ -0,0 +1,150 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api/mocks"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+const testPolicyDocument = `{"allowedRegistryIds":["0123456789012"],"maxCacheTtl":"1h","registryMaxCacheTtl":{"111111111111":"10m"}}`
+
+// writeSignedPolicy signs document with privateKey and writes it as a policy file, returning its path.
+func writeSignedPolicy(t *testing.T, document string, privateKey ed25519.PrivateKey) string {
+	data, err := json.Marshal(signedPolicy{
+		Policy:    base64.StdEncoding.EncodeToString([]byte(document)),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, []byte(document))),
+	})
+	assert.Nil(t, err)
+	path := filepath.Join(t.TempDir(), "policy.json")
+	assert.Nil(t, ioutil.WriteFile(path, data, 0600))
+	return path
+}
+
+func TestLoadPolicy(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+
+	policy, err := LoadPolicy(writeSignedPolicy(t, testPolicyDocument, privateKey), publicKey)
+	if assert.Nil(t, err) {
+		assert.Equal(t, []string{registryID}, policy.AllowedRegistryIDs)
+		assert.Equal(t, time.Hour, policy.MaxCacheTTL)
+		assert.Equal(t, map[string]time.Duration{otherRegistryID: 10 * time.Minute}, policy.RegistryMaxCacheTTL)
+	}
+}
+
+func TestLoadPolicyTampered(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+
+	path := writeSignedPolicy(t, testPolicyDocument, privateKey)
+	var signed signedPolicy
+	data, _ := ioutil.ReadFile(path)
+	assert.Nil(t, json.Unmarshal(data, &signed))
+	signed.Policy = base64.StdEncoding.EncodeToString([]byte(`{"maxCacheTtl":"1000h"}`))
+	data, _ = json.Marshal(signed)
+	assert.Nil(t, ioutil.WriteFile(path, data, 0600))
+
+	_, err = LoadPolicy(path, publicKey)
+	assert.True(t, errors.Is(err, ErrInvalidPolicy), "%v", err)
+
+	otherPublicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	_, err = LoadPolicy(writeSignedPolicy(t, testPolicyDocument, privateKey), otherPublicKey)
+	assert.True(t, errors.Is(err, ErrInvalidPolicy), "signed by another key: %v", err)
+}
+
+func TestLoadPolicyUnsigned(t *testing.T) {
+	publicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+
+	path := filepath.Join(t.TempDir(), "policy.json")
+	assert.Nil(t, ioutil.WriteFile(path, []byte(testPolicyDocument), 0600))
+	_, err = LoadPolicy(path, publicKey)
+	assert.True(t, errors.Is(err, ErrInvalidPolicy), "%v", err)
+}
+
+func TestPolicyCapsCacheTTL(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecrClient := mock_ecriface.NewMockECRAPI(ctrl)
+	credentialCache := mock_cache.NewMockCredentialsCache(ctrl)
+
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: credentialCache,
+		options:         ClientOptions{AllowCrossAccount: true, Policy: &Policy{MaxCacheTTL: time.Hour}},
+	}
+
+	authorizationToken := base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword))
+	// The token is still valid, but was requested longer ago than the policy allows.
+	credentialCache.EXPECT().GetValid(registryID, gomock.Any()).Return(&cache.AuthEntry{
+		ProxyEndpoint:      proxyEndpointScheme + proxyEndpoint,
+		RequestedAt:        time.Now().Add(-2 * time.Hour),
+		ExpiresAt:          time.Now().Add(10 * time.Hour),
+		AuthorizationToken: authorizationToken,
+	}).Times(2)
+	credentialCache.EXPECT().Set(registryID, gomock.Any())
+	ecrClient.EXPECT().GetAuthorizationToken(gomock.Any()).Return(&ecr.GetAuthorizationTokenOutput{
+		AuthorizationData: []*ecr.AuthorizationData{
+			&ecr.AuthorizationData{
+				ProxyEndpoint:      aws.String(proxyEndpointScheme + proxyEndpoint),
+				ExpiresAt:          aws.Time(time.Now().Add(12 * time.Hour)),
+				AuthorizationToken: aws.String(authorizationToken),
+			},
+		},
+	}, nil)
+
+	assert.False(t, client.IsCached(registryID))
+	creds, err := client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	assert.Nil(t, err)
+	assert.Equal(t, expectedPassword, creds.Password)
+}
+
+func TestPolicyAllowedRegistries(t *testing.T) {
+	options := ClientOptions{Policy: &Policy{AllowedRegistryIDs: []string{registryID}}}
+	assert.Nil(t, options.checkRegistry(registryID))
+	assert.True(t, errors.Is(options.checkRegistry(otherRegistryID), ErrRegistryNotAllowed))
+}
+
+func TestInvalidPolicyFromEnvironmentRefusesRegistries(t *testing.T) {
+	publicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	_, otherPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+
+	t.Setenv("ECR_POLICY_FILE", writeSignedPolicy(t, testPolicyDocument, otherPrivateKey))
+	t.Setenv("ECR_POLICY_PUBLIC_KEY", base64.StdEncoding.EncodeToString(publicKey))
+	options := DefaultClientFactory{}.clientOptions()
+	assert.Nil(t, options.Policy)
+
+	client := &defaultClient{credentialCache: cache.NewNullCredentialsCache(), options: options}
+	_, err = client.GetCredentials(registryID, proxyEndpoint+"/myimage")
+	assert.True(t, errors.Is(err, ErrInvalidPolicy), "%v", err)
+}
@@ -0,0 +1,152 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/private/protocol/jsonrpc"
+	"github.com/aws/aws-sdk-go/private/signer/v4"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache"
+	log "github.com/cihub/seelog"
+)
+
+const (
+	// PublicRegistryHost is the host of the Amazon ECR Public registry.
+	PublicRegistryHost = "public.ecr.aws"
+
+	// PublicRegion is the only region Amazon ECR Public issues authorization tokens in.
+	PublicRegion = "us-east-1"
+
+	ecrPublicServiceName = "ecr-public"
+	ecrPublicEndpoint    = "https://api.ecr-public." + PublicRegion + ".amazonaws.com"
+)
+
+// ErrNoPublicAuthorizationData is returned when Amazon ECR Public answers without an authorization token.
+var ErrNoPublicAuthorizationData = errors.New("no authorization data in the Amazon ECR Public response")
+
+// IsPublicRegistry reports whether serverURL names the Amazon ECR Public registry.
+func IsPublicRegistry(serverURL string) bool {
+	return strings.EqualFold(ParseImage(serverURL).Host, PublicRegistryHost)
+}
+
+// ecrPublicAPI is the part of the Amazon ECR Public API the helper calls. The vendored SDK has no client for the
+// service, so ecrPublicClient implements it with the SDK's JSON RPC protocol.
+type ecrPublicAPI interface {
+	GetAuthorizationToken() (*publicAuthorizationData, error)
+}
+
+type publicAuthorizationData struct {
+	_ struct{} `type:"structure"`
+
+	AuthorizationToken *string    `locationName:"authorizationToken" type:"string"`
+	ExpiresAt          *time.Time `locationName:"expiresAt" type:"timestamp" timestampFormat:"unix"`
+}
+
+type publicGetAuthorizationTokenInput struct {
+	_ struct{} `type:"structure"`
+}
+
+type publicGetAuthorizationTokenOutput struct {
+	_ struct{} `type:"structure"`
+
+	AuthorizationData *publicAuthorizationData `locationName:"authorizationData" type:"structure"`
+}
+
+type ecrPublicClient struct {
+	*client.Client
+}
+
+// newECRPublicClient returns a client for Amazon ECR Public, which is always called in PublicRegion.
+func newECRPublicClient(awsSession *session.Session, cfgs ...*aws.Config) *ecrPublicClient {
+	config := awsSession.ClientConfig(ecrPublicServiceName, cfgs...)
+	endpoint := config.Endpoint
+	if aws.StringValue(config.Config.Endpoint) == "" {
+		endpoint = ecrPublicEndpoint
+	}
+	publicClient := &ecrPublicClient{
+		Client: client.New(
+			*config.Config,
+			metadata.ClientInfo{
+				ServiceName:   ecrPublicServiceName,
+				SigningRegion: PublicRegion,
+				Endpoint:      endpoint,
+				APIVersion:    "2020-10-30",
+				JSONVersion:   "1.1",
+				TargetPrefix:  "SpencerFrontendService",
+			},
+			config.Handlers,
+		),
+	}
+	publicClient.Handlers.Sign.PushBack(v4.Sign)
+	publicClient.Handlers.Build.PushBackNamed(jsonrpc.BuildHandler)
+	publicClient.Handlers.Unmarshal.PushBackNamed(jsonrpc.UnmarshalHandler)
+	publicClient.Handlers.UnmarshalMeta.PushBackNamed(jsonrpc.UnmarshalMetaHandler)
+	publicClient.Handlers.UnmarshalError.PushBackNamed(jsonrpc.UnmarshalErrorHandler)
+	return publicClient
+}
+
+func (c *ecrPublicClient) GetAuthorizationToken() (*publicAuthorizationData, error) {
+	op := &request.Operation{Name: "GetAuthorizationToken", HTTPMethod: "POST", HTTPPath: "/"}
+	output := &publicGetAuthorizationTokenOutput{}
+	req := c.NewRequest(op, &publicGetAuthorizationTokenInput{}, output)
+	if err := req.Send(); err != nil {
+		return nil, err
+	}
+	return output.AuthorizationData, nil
+}
+
+// GetPublicCredentials returns credentials for the Amazon ECR Public registry, for the rare pulls that need to be
+// authenticated, such as to lift the anonymous pull rate limits. The token is retrieved like those of private
+// registries, cached under PublicRegistryHost, so the offline mode, the allowed regions and registries, the hooks and
+// the audit all apply to it.
+func (self *defaultClient) GetPublicCredentials() (*Credentials, error) {
+	return self.GetCredentials(PublicRegistryHost, PublicRegistryHost)
+}
+
+// fetchPublicAuthEntry requests an authorization token from Amazon ECR Public and caches it, falling back to
+// cachedEntry, if any, when the request fails.
+func (self *defaultClient) fetchPublicAuthEntry(cachedEntry *cache.AuthEntry, warn *warnings) (*cache.AuthEntry, error) {
+	if self.ecrPublicClient == nil {
+		return nil, fmt.Errorf("%w for %s", ErrNoPublicAuthorizationData, PublicRegistryHost)
+	}
+
+	log.Debugf("Calling ECR Public GetAuthorizationToken")
+	authData, err := self.ecrPublicClient.GetAuthorizationToken()
+	if err == nil && (authData == nil || authData.AuthorizationToken == nil) {
+		err = ErrNoPublicAuthorizationData
+	}
+	if err != nil {
+		if fallback := self.fallBackToCache(PublicRegistryHost, cachedEntry, err, warn); fallback != nil {
+			return fallback, nil
+		}
+		return nil, err
+	}
+
+	authEntry := cache.AuthEntry{
+		AuthorizationToken: aws.StringValue(authData.AuthorizationToken),
+		RequestedAt:        time.Now(),
+		ExpiresAt:          aws.TimeValue(authData.ExpiresAt),
+		ProxyEndpoint:      proxyEndpointScheme + PublicRegistryHost,
+	}
+	return self.storeAuthEntry(PublicRegistryHost, authEntry, authData.ExpiresAt != nil, warn)
+}
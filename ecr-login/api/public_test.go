@@ -0,0 +1,128 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeECRPublicClient struct {
+	authData *publicAuthorizationData
+	calls    int
+}
+
+func (f *fakeECRPublicClient) GetAuthorizationToken() (*publicAuthorizationData, error) {
+	f.calls++
+	return f.authData, nil
+}
+
+func TestIsPublicRegistry(t *testing.T) {
+	assert.True(t, IsPublicRegistry("public.ecr.aws"))
+	assert.True(t, IsPublicRegistry("https://public.ecr.aws/nginx/nginx:latest"))
+	assert.True(t, IsPublicRegistry("Public.ECR.aws/nginx/nginx"))
+	assert.False(t, IsPublicRegistry(registryID+".dkr.ecr.us-west-2.amazonaws.com/public.ecr.aws"))
+	assert.False(t, IsPublicRegistry("public.ecr.aws.example.com/nginx"))
+}
+
+func TestGetPublicCredentials(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "SECRET")
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_ECR_DISABLE_CACHE", "true")
+
+	var target string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target = r.Header.Get("X-Amz-Target")
+		token := base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword))
+		fmt.Fprintf(w, `{"authorizationData":{"authorizationToken":%q,"expiresAt":%d}}`, token, time.Now().Add(12*time.Hour).Unix())
+	}))
+	defer server.Close()
+
+	client := DefaultClientFactory{Options: ClientOptions{Endpoint: server.URL}}.NewClient(PublicRegion)
+	creds, err := client.GetPublicCredentials()
+	assert.Nil(t, err)
+	if assert.NotNil(t, creds) {
+		assert.Equal(t, expectedUsername, creds.Username)
+		assert.Equal(t, expectedPassword, creds.Password)
+		assert.Equal(t, proxyEndpointScheme+PublicRegistryHost, creds.ProxyEndpoint)
+	}
+	assert.Equal(t, "SpencerFrontendService.GetAuthorizationToken", target)
+}
+
+func TestGetPublicCredentialsCached(t *testing.T) {
+	publicClient := &fakeECRPublicClient{authData: &publicAuthorizationData{
+		AuthorizationToken: aws.String(base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword))),
+		ExpiresAt:          aws.Time(time.Now().Add(12 * time.Hour)),
+	}}
+	client := &defaultClient{
+		credentialCache: cache.NewMemoryCredentialsCache(),
+		ecrPublicClient: publicClient,
+	}
+
+	for i := 0; i < 2; i++ {
+		creds, err := client.GetPublicCredentials()
+		assert.Nil(t, err)
+		if assert.NotNil(t, creds) {
+			assert.Equal(t, expectedPassword, creds.Password)
+		}
+	}
+	assert.Equal(t, 1, publicClient.calls, "the token is cached")
+
+	client = &defaultClient{
+		credentialCache: cache.NewNullCredentialsCache(),
+		ecrPublicClient: &fakeECRPublicClient{authData: &publicAuthorizationData{}},
+	}
+	_, err := client.GetPublicCredentials()
+	assert.True(t, errors.Is(err, ErrNoPublicAuthorizationData))
+}
+
+func TestGetPublicCredentialsGuards(t *testing.T) {
+	publicClient := &fakeECRPublicClient{authData: &publicAuthorizationData{
+		AuthorizationToken: aws.String(base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword))),
+		ExpiresAt:          aws.Time(time.Now().Add(12 * time.Hour)),
+	}}
+
+	client := &defaultClient{
+		credentialCache: cache.NewMemoryCredentialsCache(),
+		ecrPublicClient: publicClient,
+		region:          PublicRegion,
+		options:         ClientOptions{Offline: true},
+	}
+	_, err := client.GetPublicCredentials()
+	assert.True(t, errors.Is(err, ErrOfflineCacheMiss), "%v", err)
+
+	client.options = ClientOptions{AllowedRegions: []string{"us-west-2"}}
+	_, err = client.GetPublicCredentials()
+	assert.True(t, errors.Is(err, ErrRegionNotAllowed), "%v", err)
+	assert.Equal(t, 0, publicClient.calls)
+
+	var fetched []string
+	client.options = ClientOptions{PostFetch: func(registry string, err error) {
+		fetched = append(fetched, registry)
+	}}
+	_, err = client.GetPublicCredentials()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{PublicRegistryHost}, fetched)
+	assert.Equal(t, 1, publicClient.calls)
+}
@@ -0,0 +1,137 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+const (
+	defaultAPIRetries        = 3
+	defaultConnectionRetries = 5
+	defaultConnectionBackoff = 500 * time.Millisecond
+	defaultMaxRetryAfter     = 30 * time.Second
+
+	// retryAfterJitter bounds the random delay added to a Retry-After, so that throttled clients do not all retry
+	// at the same instant.
+	retryAfterJitter = 250 * time.Millisecond
+)
+
+// retryer keeps the SDK's retry behavior for AWS API errors and retries connection-level failures (such as DNS
+// lookups failing right after a laptop wakes from sleep) on a separate, slower schedule.
+// API errors are also retried when classifier, if set, reports them as retryable, and a Retry-After header sent with
+// an error is honored up to maxRetryAfter.
+type retryer struct {
+	client.DefaultRetryer
+	connectionRetries int
+	connectionBackoff time.Duration
+	classifier        func(error) bool
+	maxRetryAfter     time.Duration
+}
+
+func newRetryer(options ClientOptions) *retryer {
+	maxRetryAfter := options.MaxRetryAfter
+	if maxRetryAfter <= 0 {
+		maxRetryAfter = defaultMaxRetryAfter
+	}
+	return &retryer{
+		DefaultRetryer:    client.DefaultRetryer{NumMaxRetries: defaultAPIRetries},
+		connectionRetries: defaultConnectionRetries,
+		connectionBackoff: defaultConnectionBackoff,
+		classifier:        options.RetryClassifier,
+		maxRetryAfter:     maxRetryAfter,
+	}
+}
+
+// MaxRetries is the upper bound the SDK applies to every request. The tighter limit for API errors is enforced in
+// ShouldRetry.
+func (r *retryer) MaxRetries() int {
+	if r.connectionRetries > r.NumMaxRetries {
+		return r.connectionRetries
+	}
+	return r.NumMaxRetries
+}
+
+func (r *retryer) ShouldRetry(req *request.Request) bool {
+	if isConnectionError(req.Error) {
+		return req.RetryCount < r.connectionRetries
+	}
+	if req.RetryCount >= r.NumMaxRetries {
+		return false
+	}
+	return r.DefaultRetryer.ShouldRetry(req) || (r.classifier != nil && r.classifier(req.Error))
+}
+
+func (r *retryer) RetryRules(req *request.Request) time.Duration {
+	if isConnectionError(req.Error) {
+		return time.Duration(req.RetryCount+1) * r.connectionBackoff
+	}
+	if req.HTTPResponse != nil {
+		if delay, ok := parseRetryAfter(req.HTTPResponse.Header.Get("Retry-After"), time.Now()); ok {
+			delay += time.Duration(rand.Int63n(int64(retryAfterJitter)))
+			if delay > r.maxRetryAfter {
+				delay = r.maxRetryAfter
+			}
+			return delay
+		}
+	}
+	return r.DefaultRetryer.RetryRules(req)
+}
+
+// parseRetryAfter returns the delay requested by a Retry-After header, given either in seconds or as an HTTP date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := date.Sub(now); delay > 0 {
+			return delay, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// isConnectionError reports whether err was caused by failing to reach the endpoint at all, as opposed to an error
+// returned by the service.
+func isConnectionError(err error) bool {
+	if awsErr, ok := err.(awserr.Error); ok {
+		err = awsErr.OrigErr()
+	}
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+	switch netErr := err.(type) {
+	case *net.OpError:
+		return true
+	case *net.DNSError:
+		return netErr.IsTemporary || netErr.IsTimeout
+	}
+	return false
+}
@@ -0,0 +1,206 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/stretchr/testify/assert"
+)
+
+const testAuthorizationResponse = `{"authorizationData":[{"authorizationToken":"dXNlcm5hbWU6cGFzc3dvcmQ=","expiresAt":1.4E9,"proxyEndpoint":"https://proxy"}]}`
+
+// roundTripFunc stubs the HTTP transport used by the ECR client.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func okResponse(body string) *http.Response {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte(body))),
+	}
+}
+
+func newTestECRClient(transport http.RoundTripper, sleepDelay func(time.Duration)) *ecr.ECR {
+	return newTestECRClientWithOptions(transport, sleepDelay, ClientOptions{})
+}
+
+func newTestECRClientWithOptions(transport http.RoundTripper, sleepDelay func(time.Duration), options ClientOptions) *ecr.ECR {
+	return ecr.New(session.New(), &aws.Config{
+		Region:      aws.String("us-west-2"),
+		Credentials: credentials.NewStaticCredentials("AKID", "SECRET", ""),
+		HTTPClient:  &http.Client{Transport: transport},
+		Retryer:     newRetryer(options),
+		SleepDelay:  sleepDelay,
+	})
+}
+
+func TestRetryerRetriesTransientDialFailure(t *testing.T) {
+	attempts := 0
+	transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		if attempts == 1 {
+			return nil, &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connect: network is unreachable")}
+		}
+		return okResponse(testAuthorizationResponse), nil
+	})
+	var delays []time.Duration
+	ecrClient := newTestECRClient(transport, func(delay time.Duration) { delays = append(delays, delay) })
+
+	output, err := ecrClient.GetAuthorizationToken(&ecr.GetAuthorizationTokenInput{})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, attempts)
+	assert.Equal(t, []time.Duration{defaultConnectionBackoff}, delays)
+	assert.Equal(t, "https://proxy", aws.StringValue(output.AuthorizationData[0].ProxyEndpoint))
+}
+
+func TestRetryerConnectionRetriesExhausted(t *testing.T) {
+	attempts := 0
+	transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "api.ecr.us-west-2.amazonaws.com"}}
+	})
+	ecrClient := newTestECRClient(transport, func(time.Duration) {})
+
+	_, err := ecrClient.GetAuthorizationToken(&ecr.GetAuthorizationTokenInput{})
+	assert.NotNil(t, err)
+	assert.Equal(t, defaultConnectionRetries+1, attempts)
+}
+
+func TestRetryerAPIErrorsKeepDefaultRetries(t *testing.T) {
+	attempts := 0
+	transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		response := okResponse(`{"__type":"ServerException","message":"internal error"}`)
+		response.StatusCode = http.StatusInternalServerError
+		return response, nil
+	})
+	ecrClient := newTestECRClient(transport, func(time.Duration) {})
+
+	_, err := ecrClient.GetAuthorizationToken(&ecr.GetAuthorizationTokenInput{})
+	assert.NotNil(t, err)
+	assert.Equal(t, defaultAPIRetries+1, attempts)
+}
+
+func TestRetryerClassifierRetriesTerminalError(t *testing.T) {
+	attempts := 0
+	transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		if attempts == 1 {
+			response := okResponse(`{"__type":"InvalidParameterException","message":"proxy quirk"}`)
+			response.StatusCode = http.StatusBadRequest
+			return response, nil
+		}
+		return okResponse(testAuthorizationResponse), nil
+	})
+	classifier := func(err error) bool {
+		return strings.Contains(err.Error(), "proxy quirk")
+	}
+
+	_, err := newTestECRClient(transport, func(time.Duration) {}).GetAuthorizationToken(&ecr.GetAuthorizationTokenInput{})
+	assert.NotNil(t, err, "the error is terminal without a classifier")
+
+	attempts = 0
+	ecrClient := newTestECRClientWithOptions(transport, func(time.Duration) {}, ClientOptions{RetryClassifier: classifier})
+	output, err := ecrClient.GetAuthorizationToken(&ecr.GetAuthorizationTokenInput{})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, attempts)
+	assert.Equal(t, "https://proxy", aws.StringValue(output.AuthorizationData[0].ProxyEndpoint))
+}
+
+// throttledResponse is a ThrottlingException asking to retry after retryAfter.
+func throttledResponse(retryAfter string) *http.Response {
+	response := okResponse(`{"__type":"ThrottlingException","message":"Rate exceeded"}`)
+	response.StatusCode = http.StatusBadRequest
+	response.Header.Set("Retry-After", retryAfter)
+	return response
+}
+
+func TestRetryerHonorsRetryAfter(t *testing.T) {
+	attempts := 0
+	transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		if attempts == 1 {
+			return throttledResponse("3"), nil
+		}
+		return okResponse(testAuthorizationResponse), nil
+	})
+	var delays []time.Duration
+	ecrClient := newTestECRClient(transport, func(delay time.Duration) { delays = append(delays, delay) })
+
+	_, err := ecrClient.GetAuthorizationToken(&ecr.GetAuthorizationTokenInput{})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, attempts)
+	if assert.Len(t, delays, 1) {
+		assert.True(t, delays[0] >= 3*time.Second && delays[0] < 3*time.Second+retryAfterJitter, "delay %s", delays[0])
+	}
+}
+
+func TestRetryerCapsRetryAfter(t *testing.T) {
+	attempts := 0
+	transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		if attempts == 1 {
+			return throttledResponse("3600"), nil
+		}
+		return okResponse(testAuthorizationResponse), nil
+	})
+	var delays []time.Duration
+	ecrClient := newTestECRClientWithOptions(transport, func(delay time.Duration) { delays = append(delays, delay) },
+		ClientOptions{MaxRetryAfter: 5 * time.Second})
+
+	_, err := ecrClient.GetAuthorizationToken(&ecr.GetAuthorizationTokenInput{})
+	assert.Nil(t, err)
+	assert.Equal(t, []time.Duration{5 * time.Second}, delays)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2016, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	delay, ok := parseRetryAfter("2", now)
+	assert.True(t, ok)
+	assert.Equal(t, 2*time.Second, delay)
+
+	delay, ok = parseRetryAfter("Fri, 01 Jul 2016 12:00:10 GMT", now)
+	assert.True(t, ok)
+	assert.Equal(t, 10*time.Second, delay)
+
+	for _, value := range []string{"", "-1", "soon"} {
+		_, ok = parseRetryAfter(value, now)
+		assert.False(t, ok, value)
+	}
+}
+
+func TestIsConnectionError(t *testing.T) {
+	assert.True(t, isConnectionError(&net.OpError{Op: "dial", Err: errors.New("refused")}))
+	assert.True(t, isConnectionError(&net.DNSError{Err: "timeout", IsTemporary: true}))
+	assert.False(t, isConnectionError(&net.DNSError{Err: "no such host"}))
+	assert.False(t, isConnectionError(errors.New("test error")))
+	assert.False(t, isConnectionError(nil))
+}
@@ -0,0 +1,73 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"sync"
+	"time"
+
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache"
+	log "github.com/cihub/seelog"
+)
+
+// accountCredentialsCache keeps the entries of a cache shared by several principals, such as the Redis cache, under
+// the account of the credentials, so that a token is only served to the principals of the account it was fetched
+// for. The account is resolved on first use, and the cache is bypassed while it cannot be determined.
+type accountCredentialsCache struct {
+	newCache func(account string) cache.CredentialsCache
+	account  func() (string, error)
+
+	lock  sync.Mutex
+	cache cache.CredentialsCache
+}
+
+func newAccountCredentialsCache(newCache func(account string) cache.CredentialsCache, account func() (string, error)) cache.CredentialsCache {
+	return &accountCredentialsCache{newCache: newCache, account: account}
+}
+
+// accountCache returns the cache of the account of the credentials, or a null cache when the account cannot be
+// determined.
+func (a *accountCredentialsCache) accountCache() cache.CredentialsCache {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.cache == nil {
+		account, err := a.account()
+		if err != nil {
+			log.Infof("Not using the shared cache, cannot determine the account of the credentials: %v", err)
+			return cache.NewNullCredentialsCache()
+		}
+		a.cache = a.newCache(account)
+	}
+	return a.cache
+}
+
+func (a *accountCredentialsCache) Get(registry string) *cache.AuthEntry {
+	return a.accountCache().Get(registry)
+}
+
+func (a *accountCredentialsCache) GetValid(registry string, now time.Time) *cache.AuthEntry {
+	return a.accountCache().GetValid(registry, now)
+}
+
+func (a *accountCredentialsCache) Set(registry string, entry *cache.AuthEntry) {
+	a.accountCache().Set(registry, entry)
+}
+
+func (a *accountCredentialsCache) Delete(registry string) {
+	a.accountCache().Delete(registry)
+}
+
+func (a *accountCredentialsCache) Clear() {
+	a.accountCache().Clear()
+}
@@ -0,0 +1,198 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/mitchellh/go-homedir"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRedis serves the GET, SET and DEL commands of the Redis cache from memory.
+type fakeRedis struct {
+	lock   sync.Mutex
+	values map[string]string
+}
+
+func newFakeRedis(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	server := &fakeRedis{values: make(map[string]string)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.handle(conn)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func (s *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	line, _ := reader.ReadString('\n')
+	count, _ := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	var args []string
+	for i := 0; i < count; i++ {
+		reader.ReadString('\n')
+		arg, _ := reader.ReadString('\n')
+		args = append(args, strings.TrimSuffix(arg, "\r\n"))
+	}
+	if len(args) < 2 {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	switch args[0] {
+	case "GET":
+		if value, ok := s.values[args[1]]; ok {
+			fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(value), value)
+		} else {
+			fmt.Fprint(conn, "$-1\r\n")
+		}
+	case "SET":
+		s.values[args[1]] = args[2]
+		fmt.Fprint(conn, "+OK\r\n")
+	case "DEL":
+		delete(s.values, args[1])
+		fmt.Fprint(conn, ":1\r\n")
+	default:
+		fmt.Fprint(conn, "-ERR unknown command\r\n")
+	}
+}
+
+// setupRedisCache points the caches built by the factory at a fake Redis server.
+func setupRedisCache(t *testing.T) {
+	t.Setenv("AWS_ECR_DISABLE_CACHE", "")
+	t.Setenv("AWS_ECR_CACHE_ENCRYPTION_KEY", "")
+	t.Setenv("AWS_ECR_CACHE_KEEP_LONGEST_EXPIRY", "")
+	t.Setenv("AWS_ECR_CACHE_REDIS_ADDRESS", newFakeRedis(t))
+	t.Setenv("HOME", t.TempDir())
+	homedir.DisableCache = true
+	t.Cleanup(func() { homedir.DisableCache = false })
+}
+
+// redisCacheClient returns a client of the access key accessKeyID, caching tokens in the Redis cache.
+func redisCacheClient(ecrClient *mock_ecriface.MockECRAPI, accessKeyID string, options ClientOptions) *defaultClient {
+	factory := DefaultClientFactory{}
+	awsSession := session.New(&aws.Config{Credentials: credentials.NewStaticCredentials(accessKeyID, "SECRET", "")})
+	client := &defaultClient{ecrClient: ecrClient, options: options, region: "us-west-2"}
+	client.credentialCache = factory.buildCredentialsCache(awsSession, client.region, options, client.ownAccount)
+	client.identityCache = factory.buildIdentityCache(awsSession, client.region, options)
+	return client
+}
+
+func TestRedisCacheSeparatesAccounts(t *testing.T) {
+	setupRedisCache(t)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	image := registryHost(registryID) + "/myimage"
+
+	// The first principal, of the account of the registry, caches its token.
+	owner := mock_ecriface.NewMockECRAPI(ctrl)
+	expectOwnAccountLookup(owner, registryID)
+	expectRegistryToken(owner, registryID)
+	_, err := redisCacheClient(owner, "AKIDOWNER", ClientOptions{}).GetCredentials(registryID, image)
+	assert.Nil(t, err)
+
+	// A principal of another account, allowed to pull across accounts, must fetch its own token.
+	other := mock_ecriface.NewMockECRAPI(ctrl)
+	expectOwnAccountLookup(other, otherRegistryID)
+	expectRegistryToken(other, registryID)
+	_, err = redisCacheClient(other, "AKIDOTHER", ClientOptions{AllowCrossAccount: true}).GetCredentials(registryID, image)
+	assert.Nil(t, err)
+
+	// Another principal of the account is served the cached token.
+	peer := mock_ecriface.NewMockECRAPI(ctrl)
+	expectOwnAccountLookup(peer, registryID)
+	creds, err := redisCacheClient(peer, "AKIDPEER", ClientOptions{}).GetCredentials(registryID, image)
+	assert.Nil(t, err)
+	assert.Equal(t, expectedPassword, creds.Password)
+
+	// The account of a principal is resolved once, whatever the process.
+	_, err = redisCacheClient(peer, "AKIDPEER", ClientOptions{}).GetCredentials(registryID, image)
+	assert.Nil(t, err)
+}
+
+func TestRedisCacheHitChecksCrossAccount(t *testing.T) {
+	setupRedisCache(t)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	image := registryHost(otherRegistryID) + "/myimage"
+
+	// A principal allowed to pull across accounts caches a token of another account.
+	allowed := mock_ecriface.NewMockECRAPI(ctrl)
+	expectOwnAccountLookup(allowed, registryID)
+	expectRegistryToken(allowed, otherRegistryID)
+	_, err := redisCacheClient(allowed, "AKIDALLOWED", ClientOptions{AllowCrossAccount: true}).GetCredentials(otherRegistryID, image)
+	assert.Nil(t, err)
+
+	// A principal of the same account that is not must not be served it from the cache.
+	denied := mock_ecriface.NewMockECRAPI(ctrl)
+	expectOwnAccountLookup(denied, registryID)
+	creds, err := redisCacheClient(denied, "AKIDDENIED", ClientOptions{}).GetCredentials(otherRegistryID, image)
+	assert.True(t, errors.Is(err, ErrCrossAccountNotAllowed), "%v", err)
+	assert.Nil(t, creds)
+}
+
+func TestRedisCachePerPrincipal(t *testing.T) {
+	setupRedisCache(t)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	image := registryHost(registryID) + "/myimage"
+	options := ClientOptions{CachePerPrincipal: true}
+
+	first := mock_ecriface.NewMockECRAPI(ctrl)
+	expectOwnAccountLookup(first, registryID)
+	expectRegistryToken(first, registryID)
+	_, err := redisCacheClient(first, "AKIDFIRST", options).GetCredentials(registryID, image)
+	assert.Nil(t, err)
+
+	// A principal of the same account fetches its own token rather than being served the first one.
+	second := mock_ecriface.NewMockECRAPI(ctrl)
+	expectOwnAccountLookup(second, registryID)
+	expectRegistryToken(second, registryID)
+	_, err = redisCacheClient(second, "AKIDSECOND", options).GetCredentials(registryID, image)
+	assert.Nil(t, err)
+
+	// The first principal is still served its own token.
+	creds, err := redisCacheClient(first, "AKIDFIRST", options).GetCredentials(registryID, image)
+	assert.Nil(t, err)
+	assert.Equal(t, expectedPassword, creds.Password)
+}
+
+func TestClientOptionsCachePerPrincipal(t *testing.T) {
+	t.Setenv("AWS_ECR_CACHE_PER_PRINCIPAL", "")
+	assert.False(t, DefaultClientFactory{}.clientOptions().CachePerPrincipal)
+	t.Setenv("AWS_ECR_CACHE_PER_PRINCIPAL", "true")
+	assert.True(t, DefaultClientFactory{}.clientOptions().CachePerPrincipal)
+}
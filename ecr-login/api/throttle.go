@@ -0,0 +1,103 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// ThrottleState describes whether ECR is throttling a client, so that schedulers can hold back new work instead of
+// adding to the pressure on the ECR quota. Throttled is set from the first throttled request until a request
+// succeeds. RetryAfter is how long the client is still backing off, and zero once the backoff has elapsed.
+type ThrottleState struct {
+	Throttled  bool          `json:"throttled"`
+	RetryAfter time.Duration `json:"retryAfter"`
+}
+
+// throttleTracker records the throttling observed by the retry loop of the ECR clients it is attached to.
+type throttleTracker struct {
+	lock      sync.Mutex
+	throttled bool
+	until     time.Time
+}
+
+// attach makes the tracker observe the requests sent with handlers: throttled requests about to be retried, or
+// failing, and successful responses. The backoff of a retried request is drawn, with jitter, by the core
+// AfterRetry handler right before it sleeps, so it is read from the sleep itself rather than drawn again.
+func (t *throttleTracker) attach(handlers *request.Handlers) {
+	handlers.AfterRetry.PushFront(func(req *request.Request) {
+		if !req.IsErrorThrottle() {
+			return
+		}
+		sleep := req.Config.SleepDelay
+		req.Config.SleepDelay = func(delay time.Duration) {
+			req.Config.SleepDelay = sleep
+			t.observeThrottle(delay)
+			sleep(delay)
+		}
+	})
+	handlers.AfterRetry.PushBack(func(req *request.Request) {
+		// The error is only left set on the final attempt, which is not retried.
+		if req.Error != nil && req.IsErrorThrottle() {
+			t.observeThrottle(0)
+		}
+	})
+	handlers.Unmarshal.PushBack(func(req *request.Request) {
+		if req.Error == nil {
+			t.observeSuccess()
+		}
+	})
+}
+
+// observeThrottle records a throttled request, retried after delay.
+func (t *throttleTracker) observeThrottle(delay time.Duration) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.throttled = true
+	if until := time.Now().Add(delay); until.After(t.until) {
+		t.until = until
+	}
+}
+
+// observeSuccess records a successful request, which ends the throttling.
+func (t *throttleTracker) observeSuccess() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.throttled = false
+	t.until = time.Time{}
+}
+
+func (t *throttleTracker) state() ThrottleState {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if !t.throttled {
+		return ThrottleState{}
+	}
+	state := ThrottleState{Throttled: true}
+	if remaining := time.Until(t.until); remaining > 0 {
+		state.RetryAfter = remaining
+	}
+	return state
+}
+
+// ThrottleState reports whether ECR is currently throttling the client.
+func (self *defaultClient) ThrottleState() ThrottleState {
+	if self.throttle == nil {
+		return ThrottleState{}
+	}
+	return self.throttle.state()
+}
@@ -0,0 +1,85 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThrottleState(t *testing.T) {
+	throttling := true
+	transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if throttling {
+			return throttledResponse("30"), nil
+		}
+		return okResponse(testAuthorizationResponse), nil
+	})
+	var slept []time.Duration
+	ecrClient := newTestECRClient(transport, func(delay time.Duration) { slept = append(slept, delay) })
+	throttle := &throttleTracker{}
+	throttle.attach(&ecrClient.Handlers)
+	client := &defaultClient{ecrClient: ecrClient, throttle: throttle}
+	assert.Equal(t, ThrottleState{}, client.ThrottleState())
+
+	_, err := ecrClient.GetAuthorizationToken(&ecr.GetAuthorizationTokenInput{})
+	assert.NotNil(t, err)
+	state := client.ThrottleState()
+	assert.True(t, state.Throttled)
+	// RetryAfter is the longest backoff actually slept, not one drawn again by the tracker.
+	if assert.NotEmpty(t, slept) {
+		longest := slept[0]
+		for _, delay := range slept {
+			if delay > longest {
+				longest = delay
+			}
+		}
+		assert.True(t, state.RetryAfter > longest-time.Second && state.RetryAfter <= longest, "retry after %v, slept %v", state.RetryAfter, slept)
+	}
+
+	throttling = false
+	_, err = ecrClient.GetAuthorizationToken(&ecr.GetAuthorizationTokenInput{})
+	assert.Nil(t, err)
+	assert.Equal(t, ThrottleState{}, client.ThrottleState(), "a success clears the throttling")
+}
+
+func TestThrottleStateFinalAttempt(t *testing.T) {
+	transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return throttledResponse("30"), nil
+	})
+	ecrClient := newTestECRClient(transport, func(time.Duration) {
+		t.Fatal("no retry is made")
+	})
+	ecrClient.Retryer = client.DefaultRetryer{NumMaxRetries: 0}
+	throttle := &throttleTracker{}
+	throttle.attach(&ecrClient.Handlers)
+
+	// A throttled attempt that is not retried marks the client throttled, without a backoff.
+	_, err := ecrClient.GetAuthorizationToken(&ecr.GetAuthorizationTokenInput{})
+	assert.NotNil(t, err)
+	assert.Equal(t, ThrottleState{Throttled: true}, throttle.state())
+}
+
+func TestThrottleStateElapsedBackoff(t *testing.T) {
+	throttle := &throttleTracker{}
+	throttle.observeThrottle(-time.Second)
+	assert.Equal(t, ThrottleState{Throttled: true}, throttle.state())
+
+	assert.Equal(t, ThrottleState{}, (&defaultClient{}).ThrottleState())
+}
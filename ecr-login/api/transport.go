@@ -0,0 +1,144 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/cihub/seelog"
+)
+
+type dialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// minAllowedTLSVersion is the default and lowest allowed MinTLSVersion.
+const minAllowedTLSVersion = tls.VersionTLS12
+
+// ErrInvalidTLSVersion is returned by every connection to ECR when MinTLSVersion is below TLS 1.2, or
+// AWS_ECR_MIN_TLS_VERSION is invalid.
+var ErrInvalidTLSVersion = errors.New("ecr: invalid minimum TLS version")
+
+var defaultDialer = &net.Dialer{
+	Timeout:   30 * time.Second,
+	KeepAlive: 30 * time.Second,
+}
+
+// httpClient returns the HTTP client for ECR requests, which is the net/http default transport with the options
+// applied.
+func (options ClientOptions) httpClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	dialer := options.dialer()
+	if options.DialTimeout > 0 {
+		transport.DialContext = dialer.DialContext
+	}
+	switch options.Network {
+	case "":
+	case "tcp4", "tcp6":
+		transport.DialContext = dialNetwork(options.Network, dialer.DialContext)
+	default:
+		log.Warnf("Ignoring unsupported network %q, expected tcp4 or tcp6", options.Network)
+	}
+	if options.TLSHandshakeTimeout > 0 {
+		transport.TLSHandshakeTimeout = options.TLSHandshakeTimeout
+	}
+	transport.TLSClientConfig = options.tlsConfig()
+
+	if options.MaxIdleConns > 0 {
+		transport.MaxIdleConns = options.MaxIdleConns
+	}
+	if options.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = options.MaxIdleConnsPerHost
+	}
+	if options.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = options.IdleConnTimeout
+	}
+
+	return &http.Client{Transport: transport}
+}
+
+// tlsConfig returns the TLS configuration of connections to ECR, enforcing MinTLSVersion and PinnedPublicKeys. Every
+// connection is refused when MinTLSVersion is invalid.
+func (options ClientOptions) tlsConfig() *tls.Config {
+	version, err := options.minTLSVersion()
+	verify := options.verifyPeerCertificate()
+	if err != nil {
+		log.Errorf("Refusing every connection to ECR: %v", err)
+		verify = func([][]byte, [][]*x509.Certificate) error {
+			return err
+		}
+	}
+	return &tls.Config{
+		MinVersion:            version,
+		VerifyPeerCertificate: verify,
+	}
+}
+
+// minTLSVersion returns MinTLSVersion, or minAllowedTLSVersion when it is unset. It fails with ErrInvalidTLSVersion
+// when MinTLSVersion is below that floor or AWS_ECR_MIN_TLS_VERSION is invalid.
+func (options ClientOptions) minTLSVersion() (uint16, error) {
+	if options.tlsVersionError != nil {
+		return minAllowedTLSVersion, options.tlsVersionError
+	}
+	if options.MinTLSVersion == 0 {
+		return minAllowedTLSVersion, nil
+	}
+	if options.MinTLSVersion < minAllowedTLSVersion {
+		return minAllowedTLSVersion, fmt.Errorf("%w: %s is below the allowed %s", ErrInvalidTLSVersion,
+			tls.VersionName(options.MinTLSVersion), tls.VersionName(minAllowedTLSVersion))
+	}
+	return options.MinTLSVersion, nil
+}
+
+// parseTLSVersion parses a TLS version such as 1.2, refusing versions below minAllowedTLSVersion.
+func parseTLSVersion(version string) (uint16, error) {
+	versions := map[string]uint16{
+		"1.0": tls.VersionTLS10,
+		"1.1": tls.VersionTLS11,
+		"1.2": tls.VersionTLS12,
+		"1.3": tls.VersionTLS13,
+	}
+	parsed, ok := versions[strings.TrimPrefix(strings.ToUpper(version), "TLS")]
+	if !ok {
+		return 0, fmt.Errorf("%w: unknown version %q, expected 1.2 or 1.3", ErrInvalidTLSVersion, version)
+	}
+	if parsed < minAllowedTLSVersion {
+		return 0, fmt.Errorf("%w: %s is below the allowed %s", ErrInvalidTLSVersion, tls.VersionName(parsed),
+			tls.VersionName(minAllowedTLSVersion))
+	}
+	return parsed, nil
+}
+
+// dialer returns the dialer for connections to ECR, which is defaultDialer with DialTimeout applied.
+func (options ClientOptions) dialer() *net.Dialer {
+	dialer := *defaultDialer
+	if options.DialTimeout > 0 {
+		dialer.Timeout = options.DialTimeout
+	}
+	return &dialer
+}
+
+// dialNetwork returns a dial function that connects with dial over network, whatever network the transport asks for.
+func dialNetwork(network string, dial dialFunc) dialFunc {
+	return func(ctx context.Context, _, address string) (net.Conn, error) {
+		return dial(ctx, network, address)
+	}
+}
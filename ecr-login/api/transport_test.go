@@ -0,0 +1,162 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDialNetwork(t *testing.T) {
+	for _, network := range []string{"tcp4", "tcp6"} {
+		var dialedNetwork, dialedAddress string
+		dial := dialNetwork(network, func(ctx context.Context, network, address string) (net.Conn, error) {
+			dialedNetwork = network
+			dialedAddress = address
+			return nil, errors.New("test error")
+		})
+
+		_, err := dial(context.Background(), "tcp", "api.ecr.us-west-2.amazonaws.com:443")
+		assert.NotNil(t, err)
+		assert.Equal(t, network, dialedNetwork)
+		assert.Equal(t, "api.ecr.us-west-2.amazonaws.com:443", dialedAddress)
+	}
+}
+
+func TestHTTPClientNetwork(t *testing.T) {
+	defaultDial := http.DefaultTransport.(*http.Transport).DialContext
+	transport := ClientOptions{Network: "udp"}.httpClient().Transport.(*http.Transport)
+	assert.Equal(t, reflect.ValueOf(defaultDial).Pointer(), reflect.ValueOf(transport.DialContext).Pointer())
+
+	httpClient := ClientOptions{Network: "tcp4"}.httpClient()
+	if assert.NotNil(t, httpClient) {
+		assert.NotNil(t, httpClient.Transport.(*http.Transport).DialContext)
+	}
+}
+
+func TestHTTPClientMinTLSVersion(t *testing.T) {
+	tlsConfig := ClientOptions{}.httpClient().Transport.(*http.Transport).TLSClientConfig
+	if assert.NotNil(t, tlsConfig) {
+		assert.Equal(t, uint16(tls.VersionTLS12), tlsConfig.MinVersion)
+		assert.Nil(t, tlsConfig.VerifyPeerCertificate)
+	}
+
+	tlsConfig = ClientOptions{MinTLSVersion: tls.VersionTLS13}.httpClient().Transport.(*http.Transport).TLSClientConfig
+	assert.Equal(t, uint16(tls.VersionTLS13), tlsConfig.MinVersion)
+
+	tlsConfig = ClientOptions{MinTLSVersion: tls.VersionTLS10}.httpClient().Transport.(*http.Transport).TLSClientConfig
+	assert.Equal(t, uint16(tls.VersionTLS12), tlsConfig.MinVersion)
+	if assert.NotNil(t, tlsConfig.VerifyPeerCertificate) {
+		err := tlsConfig.VerifyPeerCertificate(nil, nil)
+		assert.True(t, errors.Is(err, ErrInvalidTLSVersion), "versions below the floor are refused: %v", err)
+	}
+}
+
+func TestHTTPClientInvalidMinTLSVersion(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	assert.Nil(t, getWithPins(t, server, ClientOptions{MinTLSVersion: tls.VersionTLS12}))
+
+	err := getWithPins(t, server, ClientOptions{MinTLSVersion: tls.VersionTLS11})
+	assert.True(t, errors.Is(err, ErrInvalidTLSVersion), "%v", err)
+
+	pin := publicKeyPin(server.Certificate())
+	err = getWithPins(t, server, ClientOptions{MinTLSVersion: tls.VersionTLS10, PinnedPublicKeys: []string{pin}})
+	assert.True(t, errors.Is(err, ErrInvalidTLSVersion), "a matching pin does not accept the connection: %v", err)
+}
+
+func TestParseTLSVersion(t *testing.T) {
+	version, err := parseTLSVersion("1.3")
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS13), version)
+
+	version, err = parseTLSVersion("TLS1.2")
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS12), version)
+
+	for _, invalid := range []string{"1.0", "1.1", "2", ""} {
+		_, err = parseTLSVersion(invalid)
+		assert.True(t, errors.Is(err, ErrInvalidTLSVersion), invalid)
+	}
+}
+
+func TestClientOptionsMinTLSVersion(t *testing.T) {
+	t.Setenv("AWS_ECR_MIN_TLS_VERSION", "1.3")
+	options := DefaultClientFactory{}.clientOptions()
+	assert.Equal(t, uint16(tls.VersionTLS13), options.MinTLSVersion)
+	assert.Nil(t, options.tlsVersionError)
+
+	for _, invalid := range []string{"1.1", "TLS9"} {
+		t.Setenv("AWS_ECR_MIN_TLS_VERSION", invalid)
+		options = DefaultClientFactory{Options: ClientOptions{MinTLSVersion: tls.VersionTLS13}}.clientOptions()
+		assert.True(t, errors.Is(options.tlsVersionError, ErrInvalidTLSVersion), invalid)
+		_, err := options.minTLSVersion()
+		assert.True(t, errors.Is(err, ErrInvalidTLSVersion), "invalid versions fail closed: %s", invalid)
+	}
+}
+
+func TestHTTPClientConnectionPool(t *testing.T) {
+	httpClient := ClientOptions{
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 32,
+		IdleConnTimeout:     90 * time.Second,
+	}.httpClient()
+	if assert.NotNil(t, httpClient) {
+		transport := httpClient.Transport.(*http.Transport)
+		assert.Equal(t, 100, transport.MaxIdleConns)
+		assert.Equal(t, 32, transport.MaxIdleConnsPerHost)
+		assert.Equal(t, 90*time.Second, transport.IdleConnTimeout)
+	}
+
+	httpClient = ClientOptions{Network: "tcp6", MaxIdleConnsPerHost: 8}.httpClient()
+	if assert.NotNil(t, httpClient) {
+		transport := httpClient.Transport.(*http.Transport)
+		assert.Equal(t, 8, transport.MaxIdleConnsPerHost)
+		assert.NotNil(t, transport.DialContext)
+	}
+}
+
+func TestHTTPClientConnectionTimeouts(t *testing.T) {
+	assert.Equal(t, defaultDialer.Timeout, ClientOptions{}.dialer().Timeout)
+
+	options := ClientOptions{DialTimeout: 2 * time.Second, TLSHandshakeTimeout: 3 * time.Second}
+	assert.Equal(t, 2*time.Second, options.dialer().Timeout)
+	assert.Equal(t, defaultDialer.KeepAlive, options.dialer().KeepAlive)
+	httpClient := options.httpClient()
+	if assert.NotNil(t, httpClient) {
+		transport := httpClient.Transport.(*http.Transport)
+		assert.Equal(t, 3*time.Second, transport.TLSHandshakeTimeout)
+		assert.NotNil(t, transport.DialContext)
+		assert.Equal(t, time.Duration(0), httpClient.Timeout, "responses are not bounded by the connection timeouts")
+	}
+	assert.Equal(t, 30*time.Second, defaultDialer.Timeout, "the default dialer is left untouched")
+}
+
+func TestClientOptionsConnectionTimeouts(t *testing.T) {
+	t.Setenv("AWS_ECR_DIAL_TIMEOUT", "2s")
+	t.Setenv("AWS_ECR_TLS_HANDSHAKE_TIMEOUT", "soon")
+	options := DefaultClientFactory{Options: ClientOptions{TLSHandshakeTimeout: time.Second}}.clientOptions()
+	assert.Equal(t, 2*time.Second, options.DialTimeout)
+	assert.Equal(t, time.Second, options.TLSHandshakeTimeout)
+}
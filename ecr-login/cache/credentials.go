@@ -15,9 +15,15 @@ package cache
 
 import "time"
 
+// CredentialsCache stores authorization tokens by registry. Implementations other than the ones in this package,
+// such as the Redis cache in the redis sub-package, can be plugged in wherever a CredentialsCache is accepted.
 type CredentialsCache interface {
 	Get(registry string) *AuthEntry
+	// GetValid returns the entry for registry if it is valid at now, or nil. The lookup and the validity check are
+	// made at once, so that the entry returned cannot be replaced in between.
+	GetValid(registry string, now time.Time) *AuthEntry
 	Set(registry string, entry *AuthEntry)
+	Delete(registry string)
 	Clear()
 }
 
@@ -31,7 +37,20 @@ type AuthEntry struct {
 // Checks if AuthEntry is still valid at testTime. AuthEntries expire at 1/2 of their original
 // requested window.
 func (authEntry *AuthEntry) IsValid(testTime time.Time) bool {
+	return testTime.Before(authEntry.RefreshTime())
+}
+
+// RefreshTime is the time after which the entry is no longer considered valid. Tokens are refreshed once half of
+// their validity window has passed, leaving a safety margin before they actually expire.
+func (authEntry *AuthEntry) RefreshTime() time.Time {
 	validWindow := authEntry.ExpiresAt.Sub(authEntry.RequestedAt)
-	refreshTime := authEntry.ExpiresAt.Add(-1 * validWindow / time.Duration(2))
-	return testTime.Before(refreshTime)
+	return authEntry.ExpiresAt.Add(-1 * validWindow / time.Duration(2))
+}
+
+// validEntry returns entry if it is valid at now, or nil.
+func validEntry(entry *AuthEntry, now time.Time) *AuthEntry {
+	if entry == nil || !entry.IsValid(now) {
+		return nil
+	}
+	return entry
 }
@@ -61,3 +61,12 @@ func TestIsValid_AfterRefreshTime(t *testing.T) {
 	}
 	assert.False(t, authEntry.IsValid(now.Add(time.Second)))
 }
+
+func TestRefreshTime(t *testing.T) {
+	now := time.Now()
+	authEntry := &AuthEntry{
+		RequestedAt: now.Add(-6 * time.Hour),
+		ExpiresAt:   now.Add(6 * time.Hour),
+	}
+	assert.Equal(t, now, authEntry.RefreshTime())
+}
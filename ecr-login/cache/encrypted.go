@@ -0,0 +1,115 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	log "github.com/cihub/seelog"
+)
+
+// encryptedTokenPrefix marks authorization tokens encrypted by an encrypted cache, and the version of the format.
+const encryptedTokenPrefix = "aes-gcm:v1:"
+
+type encryptedCredentialsCache struct {
+	CredentialsCache
+	aead cipher.AEAD
+}
+
+// NewEncryptedCredentialsCache wraps credentialsCache so that authorization tokens are encrypted with AES-GCM before
+// they are stored, using a key derived from secret. Entries that cannot be decrypted, because they were written with
+// another secret or without encryption, are treated as cache misses.
+func NewEncryptedCredentialsCache(credentialsCache CredentialsCache, secret string) CredentialsCache {
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		// Not reachable: a SHA-256 sum is always a valid AES-256 key.
+		panic(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(err)
+	}
+	return &encryptedCredentialsCache{CredentialsCache: credentialsCache, aead: aead}
+}
+
+func (e *encryptedCredentialsCache) Get(registry string) *AuthEntry {
+	return e.decrypted(registry, e.CredentialsCache.Get(registry))
+}
+
+// decrypted returns a copy of the entry read for registry with its token decrypted, or nil if it cannot be.
+func (e *encryptedCredentialsCache) decrypted(registry string, entry *AuthEntry) *AuthEntry {
+	if entry == nil {
+		return nil
+	}
+	token, err := e.decrypt(entry.AuthorizationToken)
+	if err != nil {
+		log.Debugf("Ignoring cached token for %s: %v", registry, err)
+		return nil
+	}
+	decrypted := *entry
+	decrypted.AuthorizationToken = token
+	return &decrypted
+}
+
+func (e *encryptedCredentialsCache) GetValid(registry string, now time.Time) *AuthEntry {
+	return e.decrypted(registry, e.CredentialsCache.GetValid(registry, now))
+}
+
+func (e *encryptedCredentialsCache) Set(registry string, entry *AuthEntry) {
+	token, err := e.encrypt(entry.AuthorizationToken)
+	if err != nil {
+		log.Infof("Could not encrypt token for %s, not caching it: %v", registry, err)
+		return
+	}
+	encrypted := *entry
+	encrypted.AuthorizationToken = token
+	e.CredentialsCache.Set(registry, &encrypted)
+}
+
+func (e *encryptedCredentialsCache) encrypt(token string) (string, error) {
+	nonce := make([]byte, e.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := e.aead.Seal(nonce, nonce, []byte(token), nil)
+	return encryptedTokenPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (e *encryptedCredentialsCache) decrypt(token string) (string, error) {
+	if !strings.HasPrefix(token, encryptedTokenPrefix) {
+		return "", errors.New("token is not encrypted")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(token, encryptedTokenPrefix))
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < e.aead.NonceSize() {
+		return "", errors.New("encrypted token is truncated")
+	}
+	nonce, ciphertext := sealed[:e.aead.NonceSize()], sealed[e.aead.NonceSize():]
+	plaintext, err := e.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
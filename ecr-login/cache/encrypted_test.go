@@ -0,0 +1,74 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptedCacheRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now().UTC()
+	entry := &AuthEntry{AuthorizationToken: "plaintext-token", RequestedAt: now, ExpiresAt: now.Add(12 * time.Hour), ProxyEndpoint: "https://proxy"}
+
+	credentialCache := NewEncryptedCredentialsCache(NewFileCredentialsCache(dir, "cache.json", "prefix-"), "secret")
+	credentialCache.Set(testRegistryName, entry)
+	assert.Equal(t, "plaintext-token", entry.AuthorizationToken, "the entry passed to Set must not be modified")
+
+	contents, err := ioutil.ReadFile(filepath.Join(dir, "cache.json"))
+	assert.Nil(t, err)
+	assert.False(t, strings.Contains(string(contents), "plaintext-token"), "the token must not be stored in plaintext")
+
+	cached := credentialCache.Get(testRegistryName)
+	if assert.NotNil(t, cached) {
+		assert.Equal(t, entry.AuthorizationToken, cached.AuthorizationToken)
+		assert.Equal(t, entry.ProxyEndpoint, cached.ProxyEndpoint)
+		assert.True(t, entry.ExpiresAt.Equal(cached.ExpiresAt))
+	}
+}
+
+func TestEncryptedCacheGetValid(t *testing.T) {
+	now := time.Now()
+	entry := &AuthEntry{AuthorizationToken: "plaintext-token", RequestedAt: now, ExpiresAt: now.Add(12 * time.Hour)}
+	credentialCache := NewEncryptedCredentialsCache(NewMemoryCredentialsCache(), "secret")
+	credentialCache.Set(testRegistryName, entry)
+
+	cached := credentialCache.GetValid(testRegistryName, now)
+	if assert.NotNil(t, cached) {
+		assert.Equal(t, "plaintext-token", cached.AuthorizationToken)
+	}
+	assert.Nil(t, credentialCache.GetValid(testRegistryName, now.Add(7*time.Hour)))
+}
+
+func TestEncryptedCacheWrongKeyIsMiss(t *testing.T) {
+	store := NewMemoryCredentialsCache()
+	entry := &AuthEntry{AuthorizationToken: "plaintext-token"}
+
+	NewEncryptedCredentialsCache(store, "old-secret").Set(testRegistryName, entry)
+	assert.Nil(t, NewEncryptedCredentialsCache(store, "new-secret").Get(testRegistryName))
+	assert.NotNil(t, NewEncryptedCredentialsCache(store, "old-secret").Get(testRegistryName))
+}
+
+func TestEncryptedCachePlaintextEntryIsMiss(t *testing.T) {
+	store := NewMemoryCredentialsCache()
+	store.Set(testRegistryName, &AuthEntry{AuthorizationToken: "plaintext-token"})
+
+	assert.Nil(t, NewEncryptedCredentialsCache(store, "secret").Get(testRegistryName))
+}
@@ -15,16 +15,22 @@ package cache
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"time"
 
 	log "github.com/cihub/seelog"
 )
 
 const registryCacheVersion = "1.0"
 
+// errCorruptedCache is returned when the cache file cannot be decoded, for example after it was truncated by a
+// full disk.
+var errCorruptedCache = errors.New("corrupted cache file")
+
 type RegistryCache struct {
 	Registries map[string]*AuthEntry
 	Version    string
@@ -56,25 +62,36 @@ func NewFileCredentialsCache(path string, filename string, cachePrefixKey string
 
 func (f *fileCredentialCache) Get(registry string) *AuthEntry {
 	log.Debugf("Checking file cache for %s", registry)
-	registryCache, err := f.load()
-	if err != nil {
-		log.Infof("Could not load existing cache: %v", err)
-		f.Clear()
-		registryCache = newRegistryCache()
-	}
-	return registryCache.Registries[f.cachePrefixKey+registry]
+	return f.loadOrReset().Registries[f.cachePrefixKey+registry]
+}
+
+// GetValid checks the entry read by a single load of the cache file, which is replaced atomically on save.
+func (f *fileCredentialCache) GetValid(registry string, now time.Time) *AuthEntry {
+	log.Debugf("Checking file cache for a valid entry for %s", registry)
+	return validEntry(f.loadOrReset().Registries[f.cachePrefixKey+registry], now)
 }
 
 func (f *fileCredentialCache) Set(registry string, entry *AuthEntry) {
 	log.Debugf("Saving credentials to file cache for %s", registry)
+	registryCache := f.loadOrReset()
+	registryCache.Registries[f.cachePrefixKey+registry] = entry
+
+	err := f.save(registryCache)
+	if err != nil {
+		log.Infof("Could not save cache: %s", err)
+	}
+}
+
+func (f *fileCredentialCache) Delete(registry string) {
+	log.Debugf("Deleting credentials from file cache for %s", registry)
 	registryCache, err := f.load()
 	if err != nil {
 		log.Infof("Could not load existing cache: %v", err)
 		f.Clear()
-		registryCache = newRegistryCache()
+		return
 	}
 
-	registryCache.Registries[f.cachePrefixKey+registry] = entry
+	delete(registryCache.Registries, f.cachePrefixKey+registry)
 
 	err = f.save(registryCache)
 	if err != nil {
@@ -85,7 +102,7 @@ func (f *fileCredentialCache) Set(registry string, entry *AuthEntry) {
 func (f *fileCredentialCache) Clear() {
 	err := os.Remove(f.fullFilePath())
 	if err != nil {
-		log.Infof("Could not clear cache: %s")
+		log.Infof("Could not clear cache: %s", err)
 	}
 }
 
@@ -93,6 +110,22 @@ func (f *fileCredentialCache) fullFilePath() string {
 	return filepath.Join(f.path, f.filename)
 }
 
+// loadOrReset returns the cache on disk, or an empty cache when it cannot be loaded. The file is then removed, so that
+// the next Set writes it afresh instead of every call failing on it.
+func (f *fileCredentialCache) loadOrReset() *RegistryCache {
+	registryCache, err := f.load()
+	if err == nil {
+		return registryCache
+	}
+	if errors.Is(err, errCorruptedCache) {
+		log.Warnf("Ignoring %s: %v", f.fullFilePath(), err)
+	} else {
+		log.Infof("Could not load existing cache: %v", err)
+	}
+	f.Clear()
+	return newRegistryCache()
+}
+
 // Saves credential cache to disk. This writes to a temporary file first, then moves the file to the config location.
 // This elminates from reading partially written credential files, and reduces (but does not eliminate) concurrent
 // file access. There is not guarantee here for handling multiple writes at once since there is no out of process locking.
@@ -140,7 +173,7 @@ func (f *fileCredentialCache) load() (*RegistryCache, error) {
 	defer file.Close()
 
 	if err = json.NewDecoder(file).Decode(&registryCache); err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %v", errCorruptedCache, err)
 	}
 
 	if registryCache.Version != registryCacheVersion {
@@ -148,6 +181,9 @@ func (f *fileCredentialCache) load() (*RegistryCache, error) {
 			registryCache.Version,
 			registryCacheVersion)
 	}
+	if registryCache.Registries == nil {
+		registryCache.Registries = make(map[string]*AuthEntry)
+	}
 
 	return registryCache, nil
 }
@@ -14,6 +14,7 @@
 package cache
 
 import (
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
@@ -61,6 +62,31 @@ func TestCredentials(t *testing.T) {
 	assert.Nil(t, entry)
 }
 
+func TestGetValid(t *testing.T) {
+	credentialCache := NewFileCredentialsCache(t.TempDir(), testFilename, testCachePrefixKey)
+	assert.Nil(t, credentialCache.GetValid(testRegistryName, time.Now()))
+
+	credentialCache.Set(testRegistryName, &testAuthEntry)
+	entry := credentialCache.GetValid(testRegistryName, time.Now())
+	if assert.NotNil(t, entry) {
+		assert.Equal(t, testAuthEntry.AuthorizationToken, entry.AuthorizationToken)
+	}
+	assert.Nil(t, credentialCache.GetValid(testRegistryName, testAuthEntry.RefreshTime()))
+}
+
+func TestDelete(t *testing.T) {
+	credentialCache := NewFileCredentialsCache(testPath, testFilename, testCachePrefixKey)
+
+	credentialCache.Set(testRegistryName, &testAuthEntry)
+	credentialCache.Set("otherRegistry", &testAuthEntry)
+
+	credentialCache.Delete(testRegistryName)
+	assert.Nil(t, credentialCache.Get(testRegistryName))
+	assert.NotNil(t, credentialCache.Get("otherRegistry"))
+
+	credentialCache.Clear()
+}
+
 func TestPreviousVersionCache(t *testing.T) {
 	credentialCache := NewFileCredentialsCache(testPath, testFilename, testCachePrefixKey)
 
@@ -92,3 +118,21 @@ func TestInvalidCache(t *testing.T) {
 
 	credentialCache.Clear()
 }
+
+func TestCorruptedCacheRewrittenOnSet(t *testing.T) {
+	path := t.TempDir()
+	credentialCache := NewFileCredentialsCache(path, testFilename, testCachePrefixKey)
+
+	for _, corrupted := range []string{"", `{"Registries":{"prefix-testRegistry":{"Authoriza`, `{"Registries":null,"Version":"1.0"}`} {
+		err := ioutil.WriteFile(filepath.Join(path, testFilename), []byte(corrupted), 0600)
+		assert.NoError(t, err)
+
+		assert.Nil(t, credentialCache.Get(testRegistryName), corrupted)
+
+		credentialCache.Set(testRegistryName, &testAuthEntry)
+		entry := credentialCache.Get(testRegistryName)
+		if assert.NotNil(t, entry, corrupted) {
+			assert.Equal(t, testAuthEntry.AuthorizationToken, entry.AuthorizationToken)
+		}
+	}
+}
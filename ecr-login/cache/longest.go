@@ -0,0 +1,43 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import "sync"
+
+type longestExpiryCredentialsCache struct {
+	CredentialsCache
+	lock sync.Mutex
+}
+
+// NewLongestExpiryCredentialsCache wraps credentialsCache so that Set keeps the existing entry for a registry when it
+// expires later than the entry being written. Near-simultaneous fetches then cannot shorten the life of a cached
+// token by writing last with an earlier expiry.
+//
+// Only writes made in the same process are serialized. Between processes sharing a file or Redis cache, the read and
+// the write are not atomic, so a process can still replace an entry with one expiring earlier. That only makes the
+// token refresh sooner than needed.
+func NewLongestExpiryCredentialsCache(credentialsCache CredentialsCache) CredentialsCache {
+	return &longestExpiryCredentialsCache{CredentialsCache: credentialsCache}
+}
+
+func (l *longestExpiryCredentialsCache) Set(registry string, entry *AuthEntry) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	existing := l.CredentialsCache.Get(registry)
+	if existing != nil && existing.ExpiresAt.After(entry.ExpiresAt) {
+		return
+	}
+	l.CredentialsCache.Set(registry, entry)
+}
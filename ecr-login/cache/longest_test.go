@@ -0,0 +1,66 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLongestExpiryCacheKeepsLongerEntry(t *testing.T) {
+	now := time.Now()
+	shorter := &AuthEntry{AuthorizationToken: "shorter", RequestedAt: now, ExpiresAt: now.Add(time.Hour)}
+	longer := &AuthEntry{AuthorizationToken: "longer", RequestedAt: now, ExpiresAt: now.Add(12 * time.Hour)}
+
+	credentialCache := NewLongestExpiryCredentialsCache(NewMemoryCredentialsCache())
+	credentialCache.Set(testRegistryName, longer)
+	credentialCache.Set(testRegistryName, shorter)
+	assert.Equal(t, longer, credentialCache.Get(testRegistryName))
+
+	credentialCache = NewLongestExpiryCredentialsCache(NewMemoryCredentialsCache())
+	credentialCache.Set(testRegistryName, shorter)
+	credentialCache.Set(testRegistryName, longer)
+	assert.Equal(t, longer, credentialCache.Get(testRegistryName))
+}
+
+func TestLongestExpiryCacheConcurrentWrites(t *testing.T) {
+	now := time.Now()
+	credentialCache := NewLongestExpiryCredentialsCache(NewMemoryCredentialsCache())
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 10; i++ {
+		wg.Add(1)
+		go func(hours int) {
+			defer wg.Done()
+			credentialCache.Set(testRegistryName, &AuthEntry{RequestedAt: now, ExpiresAt: now.Add(time.Duration(hours) * time.Hour)})
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, now.Add(10*time.Hour), credentialCache.Get(testRegistryName).ExpiresAt)
+}
+
+func TestLastWriteWinsByDefault(t *testing.T) {
+	now := time.Now()
+	shorter := &AuthEntry{AuthorizationToken: "shorter", RequestedAt: now, ExpiresAt: now.Add(time.Hour)}
+	longer := &AuthEntry{AuthorizationToken: "longer", RequestedAt: now, ExpiresAt: now.Add(12 * time.Hour)}
+
+	credentialCache := NewMemoryCredentialsCache()
+	credentialCache.Set(testRegistryName, longer)
+	credentialCache.Set(testRegistryName, shorter)
+	assert.Equal(t, shorter, credentialCache.Get(testRegistryName))
+}
@@ -0,0 +1,59 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+type memoryCredentialsCache struct {
+	lock       sync.RWMutex
+	registries map[string]*AuthEntry
+}
+
+// NewMemoryCredentialsCache returns a cache that keeps entries in memory for the lifetime of the process.
+func NewMemoryCredentialsCache() CredentialsCache {
+	return &memoryCredentialsCache{registries: make(map[string]*AuthEntry)}
+}
+
+func (m *memoryCredentialsCache) Get(registry string) *AuthEntry {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.registries[registry]
+}
+
+func (m *memoryCredentialsCache) GetValid(registry string, now time.Time) *AuthEntry {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return validEntry(m.registries[registry], now)
+}
+
+func (m *memoryCredentialsCache) Set(registry string, entry *AuthEntry) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.registries[registry] = entry
+}
+
+func (m *memoryCredentialsCache) Delete(registry string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.registries, registry)
+}
+
+func (m *memoryCredentialsCache) Clear() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.registries = make(map[string]*AuthEntry)
+}
@@ -0,0 +1,81 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryCache(t *testing.T) {
+	credentialCache := NewMemoryCredentialsCache()
+
+	entry := credentialCache.Get(testRegistryName)
+	assert.Nil(t, entry)
+
+	credentialCache.Set(testRegistryName, &testAuthEntry)
+
+	entry = credentialCache.Get(testRegistryName)
+	assert.Equal(t, &testAuthEntry, entry)
+
+	credentialCache.Delete(testRegistryName)
+	assert.Nil(t, credentialCache.Get(testRegistryName))
+
+	credentialCache.Set(testRegistryName, &testAuthEntry)
+	credentialCache.Clear()
+	assert.Nil(t, credentialCache.Get(testRegistryName))
+}
+
+func TestMemoryCacheGetValid(t *testing.T) {
+	credentialCache := NewMemoryCredentialsCache()
+	assert.Nil(t, credentialCache.GetValid(testRegistryName, time.Now()))
+
+	credentialCache.Set(testRegistryName, &testAuthEntry)
+	assert.Equal(t, &testAuthEntry, credentialCache.GetValid(testRegistryName, time.Now()))
+	assert.Nil(t, credentialCache.GetValid(testRegistryName, testAuthEntry.RefreshTime()), "entries past their refresh time are not valid")
+}
+
+// TestMemoryCacheConcurrentAccess is meant to be run with -race.
+func TestMemoryCacheConcurrentAccess(t *testing.T) {
+	credentialCache := NewMemoryCredentialsCache()
+	valid := &AuthEntry{RequestedAt: time.Now(), ExpiresAt: time.Now().Add(12 * time.Hour)}
+	expired := &AuthEntry{RequestedAt: time.Now().Add(-12 * time.Hour), ExpiresAt: time.Now().Add(-time.Hour)}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				switch (i + j) % 4 {
+				case 0:
+					credentialCache.Set(testRegistryName, valid)
+				case 1:
+					credentialCache.Set(testRegistryName, expired)
+				case 2:
+					credentialCache.Delete(testRegistryName)
+				case 3:
+					if entry := credentialCache.GetValid(testRegistryName, time.Now()); entry != nil {
+						assert.True(t, entry == valid, "GetValid returned an invalid entry")
+					}
+					credentialCache.Get(testRegistryName)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -19,6 +19,7 @@ package mock_cache
 import (
 	cache "github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache"
 	gomock "github.com/golang/mock/gomock"
+	time "time"
 )
 
 // Mock of CredentialsCache interface
@@ -50,6 +51,14 @@ func (_mr *_MockCredentialsCacheRecorder) Clear() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Clear")
 }
 
+func (_m *MockCredentialsCache) Delete(_param0 string) {
+	_m.ctrl.Call(_m, "Delete", _param0)
+}
+
+func (_mr *_MockCredentialsCacheRecorder) Delete(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "Delete", arg0)
+}
+
 func (_m *MockCredentialsCache) Get(_param0 string) *cache.AuthEntry {
 	ret := _m.ctrl.Call(_m, "Get", _param0)
 	ret0, _ := ret[0].(*cache.AuthEntry)
@@ -60,6 +69,16 @@ func (_mr *_MockCredentialsCacheRecorder) Get(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Get", arg0)
 }
 
+func (_m *MockCredentialsCache) GetValid(_param0 string, _param1 time.Time) *cache.AuthEntry {
+	ret := _m.ctrl.Call(_m, "GetValid", _param0, _param1)
+	ret0, _ := ret[0].(*cache.AuthEntry)
+	return ret0
+}
+
+func (_mr *_MockCredentialsCacheRecorder) GetValid(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetValid", arg0, arg1)
+}
+
 func (_m *MockCredentialsCache) Set(_param0 string, _param1 *cache.AuthEntry) {
 	_m.ctrl.Call(_m, "Set", _param0, _param1)
 }
@@ -13,6 +13,8 @@
 
 package cache
 
+import "time"
+
 type nullCredentialsCache struct{}
 
 func NewNullCredentialsCache() CredentialsCache {
@@ -23,8 +25,15 @@ func (nullCache *nullCredentialsCache) Get(registry string) *AuthEntry {
 	return nil
 }
 
+func (nullCache *nullCredentialsCache) GetValid(registry string, now time.Time) *AuthEntry {
+	return nil
+}
+
 func (nullCache *nullCredentialsCache) Set(registry string, entry *AuthEntry) {
 }
 
+func (nullCache *nullCredentialsCache) Delete(registry string) {
+}
+
 func (nullCache *nullCredentialsCache) Clear() {
 }
@@ -15,6 +15,7 @@ package cache
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -29,6 +30,8 @@ func TestNullCache(t *testing.T) {
 
 	entry = credentialCache.Get(testRegistryName)
 	assert.Nil(t, entry)
+	assert.Nil(t, credentialCache.GetValid(testRegistryName, time.Now()))
 
+	credentialCache.Delete(testRegistryName)
 	credentialCache.Clear()
 }
@@ -0,0 +1,34 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+type observedCredentialsCache struct {
+	CredentialsCache
+	onSet func(registry string, entry *AuthEntry)
+}
+
+// NewObservedCredentialsCache wraps credentialsCache so that onSet is called after every Set, for example to notify
+// other instances sharing a Redis cache that an entry was refreshed. The entry includes the token. A nil onSet
+// returns credentialsCache unchanged.
+func NewObservedCredentialsCache(credentialsCache CredentialsCache, onSet func(registry string, entry *AuthEntry)) CredentialsCache {
+	if onSet == nil {
+		return credentialsCache
+	}
+	return &observedCredentialsCache{CredentialsCache: credentialsCache, onSet: onSet}
+}
+
+func (o *observedCredentialsCache) Set(registry string, entry *AuthEntry) {
+	o.CredentialsCache.Set(registry, entry)
+	o.onSet(registry, entry)
+}
@@ -0,0 +1,47 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObservedCacheCallsOnSet(t *testing.T) {
+	now := time.Now()
+	entry := &AuthEntry{AuthorizationToken: "token", RequestedAt: now, ExpiresAt: now.Add(12 * time.Hour)}
+
+	var registries []string
+	var entries []*AuthEntry
+	credentialCache := NewObservedCredentialsCache(NewMemoryCredentialsCache(), func(registry string, entry *AuthEntry) {
+		registries = append(registries, registry)
+		entries = append(entries, entry)
+	})
+
+	assert.Nil(t, credentialCache.Get(testRegistryName))
+	credentialCache.Set(testRegistryName, entry)
+	assert.Equal(t, []string{testRegistryName}, registries)
+	assert.Equal(t, []*AuthEntry{entry}, entries)
+	assert.Equal(t, entry, credentialCache.Get(testRegistryName))
+
+	credentialCache.Delete(testRegistryName)
+	assert.Len(t, registries, 1, "only writes are observed")
+}
+
+func TestObservedCacheWithoutOnSet(t *testing.T) {
+	memoryCache := NewMemoryCredentialsCache()
+	assert.Equal(t, memoryCache, NewObservedCredentialsCache(memoryCache, nil))
+}
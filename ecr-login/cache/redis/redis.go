@@ -0,0 +1,175 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package redis provides a CredentialsCache backed by a Redis server, so that a fleet of short-lived hosts can share
+// authorization tokens instead of each requesting their own. It speaks the Redis protocol directly to avoid adding a
+// client library dependency to the helper.
+package redis
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache"
+	log "github.com/cihub/seelog"
+)
+
+const (
+	defaultTimeout = 2 * time.Second
+
+	// scanCount is the number of keys Clear asks SCAN to look at in each call.
+	scanCount = 100
+)
+
+type redisCredentialsCache struct {
+	address        string
+	cachePrefixKey string
+	timeout        time.Duration
+	fallback       cache.CredentialsCache
+}
+
+// NewCredentialsCache returns a cache storing entries in the Redis server at address under keys starting with
+// cachePrefixKey. Entries are stored as JSON encoded AuthEntry values that Redis expires together with their token.
+// When the server cannot be reached, entries are kept in memory instead so that pulls do not fail. The connection is
+// neither authenticated nor encrypted, and tokens are sent as they are given, so the server must be on a trusted
+// network, or the entries encrypted with cache.NewEncryptedCredentialsCache.
+func NewCredentialsCache(address string, cachePrefixKey string) cache.CredentialsCache {
+	return &redisCredentialsCache{
+		address:        address,
+		cachePrefixKey: cachePrefixKey,
+		timeout:        defaultTimeout,
+		fallback:       cache.NewMemoryCredentialsCache(),
+	}
+}
+
+func (r *redisCredentialsCache) Get(registry string) *cache.AuthEntry {
+	log.Debugf("Checking redis cache for %s", registry)
+	reply, err := r.do("GET", r.key(registry))
+	if err != nil {
+		log.Infof("Could not read from redis cache, using in-memory cache: %v", err)
+		return r.fallback.Get(registry)
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil
+	}
+
+	entry := &cache.AuthEntry{}
+	if err := json.Unmarshal(value, entry); err != nil {
+		log.Infof("Could not decode redis cache entry for %s: %v", registry, err)
+		return nil
+	}
+	return entry
+}
+
+// GetValid checks the entry read by a single GET, which Redis serves atomically.
+func (r *redisCredentialsCache) GetValid(registry string, now time.Time) *cache.AuthEntry {
+	entry := r.Get(registry)
+	if entry == nil || !entry.IsValid(now) {
+		return nil
+	}
+	return entry
+}
+
+func (r *redisCredentialsCache) Set(registry string, entry *cache.AuthEntry) {
+	log.Debugf("Saving credentials to redis cache for %s", registry)
+	ttl := entry.ExpiresAt.Sub(time.Now())
+	if ttl <= 0 {
+		return
+	}
+
+	value, err := json.Marshal(entry)
+	if err != nil {
+		log.Infof("Could not encode redis cache entry for %s: %v", registry, err)
+		return
+	}
+
+	_, err = r.do("SET", r.key(registry), string(value), "PX", formatInt(int64(ttl/time.Millisecond)))
+	if err != nil {
+		log.Infof("Could not write to redis cache, using in-memory cache: %v", err)
+		r.fallback.Set(registry, entry)
+	}
+}
+
+func (r *redisCredentialsCache) Delete(registry string) {
+	r.fallback.Delete(registry)
+	if _, err := r.do("DEL", r.key(registry)); err != nil {
+		log.Infof("Could not delete from redis cache: %v", err)
+	}
+}
+
+// Clear deletes the entries under the prefix of the cache. Keys are listed with SCAN rather than KEYS, which would
+// block a shared server while it walks every key.
+func (r *redisCredentialsCache) Clear() {
+	r.fallback.Clear()
+	cursor := "0"
+	for {
+		reply, err := r.do("SCAN", cursor, "MATCH", escapePattern(r.cachePrefixKey)+"*", "COUNT", formatInt(scanCount))
+		if err != nil {
+			log.Infof("Could not clear redis cache: %v", err)
+			return
+		}
+		page, ok := reply.([]interface{})
+		if !ok || len(page) != 2 {
+			log.Infof("Could not clear redis cache: unexpected SCAN reply")
+			return
+		}
+		next, _ := page[0].([]byte)
+		keys, _ := page[1].([]interface{})
+
+		args := []string{"DEL"}
+		for _, key := range keys {
+			if key, ok := key.([]byte); ok {
+				args = append(args, string(key))
+			}
+		}
+		if len(args) > 1 {
+			if _, err := r.do(args...); err != nil {
+				log.Infof("Could not clear redis cache: %v", err)
+				return
+			}
+		}
+
+		cursor = string(next)
+		if cursor == "0" || cursor == "" {
+			return
+		}
+	}
+}
+
+// escapePattern escapes the characters of prefix that are special in the patterns of SCAN MATCH.
+func escapePattern(prefix string) string {
+	return strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`).Replace(prefix)
+}
+
+func (r *redisCredentialsCache) key(registry string) string {
+	return r.cachePrefixKey + registry
+}
+
+// do runs a single command on a new connection. The helper usually runs once per pull, so there is no pool to keep.
+func (r *redisCredentialsCache) do(args ...string) (interface{}, error) {
+	conn, err := net.DialTimeout("tcp", r.address, r.timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(r.timeout))
+	if _, err := conn.Write(encodeCommand(args)); err != nil {
+		return nil, err
+	}
+	return readReply(bufio.NewReader(conn))
+}
@@ -0,0 +1,223 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testRegistryName   = "testRegistry"
+	testCachePrefixKey = "prefix-"
+)
+
+var testAuthEntry = cache.AuthEntry{
+	AuthorizationToken: "testToken",
+	RequestedAt:        time.Now().Add(-5 * time.Hour).UTC(),
+	ExpiresAt:          time.Now().Add(7 * time.Hour).UTC(),
+	ProxyEndpoint:      "testEndpoint",
+}
+
+// fakeServer implements enough of the Redis protocol to exercise the cache.
+type fakeServer struct {
+	listener net.Listener
+	lock     sync.Mutex
+	values   map[string]string
+	cursors  map[string]string
+	commands [][]string
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	server := &fakeServer{listener: listener, values: make(map[string]string), cursors: make(map[string]string)}
+	go server.serve()
+	return server
+}
+
+func (s *fakeServer) address() string {
+	return s.listener.Addr().String()
+}
+
+func (s *fakeServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeServer) handle(conn net.Conn) {
+	defer conn.Close()
+	reply, err := readReply(bufio.NewReader(conn))
+	if err != nil {
+		return
+	}
+	var args []string
+	for _, arg := range reply.([]interface{}) {
+		args = append(args, string(arg.([]byte)))
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.commands = append(s.commands, args)
+	switch args[0] {
+	case "GET":
+		value, ok := s.values[args[1]]
+		if !ok {
+			conn.Write([]byte("$-1\r\n"))
+			return
+		}
+		fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(value), value)
+	case "SET":
+		s.values[args[1]] = args[2]
+		conn.Write([]byte("+OK\r\n"))
+	case "DEL":
+		for _, key := range args[1:] {
+			delete(s.values, key)
+		}
+		conn.Write([]byte(":1\r\n"))
+	case "SCAN":
+		// Pages hold a single key, to exercise the cursor. Patterns are only supported as an escaped prefix.
+		var keys []string
+		prefix := strings.NewReplacer(`\`, "").Replace(strings.TrimSuffix(args[3], "*"))
+		for key := range s.values {
+			if strings.HasPrefix(key, prefix) {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		// Cursors resume after the last key returned, so that deleting scanned keys skips none.
+		after := s.cursors[args[1]]
+		next, page := "0", []string{}
+		for i, key := range keys {
+			if key > after {
+				page = keys[i : i+1]
+				if i+1 < len(keys) {
+					next = strconv.Itoa(len(s.cursors) + 1)
+					s.cursors[next] = key
+				}
+				break
+			}
+		}
+		fmt.Fprintf(conn, "*2\r\n$%d\r\n%s\r\n", len(next), next)
+		conn.Write(encodeCommand(page))
+	default:
+		conn.Write([]byte("-ERR unknown command\r\n"))
+	}
+}
+
+func (s *fakeServer) command(i int) []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.commands[i]
+}
+
+func (s *fakeServer) size() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.values)
+}
+
+func TestRedisCache(t *testing.T) {
+	server := newFakeServer(t)
+	defer server.listener.Close()
+	credentialCache := NewCredentialsCache(server.address(), testCachePrefixKey)
+
+	assert.Nil(t, credentialCache.Get(testRegistryName))
+
+	credentialCache.Set(testRegistryName, &testAuthEntry)
+	entry := credentialCache.Get(testRegistryName)
+	assert.NotNil(t, entry)
+	assert.Equal(t, testAuthEntry.AuthorizationToken, entry.AuthorizationToken)
+	assert.Equal(t, testAuthEntry.ProxyEndpoint, entry.ProxyEndpoint)
+	assert.WithinDuration(t, testAuthEntry.ExpiresAt, entry.ExpiresAt, time.Second)
+	assert.NotNil(t, credentialCache.GetValid(testRegistryName, time.Now()))
+	assert.Nil(t, credentialCache.GetValid(testRegistryName, testAuthEntry.RefreshTime()))
+
+	setCommand := server.command(1)
+	assert.Equal(t, "SET", setCommand[0])
+	assert.Equal(t, testCachePrefixKey+testRegistryName, setCommand[1])
+	assert.Equal(t, "PX", setCommand[3])
+
+	credentialCache.Delete(testRegistryName)
+	assert.Nil(t, credentialCache.Get(testRegistryName))
+
+	credentialCache.Set(testRegistryName, &testAuthEntry)
+	credentialCache.Set("otherRegistry", &testAuthEntry)
+	NewCredentialsCache(server.address(), "other-").Set(testRegistryName, &testAuthEntry)
+	credentialCache.Clear()
+	assert.Equal(t, 1, server.size(), "entries under other prefixes are kept")
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	for _, command := range server.commands {
+		assert.NotEqual(t, "KEYS", command[0])
+	}
+}
+
+func TestReadReplyLimits(t *testing.T) {
+	_, err := readReply(bufio.NewReader(strings.NewReader(fmt.Sprintf("$%d\r\n", maxBulkLength+1))))
+	assert.Error(t, err)
+	_, err = readReply(bufio.NewReader(strings.NewReader(fmt.Sprintf("*%d\r\n", maxArrayLength+1))))
+	assert.Error(t, err)
+
+	value, err := readReply(bufio.NewReader(strings.NewReader("$5\r\nhello\r\n")))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("hello"), value)
+}
+
+func TestEscapePattern(t *testing.T) {
+	assert.Equal(t, `us-west-2-`, escapePattern("us-west-2-"))
+	assert.Equal(t, `a\*b\?\[c\]\\`, escapePattern(`a*b?[c]\`))
+}
+
+func TestRedisCacheSkipsExpiredEntries(t *testing.T) {
+	server := newFakeServer(t)
+	defer server.listener.Close()
+	credentialCache := NewCredentialsCache(server.address(), testCachePrefixKey)
+
+	expired := testAuthEntry
+	expired.ExpiresAt = time.Now().Add(-time.Minute)
+	credentialCache.Set(testRegistryName, &expired)
+	assert.Equal(t, 0, server.size())
+}
+
+func TestRedisCacheFallsBackToMemory(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	address := listener.Addr().String()
+	listener.Close()
+
+	credentialCache := NewCredentialsCache(address, testCachePrefixKey)
+	assert.Nil(t, credentialCache.Get(testRegistryName))
+
+	credentialCache.Set(testRegistryName, &testAuthEntry)
+	assert.Equal(t, &testAuthEntry, credentialCache.Get(testRegistryName))
+
+	credentialCache.Delete(testRegistryName)
+	assert.Nil(t, credentialCache.Get(testRegistryName))
+}
@@ -0,0 +1,117 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package redis
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Limits on the replies read, so that a misbehaving server cannot make the helper allocate without bound. Cache
+// entries are a few kilobytes, and Clear scans a hundred keys at a time.
+const (
+	maxBulkLength  = 1 << 20
+	maxArrayLength = 1 << 16
+)
+
+// serverError is an error reply sent by the Redis server.
+type serverError string
+
+func (e serverError) Error() string {
+	return "redis: " + string(e)
+}
+
+func encodeCommand(args []string) []byte {
+	var buffer bytes.Buffer
+	fmt.Fprintf(&buffer, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&buffer, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return buffer.Bytes()
+}
+
+func formatInt(value int64) string {
+	return strconv.FormatInt(value, 10)
+}
+
+// readReply reads one reply. Simple strings are returned as string, bulk strings as []byte (nil when missing),
+// integers as int64 and arrays as []interface{}.
+func readReply(reader *bufio.Reader) (interface{}, error) {
+	line, err := readLine(reader)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, serverError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		length, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if length < 0 {
+			return nil, nil
+		}
+		if length > maxBulkLength {
+			return nil, fmt.Errorf("redis: bulk string of %d bytes exceeds the limit of %d", length, maxBulkLength)
+		}
+		data := make([]byte, length+2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+		return data[:length], nil
+	case '*':
+		length, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if length < 0 {
+			return nil, nil
+		}
+		if length > maxArrayLength {
+			return nil, fmt.Errorf("redis: array of %d elements exceeds the limit of %d", length, maxArrayLength)
+		}
+		values := make([]interface{}, length)
+		for i := range values {
+			if values[i], err = readReply(reader); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
+
+func readLine(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("redis: malformed reply %q", line)
+	}
+	return line[:len(line)-2], nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	log "github.com/cihub/seelog"
+)
+
+// RegionHints remembers the region that last served a host, for hosts resolved by trying several candidate regions,
+// so that the region is tried first the next time.
+type RegionHints interface {
+	Get(host string) string
+	Set(host string, region string)
+}
+
+type fileRegionHints struct {
+	path     string
+	filename string
+}
+
+// NewFileRegionHints returns RegionHints stored in the file named filename in the directory path.
+func NewFileRegionHints(path string, filename string) RegionHints {
+	return &fileRegionHints{path: path, filename: filename}
+}
+
+func (f *fileRegionHints) Get(host string) string {
+	return f.load()[host]
+}
+
+func (f *fileRegionHints) Set(host string, region string) {
+	hints := f.load()
+	if hints[host] == region {
+		return
+	}
+	log.Debugf("Remembering region %s for %s", region, host)
+	hints[host] = region
+	if err := f.save(hints); err != nil {
+		log.Infof("Could not save region hints: %s", err)
+	}
+}
+
+func (f *fileRegionHints) fullFilePath() string {
+	return filepath.Join(f.path, f.filename)
+}
+
+// load returns the hints on disk, or no hints when they cannot be loaded.
+func (f *fileRegionHints) load() map[string]string {
+	hints := make(map[string]string)
+	contents, err := ioutil.ReadFile(f.fullFilePath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Infof("Could not load region hints: %v", err)
+		}
+		return hints
+	}
+	if err := json.Unmarshal(contents, &hints); err != nil {
+		log.Warnf("Ignoring %s: %v", f.fullFilePath(), err)
+		return make(map[string]string)
+	}
+	return hints
+}
+
+// save writes hints to a temporary file first, then moves it in place, like the file credentials cache.
+func (f *fileRegionHints) save(hints map[string]string) error {
+	buff, err := json.MarshalIndent(hints, "", "  ")
+	if err != nil {
+		return err
+	}
+	file, err := ioutil.TempFile(f.path, ".region-hints.json.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(buff); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+	file.Close()
+	return os.Rename(file.Name(), f.fullFilePath())
+}
+
+type nullRegionHints struct{}
+
+// NewNullRegionHints returns RegionHints that remember nothing.
+func NewNullRegionHints() RegionHints {
+	return nullRegionHints{}
+}
+
+func (nullRegionHints) Get(host string) string {
+	return ""
+}
+
+func (nullRegionHints) Set(host string, region string) {
+}
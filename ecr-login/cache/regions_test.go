@@ -0,0 +1,56 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileRegionHints(t *testing.T) {
+	dir := t.TempDir()
+	hints := NewFileRegionHints(dir, "region-hints.json")
+	assert.Equal(t, "", hints.Get("registry.example.com"))
+
+	hints.Set("registry.example.com", "eu-west-1")
+	hints.Set("other.example.com", "us-east-1")
+	reloaded := NewFileRegionHints(dir, "region-hints.json")
+	assert.Equal(t, "eu-west-1", reloaded.Get("registry.example.com"))
+	assert.Equal(t, "us-east-1", reloaded.Get("other.example.com"))
+
+	hints.Set("registry.example.com", "us-west-2")
+	assert.Equal(t, "us-west-2", reloaded.Get("registry.example.com"))
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	assert.Equal(t, []string{filepath.Join(dir, "region-hints.json")}, files, "temporary files should not be left behind")
+}
+
+func TestFileRegionHintsCorrupted(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "region-hints.json"), []byte("{"), 0600))
+	hints := NewFileRegionHints(dir, "region-hints.json")
+	assert.Equal(t, "", hints.Get("registry.example.com"))
+
+	hints.Set("registry.example.com", "eu-west-1")
+	assert.Equal(t, "eu-west-1", hints.Get("registry.example.com"))
+}
+
+func TestNullRegionHints(t *testing.T) {
+	hints := NewNullRegionHints()
+	hints.Set("registry.example.com", "eu-west-1")
+	assert.Equal(t, "", hints.Get("registry.example.com"))
+}
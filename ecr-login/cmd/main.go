@@ -14,6 +14,10 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"os"
+
 	ecr "github.com/awslabs/amazon-ecr-credential-helper/ecr-login"
 	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api"
 	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/config"
@@ -24,5 +28,56 @@ import (
 func main() {
 	defer log.Flush()
 	config.SetupLogger()
-	credentials.Serve(ecr.ECRHelper{ClientFactory: api.DefaultClientFactory{}})
+
+	format := flag.String("format", ecr.FormatDocker, "output format of get: docker, json, authpair or base64")
+	shell := flag.String("shell", ecr.ShellSh, "shell of the commands printed by env: sh, fish or powershell")
+	describe := flag.Bool("describe", false, "print the endpoint, expiry and account of the credentials get would return, without the password")
+	flag.Parse()
+
+	// The process exits as soon as a command returns, which would cut short refreshes made in the background.
+	helper := ecr.ECRHelper{ClientFactory: api.DefaultClientFactory{Options: api.ClientOptions{SynchronousRefresh: true}}}
+	hostPattern, err := ecr.HostPatternFromEnvironment()
+	if err != nil {
+		fmt.Fprintf(os.Stdout, "%v\n", err)
+		log.Flush()
+		os.Exit(1)
+	}
+	helper.HostPattern = hostPattern
+
+	err = ecr.RunWithDeadline(ecr.MaxRuntime(), func() error {
+		if flag.NArg() == 2 && flag.Arg(0) == "diagnose" {
+			return helper.Diagnose(flag.Arg(1), os.Stderr)
+		} else if flag.NArg() == 2 && flag.Arg(0) == "env" {
+			return helper.Env(flag.Arg(1), os.Stdout, *shell)
+		} else if flag.NArg() >= 1 && flag.Arg(0) == "prime" {
+			serverURLs := flag.Args()[1:]
+			if len(serverURLs) == 0 {
+				registries, err := ecr.DockerConfigRegistries("")
+				if err != nil {
+					return err
+				}
+				serverURLs = registries
+			}
+			return helper.Prime(serverURLs, os.Stderr)
+		} else if flag.NArg() >= 3 && flag.Arg(0) == "write-config" {
+			return helper.WriteDockerConfig(flag.Arg(1), flag.Args()[2:], os.Stderr)
+		} else if flag.NArg() != 1 {
+			return fmt.Errorf("Usage: %s [--format docker|json|authpair|base64] [--describe] <store|get|erase>\n"+
+				"       %s [--shell sh|fish|powershell] env <serverURL>\n"+
+				"       %s diagnose <serverURL>\n"+
+				"       %s prime [serverURL...]\n"+
+				"       %s write-config <path> <serverURL...>", os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0])
+		} else if flag.Arg(0) == "get" && *describe {
+			return helper.Describe(os.Stdin, os.Stdout)
+		} else if flag.Arg(0) == "get" {
+			return helper.GetFormatted(os.Stdin, os.Stdout, *format)
+		}
+		return credentials.HandleCommand(helper, flag.Arg(0), os.Stdin, os.Stdout)
+	})
+
+	if err != nil {
+		fmt.Fprintf(os.Stdout, "%v\n", err)
+		log.Flush()
+		os.Exit(1)
+	}
 }
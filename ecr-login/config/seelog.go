@@ -14,13 +14,27 @@
 package config
 
 import (
-	"fmt"
+	"os"
 	"path/filepath"
+	"strings"
 
 	log "github.com/cihub/seelog"
 	"github.com/mitchellh/go-homedir"
 )
 
+// logLevelEnv selects the minimum level of messages written to the log, overriding defaultLogLevel.
+const logLevelEnv = "ECR_LOG_LEVEL"
+
+const defaultLogLevel = "debug"
+
+var logLevels = map[string]bool{
+	"debug": true,
+	"info":  true,
+	"warn":  true,
+	"error": true,
+	"off":   true,
+}
+
 func SetupLogger() {
 	logger, err := log.LoggerFromConfigAsString(loggerConfig())
 	if err == nil {
@@ -33,13 +47,24 @@ func SetupLogger() {
 func loggerConfig() string {
 	logfile, err := homedir.Expand("~/.ecr/log/ecr-login.log")
 	if err != nil {
-		fmt.Errorf("%v", err)
 		logfile = "/tmp/.ecr/log/ecr-login.log"
 	}
 	// Clean the path to replace with OS-specific separators
-	logfile = filepath.Clean(logfile)
+	return loggerConfigFor(filepath.Clean(logfile), logLevel())
+}
+
+// logLevel returns the level set in ECR_LOG_LEVEL, or defaultLogLevel when it is unset or not a known level.
+func logLevel() string {
+	level := strings.ToLower(strings.TrimSpace(os.Getenv(logLevelEnv)))
+	if !logLevels[level] {
+		return defaultLogLevel
+	}
+	return level
+}
+
+func loggerConfigFor(logfile, level string) string {
 	config := `
-	<seelog type="asyncloop" minlevel="debug">
+	<seelog type="asyncloop" minlevel="` + level + `">
 		<outputs formatid="main">
 			<rollingfile filename="` + logfile + `" type="date"
 			 datepattern="2006-01-02-15" archivetype="none" maxrolls="2" />
@@ -0,0 +1,68 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	log "github.com/cihub/seelog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogLevel(t *testing.T) {
+	t.Setenv(logLevelEnv, "")
+	assert.Equal(t, defaultLogLevel, logLevel())
+
+	t.Setenv(logLevelEnv, " WARN ")
+	assert.Equal(t, "warn", logLevel())
+
+	t.Setenv(logLevelEnv, "verbose")
+	assert.Equal(t, defaultLogLevel, logLevel())
+}
+
+func TestLogLevelFiltersMessages(t *testing.T) {
+	assert.Equal(t, "debug message\nwarn message\n", logMessages(t, ""))
+	assert.Equal(t, "warn message\n", logMessages(t, "warn"))
+	assert.Equal(t, "", logMessages(t, "off"))
+}
+
+// logMessages logs one debug and one warn message through a logger configured with level and returns the messages
+// written to its log file, without their timestamp and level prefix.
+func logMessages(t *testing.T, level string) string {
+	dir := t.TempDir()
+	t.Setenv(logLevelEnv, level)
+	logger, err := log.LoggerFromConfigAsString(loggerConfigFor(filepath.Join(dir, "ecr-login.log"), logLevel()))
+	if !assert.Nil(t, err) {
+		return ""
+	}
+	logger.Debug("debug message")
+	logger.Warn("warn message")
+	logger.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	var messages string
+	for _, file := range files {
+		contents, err := ioutil.ReadFile(file)
+		assert.Nil(t, err)
+		for _, line := range strings.SplitAfter(string(contents), "\n") {
+			if i := strings.Index(line, "] "); i >= 0 {
+				messages += line[i+len("] "):]
+			}
+		}
+	}
+	return messages
+}
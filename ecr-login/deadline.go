@@ -0,0 +1,65 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ecr
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	log "github.com/cihub/seelog"
+)
+
+// ErrMaxRuntimeExceeded is returned by RunWithDeadline when the operation is still running at the deadline.
+var ErrMaxRuntimeExceeded = errors.New("exceeded the maximum runtime")
+
+// MaxRuntime returns the hard deadline of the process set with ECR_MAX_RUNTIME, as a duration such as 30s, or zero
+// when it is unset or invalid.
+func MaxRuntime() time.Duration {
+	value := os.Getenv("ECR_MAX_RUNTIME")
+	if value == "" {
+		return 0
+	}
+	maxRuntime, err := time.ParseDuration(value)
+	if err != nil || maxRuntime <= 0 {
+		log.Warnf("Ignoring invalid ECR_MAX_RUNTIME %q", value)
+		return 0
+	}
+	return maxRuntime
+}
+
+// RunWithDeadline runs operation and returns its error, or ErrMaxRuntimeExceeded if it has not returned after
+// maxRuntime. This bounds the whole invocation however the network, the metadata service and their retries stall.
+// A stalled operation is abandoned rather than cancelled, so callers are expected to exit soon after. A zero
+// maxRuntime runs operation without a deadline.
+func RunWithDeadline(maxRuntime time.Duration, operation func() error) error {
+	if maxRuntime <= 0 {
+		return operation()
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- operation()
+	}()
+
+	timer := time.NewTimer(maxRuntime)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		log.Errorf("Giving up after the maximum runtime of %s", maxRuntime)
+		return fmt.Errorf("%s %w of %s", programName, ErrMaxRuntimeExceeded, maxRuntime)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ecr
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunWithDeadlineAbortsStalledFetch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	factory := mock_api.NewMockClientFactory(ctrl)
+	client := mock_api.NewMockClient(ctrl)
+
+	helper := &ECRHelper{
+		ClientFactory: factory,
+	}
+
+	stalled := make(chan struct{})
+	defer close(stalled)
+	factory.EXPECT().NewClient(region).Return(client)
+	client.EXPECT().GetCredentials(registryID, image).Do(func(registry, image string) {
+		<-stalled
+	}).Return(nil, errors.New("test error"))
+
+	start := time.Now()
+	err := RunWithDeadline(50*time.Millisecond, func() error {
+		_, _, err := helper.Get(image)
+		return err
+	})
+	assert.True(t, errors.Is(err, ErrMaxRuntimeExceeded), "%v", err)
+	assert.True(t, time.Since(start) < time.Second, "took %s", time.Since(start))
+}
+
+func TestRunWithDeadlineReturnsResult(t *testing.T) {
+	expected := errors.New("test error")
+	assert.Equal(t, expected, RunWithDeadline(time.Minute, func() error { return expected }))
+	assert.Nil(t, RunWithDeadline(0, func() error { return nil }))
+}
+
+func TestMaxRuntime(t *testing.T) {
+	t.Setenv("ECR_MAX_RUNTIME", "")
+	assert.Equal(t, time.Duration(0), MaxRuntime())
+
+	t.Setenv("ECR_MAX_RUNTIME", "30s")
+	assert.Equal(t, 30*time.Second, MaxRuntime())
+
+	for _, value := range []string{"soon", "-1s"} {
+		t.Setenv("ECR_MAX_RUNTIME", value)
+		assert.Equal(t, time.Duration(0), MaxRuntime(), value)
+	}
+}
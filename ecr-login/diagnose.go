@@ -0,0 +1,86 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ecr
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api"
+	log "github.com/cihub/seelog"
+	"github.com/docker/docker-credential-helpers/credentials"
+)
+
+// sessionDescriber is implemented by client factories able to describe the sessions of their clients, such as
+// api.DefaultClientFactory.
+type sessionDescriber interface {
+	SessionInfo(region string) (api.SessionInfo, error)
+}
+
+// Diagnose writes what the helper resolves for serverURL, to attach to support requests: the registry, region,
+// partition and endpoint, the credential source, whether a token is cached, and the outcome of a request to ECR
+// bypassing the cache, including its request ID when ECR answered. Neither tokens nor secrets are written.
+func (self ECRHelper) Diagnose(serverURL string, writer io.Writer) error {
+	defer log.Flush()
+	matches := matchECRHost(serverURL, self.ClientFactory)
+	if len(matches) == 0 {
+		fmt.Fprintf(writer, "%s is not an Amazon ECR registry host\n", serverURL)
+		return credentials.ErrCredentialsNotFound
+	}
+	registry, region, domain := matches[1], matches[2], matches[3]
+
+	fmt.Fprintf(writer, "server URL:   %s\n", serverURL)
+	fmt.Fprintf(writer, "registry:     %s\n", registry)
+	fmt.Fprintf(writer, "region:       %s\n", region)
+	fmt.Fprintf(writer, "partition:    %s\n", partition(region, domain))
+
+	if describer, ok := self.ClientFactory.(sessionDescriber); ok {
+		info, err := describer.SessionInfo(region)
+		fmt.Fprintf(writer, "endpoint:     %s\n", info.Endpoint)
+		if err != nil {
+			fmt.Fprintf(writer, "credentials:  unavailable: %v\n", err)
+		} else {
+			fmt.Fprintf(writer, "credentials:  %s, access key %s\n", info.CredentialProvider, info.AccessKeyID)
+		}
+	}
+
+	client := self.ClientFactory.NewClient(region)
+	fmt.Fprintf(writer, "cached token: %t\n", client.IsCached(registry))
+
+	results, err := client.CheckPullPermissions(context.Background(), []string{registry})
+	if err == nil {
+		err = results[registry]
+	}
+	if err != nil {
+		fmt.Fprintf(writer, "GetAuthorizationToken: failed: %v\n", err)
+	} else {
+		fmt.Fprintf(writer, "GetAuthorizationToken: succeeded\n")
+	}
+	return nil
+}
+
+// partition returns the AWS partition of an ECR host in region under domain.
+func partition(region, domain string) string {
+	switch {
+	case domain == "localhost.localstack.cloud":
+		return "localstack"
+	case strings.HasSuffix(domain, ".cn"):
+		return "aws-cn"
+	case strings.HasPrefix(region, "us-gov-"):
+		return "aws-us-gov"
+	}
+	return "aws"
+}
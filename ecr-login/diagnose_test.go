@@ -0,0 +1,66 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ecr
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiagnose(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	factory := mock_api.NewMockClientFactory(ctrl)
+	client := mock_api.NewMockClient(ctrl)
+
+	helper := &ECRHelper{
+		ClientFactory: factory,
+	}
+
+	factory.EXPECT().NewClient(region).Return(client)
+	client.EXPECT().IsCached(registryID).Return(true)
+	client.EXPECT().CheckPullPermissions(gomock.Any(), []string{registryID}).Return(map[string]error{
+		registryID: errors.New("AccessDeniedException: denied\n\tstatus code: 400, request id: 1234"),
+	}, nil)
+
+	var output bytes.Buffer
+	err := helper.Diagnose(image, &output)
+	assert.Nil(t, err)
+	assert.Contains(t, output.String(), "registry:     "+registryID)
+	assert.Contains(t, output.String(), "region:       "+region)
+	assert.Contains(t, output.String(), "partition:    aws\n")
+	assert.Contains(t, output.String(), "cached token: true")
+	assert.Contains(t, output.String(), "request id: 1234")
+	assert.False(t, strings.Contains(output.String(), expectedPassword))
+}
+
+func TestDiagnoseNotECR(t *testing.T) {
+	var output bytes.Buffer
+	err := ECRHelper{}.Diagnose("registry.example.com", &output)
+	assert.NotNil(t, err)
+	assert.Contains(t, output.String(), "not an Amazon ECR registry")
+}
+
+func TestPartition(t *testing.T) {
+	assert.Equal(t, "aws", partition("us-west-2", "amazonaws.com"))
+	assert.Equal(t, "aws-cn", partition("cn-north-1", "amazonaws.com.cn"))
+	assert.Equal(t, "aws-us-gov", partition("us-gov-west-1", "amazonaws.com"))
+	assert.Equal(t, "localstack", partition("us-east-1", "localhost.localstack.cloud"))
+}
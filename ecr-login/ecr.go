@@ -15,20 +15,48 @@ package ecr
 
 import (
 	"errors"
+	"os"
 	"regexp"
+	"strings"
 
 	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache"
 	log "github.com/cihub/seelog"
 	"github.com/docker/docker-credential-helpers/credentials"
+	"github.com/mitchellh/go-homedir"
 )
 
 const programName = "docker-credential-ecr-login"
 
-var ecrPattern = regexp.MustCompile(`(^[a-zA-Z0-9][a-zA-Z0-9-_]*)\.dkr\.ecr\.([a-zA-Z0-9][a-zA-Z0-9-_]*)\.amazonaws\.com(\.cn)?`)
+var ecrPattern = regexp.MustCompile(`(^[a-zA-Z0-9][a-zA-Z0-9-_]*)\.dkr\.ecr\.([a-zA-Z0-9][a-zA-Z0-9-_]*)\.(amazonaws\.com(\.cn)?)`)
+
+// localStackPattern matches the registry hosts of LocalStack, which are only handled when the endpoint is overridden,
+// see matchECRHost.
+var localStackPattern = regexp.MustCompile(`(^[a-zA-Z0-9][a-zA-Z0-9-_]*)\.dkr\.ecr\.([a-zA-Z0-9][a-zA-Z0-9-_]*)\.(localhost\.localstack\.cloud)`)
 var notImplemented = errors.New("not implemented")
 
 type ECRHelper struct {
 	ClientFactory api.ClientFactory
+
+	// CandidateRegions are tried in order for custom hosts that do not name an Amazon ECR region, such as vanity
+	// hosts in front of a custom endpoint. Credentials come from the first region whose default registry has a
+	// proxy endpoint matching the host. Every region tried before it costs a call to ECR, so the most likely region
+	// should come first. It can also be set with AWS_ECR_CANDIDATE_REGIONS, as a comma separated list.
+	CandidateRegions []string
+
+	// RegionHints remembers the candidate region that last served a host, which is then tried first. It defaults to
+	// a file in ~/.ecr, unless AWS_ECR_DISABLE_CACHE is set.
+	RegionHints cache.RegionHints
+
+	// HostPattern, when set, is tried on server URLs that do not match the Amazon ECR host patterns, before
+	// CandidateRegions. Its "registry" and "region" named groups select the registry, whose own endpoint is then
+	// used whatever the host, which suits proxies and CDNs in front of a registry. Build it with CompileHostPattern,
+	// or set it with ECR_HOST_PATTERN.
+	HostPattern *regexp.Regexp
+
+	// PublicAuth authenticates pulls from Amazon ECR Public, which otherwise get no credentials so that Docker pulls
+	// them anonymously, without requiring AWS credentials. It can also be enabled by setting ECR_PUBLIC_AUTH.
+	PublicAuth bool
 }
 
 func (ECRHelper) Add(creds *credentials.Credentials) error {
@@ -42,24 +70,171 @@ func (ECRHelper) Delete(serverURL string) error {
 }
 
 func (self ECRHelper) Get(serverURL string) (string, string, error) {
+	creds, err := self.GetCredentials(serverURL)
+	if err != nil {
+		return "", "", err
+	}
+	return creds.Username, creds.Password, nil
+}
+
+// pullsAnonymously reports whether serverURL is the Amazon ECR Public registry and PublicAuth is not enabled, so that
+// it gets no credentials.
+func (self ECRHelper) pullsAnonymously(serverURL string) bool {
+	return api.IsPublicRegistry(serverURL) && !self.PublicAuth && os.Getenv("ECR_PUBLIC_AUTH") == ""
+}
+
+// GetCredentials returns the credentials for serverURL along with their expiry, for output formats richer than
+// the docker credential helper protocol.
+func (self ECRHelper) GetCredentials(serverURL string) (*api.Credentials, error) {
+	defer log.Flush()
+	if api.IsPublicRegistry(serverURL) {
+		if self.pullsAnonymously(serverURL) {
+			log.Debugf("Pulling %s anonymously", serverURL)
+			return nil, credentials.ErrCredentialsNotFound
+		}
+		creds, err := self.ClientFactory.NewClient(api.PublicRegion).GetPublicCredentials()
+		if err != nil {
+			log.Errorf("Error retrieving credentials: %v", err)
+			return nil, credentials.ErrCredentialsNotFound
+		}
+		return creds, nil
+	}
+	clients, registry, image, err := self.clients(serverURL)
+	if err != nil {
+		return nil, err
+	}
+	for _, client := range clients {
+		creds, err := client.GetCredentials(registry, image)
+		if err == nil {
+			self.rememberRegion(serverURL, client)
+			return creds, nil
+		}
+		log.Errorf("Error retrieving credentials: %v", err)
+	}
+	return nil, credentials.ErrCredentialsNotFound
+}
+
+// DescribeCredentials returns the non-secret metadata of the credentials for serverURL.
+func (self ECRHelper) DescribeCredentials(serverURL string) (api.CredentialInfo, error) {
 	defer log.Flush()
-	matches := ecrPattern.FindStringSubmatch(serverURL)
+	clients, registry, image, err := self.clients(serverURL)
+	if err != nil {
+		return api.CredentialInfo{}, err
+	}
+	for _, client := range clients {
+		info, err := client.DescribeCredentials(registry, image)
+		if err == nil {
+			self.rememberRegion(serverURL, client)
+			return info, nil
+		}
+		log.Errorf("Error retrieving credentials: %v", err)
+	}
+	return api.CredentialInfo{}, credentials.ErrCredentialsNotFound
+}
+
+// regionClient is a client along with the region it was built for. candidate is set for clients built for one of
+// the candidate regions.
+type regionClient struct {
+	api.Client
+	region    string
+	candidate bool
+}
+
+// clients returns the client for the region of serverURL, the registry ID encoded in its host, and the image to
+// request credentials for. Hosts matched by HostPattern request the registry itself rather than the image, since
+// their host is not the registry endpoint. Hosts that do not name a region get a client for each candidate region,
+// in order, starting with the region that last served the host, and an empty registry, which stands for the default
+// registry of the credentials.
+func (self ECRHelper) clients(serverURL string) ([]regionClient, string, string, error) {
+	matches := matchECRHost(serverURL, self.ClientFactory)
 	if len(matches) == 0 {
+		if registry, region, ok := matchHostPattern(self.HostPattern, serverURL); ok {
+			log.Debugf("Retrieving credentials for %s in %s (%s, matched by the host pattern)", registry, region, serverURL)
+			return []regionClient{{Client: self.ClientFactory.NewClient(region), region: region}}, registry, "", nil
+		}
+		if regions := self.candidateRegions(); len(regions) > 0 {
+			regions = preferRegion(regions, self.regionHints().Get(api.ParseImage(serverURL).Host))
+			log.Debugf("Retrieving credentials for %s in candidate regions %v", serverURL, regions)
+			var clients []regionClient
+			for _, region := range regions {
+				clients = append(clients, regionClient{Client: self.ClientFactory.NewClient(region), region: region, candidate: true})
+			}
+			return clients, "", serverURL, nil
+		}
 		log.Error(programName + " can only be used with Amazon EC2 Container Registry.")
-		return "", "", credentials.ErrCredentialsNotFound
+		return nil, "", "", credentials.ErrCredentialsNotFound
 	} else if len(matches) < 3 {
 		log.Error(serverURL + "is not a valid repository URI for Amazon EC2 Container Registry.")
-		return "", "", credentials.ErrCredentialsNotFound
+		return nil, "", "", credentials.ErrCredentialsNotFound
 	}
 
 	registry := matches[1]
 	region := matches[2]
 	log.Debugf("Retrieving credentials for %s in %s (%s)", registry, region, serverURL)
-	client := self.ClientFactory.NewClient(region)
-	user, pass, err := client.GetCredentials(registry, serverURL)
+	return []regionClient{{Client: self.ClientFactory.NewClient(region), region: region}}, registry, serverURL, nil
+}
+
+// matchECRHost returns the submatches of the Amazon ECR host pattern in serverURL: the registry, the region and the
+// domain. LocalStack hosts, which anyone can point at any address, only match when the endpoint of factory is
+// overridden with ClientOptions.Endpoint or AWS_ECR_ENDPOINT, as when testing against LocalStack.
+func matchECRHost(serverURL string, factory api.ClientFactory) []string {
+	if matches := ecrPattern.FindStringSubmatch(serverURL); len(matches) > 0 || !overridesEndpoint(factory) {
+		return matches
+	}
+	return localStackPattern.FindStringSubmatch(serverURL)
+}
+
+// overridesEndpoint reports whether the clients of factory call a custom endpoint rather than Amazon ECR.
+func overridesEndpoint(factory api.ClientFactory) bool {
+	if factory, ok := factory.(api.DefaultClientFactory); ok && factory.Options.Endpoint != "" {
+		return true
+	}
+	return os.Getenv("AWS_ECR_ENDPOINT") != ""
+}
+
+// preferRegion moves hint to the front of regions, if it is one of them.
+func preferRegion(regions []string, hint string) []string {
+	for i, region := range regions {
+		if region == hint {
+			return append([]string{hint}, append(append([]string(nil), regions[:i]...), regions[i+1:]...)...)
+		}
+	}
+	return regions
+}
+
+// regionHints returns RegionHints, or the hints stored in ~/.ecr when unset.
+func (self ECRHelper) regionHints() cache.RegionHints {
+	if self.RegionHints != nil {
+		return self.RegionHints
+	}
+	if os.Getenv("AWS_ECR_DISABLE_CACHE") != "" {
+		return cache.NewNullRegionHints()
+	}
+	cacheDir, err := homedir.Expand("~/.ecr")
 	if err != nil {
-		log.Errorf("Error retrieving credentials: %v", err)
-		return "", "", credentials.ErrCredentialsNotFound
+		log.Debugf("Could not expand region hints path: %s", err)
+		return cache.NewNullRegionHints()
+	}
+	return cache.NewFileRegionHints(cacheDir, "region-hints.json")
+}
+
+// rememberRegion records the region of client as the hint for the host of serverURL, when it is a candidate region.
+func (self ECRHelper) rememberRegion(serverURL string, client regionClient) {
+	if client.candidate {
+		self.regionHints().Set(api.ParseImage(serverURL).Host, client.region)
+	}
+}
+
+// candidateRegions returns CandidateRegions, or the regions listed in AWS_ECR_CANDIDATE_REGIONS when unset.
+func (self ECRHelper) candidateRegions() []string {
+	if len(self.CandidateRegions) > 0 {
+		return self.CandidateRegions
+	}
+	var regions []string
+	for _, region := range strings.Split(os.Getenv("AWS_ECR_CANDIDATE_REGIONS"), ",") {
+		if region = strings.TrimSpace(region); region != "" {
+			regions = append(regions, region)
+		}
 	}
-	return user, pass, nil
+	return regions
 }
@@ -14,9 +14,16 @@
 package ecr
 
 import (
+	"encoding/base64"
 	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache"
 	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/mocks"
 	"github.com/docker/docker-credential-helpers/credentials"
 	"github.com/golang/mock/gomock"
@@ -42,7 +49,10 @@ func TestGetSuccess(t *testing.T) {
 	}
 
 	factory.EXPECT().NewClient(region).Return(client)
-	client.EXPECT().GetCredentials(registryID, image).Return(expectedUsername, expectedPassword, nil)
+	client.EXPECT().GetCredentials(registryID, image).Return(&api.Credentials{
+		Username: expectedUsername,
+		Password: expectedPassword,
+	}, nil)
 
 	username, password, err := helper.Get(image)
 	assert.Nil(t, err)
@@ -61,7 +71,7 @@ func TestGetError(t *testing.T) {
 	}
 
 	factory.EXPECT().NewClient(region).Return(client)
-	client.EXPECT().GetCredentials(registryID, image).Return("", "", errors.New("test error"))
+	client.EXPECT().GetCredentials(registryID, image).Return(nil, errors.New("test error"))
 
 	username, password, err := helper.Get(image)
 	assert.Equal(t, credentials.ErrCredentialsNotFound, err)
@@ -69,6 +79,41 @@ func TestGetError(t *testing.T) {
 	assert.Empty(t, password)
 }
 
+func TestGetLocalStackHost(t *testing.T) {
+	t.Setenv("AWS_ECR_ENDPOINT", "http://localhost:4566")
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	factory := mock_api.NewMockClientFactory(ctrl)
+	client := mock_api.NewMockClient(ctrl)
+
+	helper := &ECRHelper{
+		ClientFactory: factory,
+	}
+
+	localStackImage := registryID + ".dkr.ecr." + region + ".localhost.localstack.cloud:4566/my-image"
+	factory.EXPECT().NewClient(region).Return(client)
+	client.EXPECT().GetCredentials(registryID, localStackImage).Return(&api.Credentials{
+		Username: expectedUsername,
+		Password: expectedPassword,
+	}, nil)
+
+	username, password, err := helper.Get(localStackImage)
+	assert.Nil(t, err)
+	assert.Equal(t, expectedUsername, username)
+	assert.Equal(t, expectedPassword, password)
+}
+
+func TestGetLocalStackHostWithoutEndpoint(t *testing.T) {
+	t.Setenv("AWS_ECR_ENDPOINT", "")
+	localStackImage := registryID + ".dkr.ecr." + region + ".localhost.localstack.cloud:4566/my-image"
+
+	_, _, err := (&ECRHelper{}).Get(localStackImage)
+	assert.Equal(t, credentials.ErrCredentialsNotFound, err, "LocalStack hosts are not handled against Amazon ECR")
+
+	helper := ECRHelper{ClientFactory: api.DefaultClientFactory{Options: api.ClientOptions{Endpoint: "http://localhost:4566"}}}
+	assert.NotEmpty(t, matchECRHost(localStackImage, helper.ClientFactory), "the endpoint option also enables LocalStack hosts")
+}
+
 func TestGetNoMatch(t *testing.T) {
 	helper := &ECRHelper{}
 
@@ -77,3 +122,209 @@ func TestGetNoMatch(t *testing.T) {
 	assert.Empty(t, username)
 	assert.Empty(t, password)
 }
+
+func TestGetPartitionRegions(t *testing.T) {
+	testCases := []struct {
+		serverURL string
+		region    string
+	}{
+		{registryID + ".dkr.ecr.us-gov-west-1.amazonaws.com/my-image", "us-gov-west-1"},
+		{registryID + ".dkr.ecr.cn-north-1.amazonaws.com.cn/my-image", "cn-north-1"},
+		{registryID + ".dkr.ecr.cn-northwest-1.amazonaws.com.cn/my-image", "cn-northwest-1"},
+	}
+
+	for _, testCase := range testCases {
+		ctrl := gomock.NewController(t)
+		factory := mock_api.NewMockClientFactory(ctrl)
+		client := mock_api.NewMockClient(ctrl)
+
+		helper := &ECRHelper{
+			ClientFactory: factory,
+		}
+
+		factory.EXPECT().NewClient(testCase.region).Return(client)
+		client.EXPECT().GetCredentials(registryID, testCase.serverURL).Return(&api.Credentials{
+			Username: expectedUsername,
+			Password: expectedPassword,
+		}, nil)
+
+		_, _, err := helper.Get(testCase.serverURL)
+		assert.Nil(t, err, testCase.serverURL)
+		ctrl.Finish()
+	}
+}
+
+func TestGetCandidateRegions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	factory := mock_api.NewMockClientFactory(ctrl)
+	firstClient := mock_api.NewMockClient(ctrl)
+	secondClient := mock_api.NewMockClient(ctrl)
+	vanityImage := "registry.example.com/my-image"
+
+	helper := &ECRHelper{
+		ClientFactory:    factory,
+		CandidateRegions: []string{"us-east-1", "eu-west-1"},
+		RegionHints:      cache.NewNullRegionHints(),
+	}
+
+	factory.EXPECT().NewClient("us-east-1").Return(firstClient)
+	factory.EXPECT().NewClient("eu-west-1").Return(secondClient)
+	firstClient.EXPECT().GetCredentials("", vanityImage).Return(nil, api.ErrProxyEndpointMismatch)
+	secondClient.EXPECT().GetCredentials("", vanityImage).Return(&api.Credentials{
+		Username: expectedUsername,
+		Password: expectedPassword,
+	}, nil)
+
+	username, password, err := helper.Get(vanityImage)
+	assert.Nil(t, err)
+	assert.Equal(t, expectedUsername, username)
+	assert.Equal(t, expectedPassword, password)
+}
+
+func TestGetCandidateRegionsFromEnvironment(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	factory := mock_api.NewMockClientFactory(ctrl)
+	client := mock_api.NewMockClient(ctrl)
+	vanityImage := "registry.example.com/my-image"
+	t.Setenv("AWS_ECR_CANDIDATE_REGIONS", " us-east-1 ,")
+
+	helper := &ECRHelper{
+		ClientFactory: factory,
+		RegionHints:   cache.NewNullRegionHints(),
+	}
+
+	factory.EXPECT().NewClient("us-east-1").Return(client)
+	client.EXPECT().GetCredentials("", vanityImage).Return(nil, api.ErrProxyEndpointMismatch)
+
+	_, _, err := helper.Get(vanityImage)
+	assert.Equal(t, credentials.ErrCredentialsNotFound, err)
+}
+
+func TestGetCandidateRegionsHint(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	factory := mock_api.NewMockClientFactory(ctrl)
+	firstClient := mock_api.NewMockClient(ctrl)
+	secondClient := mock_api.NewMockClient(ctrl)
+	vanityImage := "registry.example.com/my-image"
+
+	helper := &ECRHelper{
+		ClientFactory:    factory,
+		CandidateRegions: []string{"us-east-1", "eu-west-1"},
+		RegionHints:      cache.NewFileRegionHints(t.TempDir(), "region-hints.json"),
+	}
+	creds := &api.Credentials{Username: expectedUsername, Password: expectedPassword}
+
+	factory.EXPECT().NewClient("us-east-1").Return(firstClient).Times(2)
+	factory.EXPECT().NewClient("eu-west-1").Return(secondClient).Times(2)
+	gomock.InOrder(
+		firstClient.EXPECT().GetCredentials("", vanityImage).Return(nil, api.ErrProxyEndpointMismatch),
+		secondClient.EXPECT().GetCredentials("", vanityImage).Return(creds, nil),
+		// The region that served the host is tried first from then on, without calling the first one.
+		secondClient.EXPECT().GetCredentials("", vanityImage).Return(creds, nil),
+	)
+
+	for i := 0; i < 2; i++ {
+		_, password, err := helper.Get(vanityImage)
+		assert.Nil(t, err)
+		assert.Equal(t, expectedPassword, password)
+	}
+	assert.Equal(t, "eu-west-1", helper.RegionHints.Get("registry.example.com"))
+}
+
+func TestPreferRegion(t *testing.T) {
+	regions := []string{"us-east-1", "eu-west-1", "us-west-2"}
+	assert.Equal(t, []string{"us-west-2", "us-east-1", "eu-west-1"}, preferRegion(regions, "us-west-2"))
+	assert.Equal(t, regions, preferRegion(regions, "ap-south-1"), "hints outside the candidates are ignored")
+	assert.Equal(t, regions, preferRegion(regions, ""))
+	assert.Equal(t, []string{"us-east-1", "eu-west-1", "us-west-2"}, regions, "the candidates are left untouched")
+}
+
+func TestGetPublicRegistryAnonymous(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	factory := mock_api.NewMockClientFactory(ctrl)
+
+	helper := &ECRHelper{ClientFactory: factory}
+
+	_, _, err := helper.Get("public.ecr.aws/nginx/nginx:latest")
+	assert.Equal(t, credentials.ErrCredentialsNotFound, err, "public pulls are anonymous without calling AWS")
+}
+
+func TestGetPublicRegistryAuthenticated(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	factory := mock_api.NewMockClientFactory(ctrl)
+	client := mock_api.NewMockClient(ctrl)
+
+	factory.EXPECT().NewClient(api.PublicRegion).Return(client).Times(2)
+	client.EXPECT().GetPublicCredentials().Return(&api.Credentials{
+		Username: expectedUsername,
+		Password: expectedPassword,
+	}, nil).Times(2)
+
+	helper := &ECRHelper{ClientFactory: factory, PublicAuth: true}
+	username, password, err := helper.Get("public.ecr.aws")
+	assert.Nil(t, err)
+	assert.Equal(t, expectedUsername, username)
+	assert.Equal(t, expectedPassword, password)
+
+	t.Setenv("ECR_PUBLIC_AUTH", "true")
+	_, password, err = ECRHelper{ClientFactory: factory}.Get("public.ecr.aws/nginx/nginx")
+	assert.Nil(t, err)
+	assert.Equal(t, expectedPassword, password)
+}
+
+// allowedRegionsHelper returns a helper whose clients only work in us-west-2, calling an ECR stub that answers
+// every request with a token for proxyEndpoint. The returned counter reports the calls to the stub.
+func allowedRegionsHelper(t *testing.T, proxyEndpoint string) (*ECRHelper, *int) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "SECRET")
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_ECR_DISABLE_CACHE", "true")
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		token := base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword))
+		fmt.Fprintf(w, `{"authorizationData":[{"authorizationToken":%q,"expiresAt":%d,"proxyEndpoint":%q}]}`,
+			token, time.Now().Add(12*time.Hour).Unix(), proxyEndpoint)
+	}))
+	t.Cleanup(server.Close)
+
+	return &ECRHelper{ClientFactory: api.DefaultClientFactory{Options: api.ClientOptions{
+		Endpoint:          server.URL,
+		AllowedRegions:    []string{"us-west-2"},
+		AllowCrossAccount: true,
+	}}}, &calls
+}
+
+func TestGetAllowedRegionsFromHost(t *testing.T) {
+	allowedHost := registryID + ".dkr.ecr.us-west-2.amazonaws.com"
+	helper, calls := allowedRegionsHelper(t, "https://"+allowedHost)
+
+	_, password, err := helper.Get(allowedHost + "/my-image")
+	assert.Nil(t, err)
+	assert.Equal(t, expectedPassword, password)
+
+	_, _, err = helper.Get(registryID + ".dkr.ecr.eu-west-1.amazonaws.com/my-image")
+	assert.Equal(t, credentials.ErrCredentialsNotFound, err)
+	assert.Equal(t, 1, *calls, "ECR is not called in a region outside the allowlist")
+}
+
+func TestGetAllowedRegionsFromEnvironment(t *testing.T) {
+	helper, calls := allowedRegionsHelper(t, "https://registry.example.com")
+
+	t.Setenv("AWS_ECR_CANDIDATE_REGIONS", "eu-west-1,us-west-2")
+	_, password, err := helper.Get("registry.example.com/my-image")
+	assert.Nil(t, err)
+	assert.Equal(t, expectedPassword, password)
+	assert.Equal(t, 1, *calls, "the candidate region outside the allowlist is skipped without calling ECR")
+
+	t.Setenv("AWS_ECR_CANDIDATE_REGIONS", "eu-west-1")
+	_, _, err = helper.Get("registry.example.com/my-image")
+	assert.Equal(t, credentials.ErrCredentialsNotFound, err)
+	assert.Equal(t, 1, *calls)
+}
@@ -0,0 +1,90 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ecr
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api"
+)
+
+// Shells of the env command.
+const (
+	// ShellSh is POSIX sh and compatible shells such as bash and zsh.
+	ShellSh = "sh"
+	// ShellFish is the fish shell.
+	ShellFish = "fish"
+	// ShellPowerShell is PowerShell.
+	ShellPowerShell = "powershell"
+)
+
+// ErrUnknownShell is returned, wrapped with the shell, for shells other than the Shell constants.
+var ErrUnknownShell = errors.New("unknown shell")
+
+// Env writes the credentials for serverURL to writer as commands setting ECR_USERNAME and ECR_PASSWORD in shell,
+// for scripts to evaluate.
+func (self ECRHelper) Env(serverURL string, writer io.Writer, shell string) error {
+	if _, err := FormatEnv(&api.Credentials{}, shell); err != nil {
+		return err
+	}
+
+	creds, err := self.GetCredentials(serverURL)
+	if err != nil {
+		return err
+	}
+
+	output, err := FormatEnv(creds, shell)
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(output)
+	return err
+}
+
+// FormatEnv returns the commands setting ECR_USERNAME and ECR_PASSWORD to the credentials in shell, with the values
+// quoted so that they are never expanded.
+func FormatEnv(creds *api.Credentials, shell string) ([]byte, error) {
+	var format string
+	var quote func(string) string
+	switch shell {
+	case ShellSh:
+		format, quote = "export %s=%s\n", quoteSh
+	case ShellFish:
+		format, quote = "set -gx %s %s\n", quoteFish
+	case ShellPowerShell:
+		format, quote = "$env:%s = %s\n", quotePowerShell
+	default:
+		return nil, fmt.Errorf("%w %q, expected %s, %s or %s", ErrUnknownShell, shell, ShellSh, ShellFish, ShellPowerShell)
+	}
+	return []byte(fmt.Sprintf(format, "ECR_USERNAME", quote(creds.Username)) +
+		fmt.Sprintf(format, "ECR_PASSWORD", quote(creds.Password))), nil
+}
+
+// quoteSh single-quotes value for sh, where nothing is special within single quotes but the closing quote.
+func quoteSh(value string) string {
+	return "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
+}
+
+// quoteFish single-quotes value for fish, where backslashes and single quotes are escaped with a backslash.
+func quoteFish(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(value) + "'"
+}
+
+// quotePowerShell single-quotes value for PowerShell, where single quotes are doubled.
+func quotePowerShell(value string) string {
+	return "'" + strings.Replace(value, "'", "''", -1) + "'"
+}
@@ -0,0 +1,79 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ecr
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+var trickyCredentials = &api.Credentials{Username: "AWS", Password: `pa'ss\$word`}
+
+func TestFormatEnvSh(t *testing.T) {
+	output, err := FormatEnv(trickyCredentials, ShellSh)
+	assert.Nil(t, err)
+	assert.Equal(t, "export ECR_USERNAME='AWS'\nexport ECR_PASSWORD='pa'\\''ss\\$word'\n", string(output))
+}
+
+func TestFormatEnvFish(t *testing.T) {
+	output, err := FormatEnv(trickyCredentials, ShellFish)
+	assert.Nil(t, err)
+	assert.Equal(t, "set -gx ECR_USERNAME 'AWS'\nset -gx ECR_PASSWORD 'pa\\'ss\\\\$word'\n", string(output))
+}
+
+func TestFormatEnvPowerShell(t *testing.T) {
+	output, err := FormatEnv(trickyCredentials, ShellPowerShell)
+	assert.Nil(t, err)
+	assert.Equal(t, "$env:ECR_USERNAME = 'AWS'\n$env:ECR_PASSWORD = 'pa''ss\\$word'\n", string(output))
+}
+
+func TestFormatEnvUnknownShell(t *testing.T) {
+	_, err := FormatEnv(trickyCredentials, "csh")
+	assert.True(t, errors.Is(err, ErrUnknownShell))
+}
+
+func TestEnv(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	factory := mock_api.NewMockClientFactory(ctrl)
+	client := mock_api.NewMockClient(ctrl)
+
+	helper := &ECRHelper{
+		ClientFactory: factory,
+	}
+
+	factory.EXPECT().NewClient(region).Return(client)
+	client.EXPECT().GetCredentials(registryID, image).Return(&api.Credentials{
+		Username: expectedUsername,
+		Password: expectedPassword,
+	}, nil)
+
+	var output bytes.Buffer
+	err := helper.Env(image, &output, ShellSh)
+	assert.Nil(t, err)
+	assert.Equal(t, "export ECR_USERNAME='username'\nexport ECR_PASSWORD='password'\n", output.String())
+}
+
+func TestEnvUnknownShellSkipsRetrieval(t *testing.T) {
+	var output bytes.Buffer
+	err := ECRHelper{}.Env(image, &output, "csh")
+	assert.True(t, errors.Is(err, ErrUnknownShell))
+	assert.Empty(t, output.String())
+}
@@ -0,0 +1,123 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ecr
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api"
+	"github.com/docker/docker-credential-helpers/credentials"
+)
+
+// Output formats of the get command.
+const (
+	// FormatDocker is the JSON of the docker credential helper protocol.
+	FormatDocker = "docker"
+	// FormatJSON is the JSON of api.Credentials, including the expiry of the token.
+	FormatJSON = "json"
+	// FormatAuthPair is username:password.
+	FormatAuthPair = "authpair"
+	// FormatBase64 is the base64 encoded username:password used in the auths of a docker config.json.
+	FormatBase64 = "base64"
+)
+
+// ErrUnknownFormat is returned, wrapped with the format, for output formats other than the Format constants.
+var ErrUnknownFormat = errors.New("unknown output format")
+
+// GetFormatted reads a server URL from reader like the get command of the docker credential helper protocol, and
+// writes its credentials to writer in format.
+func (self ECRHelper) GetFormatted(reader io.Reader, writer io.Writer, format string) error {
+	serverURL, err := readServerURL(reader)
+	if err != nil {
+		return err
+	}
+
+	creds, err := self.GetCredentials(serverURL)
+	if err != nil {
+		return err
+	}
+
+	output, err := FormatCredentials(creds, format)
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(output)
+	return err
+}
+
+// Describe reads a server URL from reader like GetFormatted, and writes the non-secret metadata of its credentials
+// to writer as JSON.
+func (self ECRHelper) Describe(reader io.Reader, writer io.Writer) error {
+	serverURL, err := readServerURL(reader)
+	if err != nil {
+		return err
+	}
+
+	info, err := self.DescribeCredentials(serverURL)
+	if err != nil {
+		return err
+	}
+
+	output, err := encodeJSON(info)
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(output)
+	return err
+}
+
+func readServerURL(reader io.Reader) (string, error) {
+	scanner := bufio.NewScanner(reader)
+
+	buffer := new(bytes.Buffer)
+	for scanner.Scan() {
+		buffer.Write(scanner.Bytes())
+	}
+
+	if err := scanner.Err(); err != nil && err != io.EOF {
+		return "", err
+	}
+	return strings.TrimSpace(buffer.String()), nil
+}
+
+// FormatCredentials returns creds in format, followed by a newline.
+func FormatCredentials(creds *api.Credentials, format string) ([]byte, error) {
+	authPair := creds.Username + ":" + creds.Password
+	switch format {
+	case FormatDocker:
+		return encodeJSON(credentials.Credentials{Username: creds.Username, Secret: creds.Password})
+	case FormatJSON:
+		return encodeJSON(creds)
+	case FormatAuthPair:
+		return []byte(authPair + "\n"), nil
+	case FormatBase64:
+		return []byte(base64.StdEncoding.EncodeToString([]byte(authPair)) + "\n"), nil
+	}
+	return nil, fmt.Errorf("%w %q, expected %s, %s, %s or %s", ErrUnknownFormat, format, FormatDocker, FormatJSON, FormatAuthPair, FormatBase64)
+}
+
+func encodeJSON(value interface{}) ([]byte, error) {
+	buffer := new(bytes.Buffer)
+	if err := json.NewEncoder(buffer).Encode(value); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,105 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ecr
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatCredentials(t *testing.T) {
+	creds := &api.Credentials{
+		Username:     expectedUsername,
+		Password:     expectedPassword,
+		ExpiresAt:    time.Date(2016, 7, 1, 12, 0, 0, 0, time.UTC),
+		RefreshAfter: time.Date(2016, 7, 1, 6, 0, 0, 0, time.UTC),
+	}
+
+	testCases := []struct {
+		format string
+		output string
+	}{
+		{FormatDocker, `{"ServerURL":"","Username":"username","Secret":"password"}` + "\n"},
+		{FormatJSON, `{"username":"username","password":"password","expiresAt":"2016-07-01T12:00:00Z","refreshAfter":"2016-07-01T06:00:00Z","proxyEndpoint":""}` + "\n"},
+		{FormatAuthPair, "username:password\n"},
+		{FormatBase64, "dXNlcm5hbWU6cGFzc3dvcmQ=\n"},
+	}
+
+	for _, testCase := range testCases {
+		output, err := FormatCredentials(creds, testCase.format)
+		assert.Nil(t, err, testCase.format)
+		assert.Equal(t, testCase.output, string(output), testCase.format)
+	}
+}
+
+func TestFormatCredentialsUnknownFormat(t *testing.T) {
+	output, err := FormatCredentials(&api.Credentials{}, "yaml")
+	assert.True(t, errors.Is(err, ErrUnknownFormat))
+	assert.Nil(t, output)
+}
+
+func TestGetFormatted(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	factory := mock_api.NewMockClientFactory(ctrl)
+	client := mock_api.NewMockClient(ctrl)
+
+	helper := &ECRHelper{
+		ClientFactory: factory,
+	}
+
+	factory.EXPECT().NewClient(region).Return(client)
+	client.EXPECT().GetCredentials(registryID, image).Return(&api.Credentials{
+		Username: expectedUsername,
+		Password: expectedPassword,
+	}, nil)
+
+	var output bytes.Buffer
+	err := helper.GetFormatted(strings.NewReader(image+"\n"), &output, FormatAuthPair)
+	assert.Nil(t, err)
+	assert.Equal(t, "username:password\n", output.String())
+}
+
+func TestDescribe(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	factory := mock_api.NewMockClientFactory(ctrl)
+	client := mock_api.NewMockClient(ctrl)
+
+	helper := &ECRHelper{
+		ClientFactory: factory,
+	}
+
+	factory.EXPECT().NewClient(region).Return(client)
+	client.EXPECT().DescribeCredentials(registryID, image).Return(api.CredentialInfo{
+		Registry:      registryID,
+		Username:      expectedUsername,
+		ProxyEndpoint: "https://" + registryID + ".dkr.ecr." + region + ".amazonaws.com",
+		ExpiresAt:     time.Date(2016, 7, 1, 12, 0, 0, 0, time.UTC),
+		RefreshAfter:  time.Date(2016, 7, 1, 6, 0, 0, 0, time.UTC),
+	}, nil)
+
+	var output bytes.Buffer
+	err := helper.Describe(strings.NewReader(image), &output)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"registry":"123456789012","username":"username","proxyEndpoint":"https://123456789012.dkr.ecr.my-region-1.amazonaws.com","expiresAt":"2016-07-01T12:00:00Z","refreshAfter":"2016-07-01T06:00:00Z"}`+"\n", output.String())
+}
@@ -0,0 +1,68 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ecr
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// ErrInvalidHostPattern is returned, wrapped with the reason, for host patterns that do not compile or lack the
+// registry and region named groups.
+var ErrInvalidHostPattern = errors.New("invalid host pattern")
+
+// CompileHostPattern compiles expr for ECRHelper.HostPattern, checking that it has "registry" and "region" named
+// groups.
+func CompileHostPattern(expr string) (*regexp.Regexp, error) {
+	pattern, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidHostPattern, err)
+	}
+	for _, group := range []string{"registry", "region"} {
+		if pattern.SubexpIndex(group) < 0 {
+			return nil, fmt.Errorf("%w: %q has no (?P<%s>...) group", ErrInvalidHostPattern, expr, group)
+		}
+	}
+	return pattern, nil
+}
+
+// HostPatternFromEnvironment compiles the host pattern in ECR_HOST_PATTERN, returning nil when it is unset.
+func HostPatternFromEnvironment() (*regexp.Regexp, error) {
+	expr := os.Getenv("ECR_HOST_PATTERN")
+	if expr == "" {
+		return nil, nil
+	}
+	pattern, err := CompileHostPattern(expr)
+	if err != nil {
+		return nil, fmt.Errorf("ECR_HOST_PATTERN: %w", err)
+	}
+	return pattern, nil
+}
+
+// matchHostPattern returns the registry and region pattern extracts from serverURL. ok is false when pattern is nil,
+// does not match, or matches with an empty registry or region.
+func matchHostPattern(pattern *regexp.Regexp, serverURL string) (registry, region string, ok bool) {
+	if pattern == nil {
+		return "", "", false
+	}
+	matches := pattern.FindStringSubmatch(serverURL)
+	if matches == nil {
+		return "", "", false
+	}
+	registry = matches[pattern.SubexpIndex("registry")]
+	region = matches[pattern.SubexpIndex("region")]
+	return registry, region, registry != "" && region != ""
+}
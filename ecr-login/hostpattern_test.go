@@ -0,0 +1,81 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ecr
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/mocks"
+	"github.com/docker/docker-credential-helpers/credentials"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetHostPattern(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	factory := mock_api.NewMockClientFactory(ctrl)
+	client := mock_api.NewMockClient(ctrl)
+
+	hostPattern, err := CompileHostPattern(`^(?P<registry>[0-9]{12})-(?P<region>[a-z0-9-]+)\.cdn\.example\.com`)
+	if !assert.Nil(t, err) {
+		return
+	}
+	helper := &ECRHelper{
+		ClientFactory: factory,
+		HostPattern:   hostPattern,
+	}
+
+	factory.EXPECT().NewClient(region).Return(client)
+	client.EXPECT().GetCredentials(registryID, "").Return(&api.Credentials{
+		Username: expectedUsername,
+		Password: expectedPassword,
+	}, nil)
+
+	username, password, err := helper.Get(registryID + "-" + region + ".cdn.example.com/my-image")
+	assert.Nil(t, err)
+	assert.Equal(t, expectedUsername, username)
+	assert.Equal(t, expectedPassword, password)
+}
+
+func TestGetHostPatternNoMatch(t *testing.T) {
+	hostPattern, err := CompileHostPattern(`^(?P<registry>[0-9]{12})-(?P<region>[a-z0-9-]+)\.cdn\.example\.com`)
+	if !assert.Nil(t, err) {
+		return
+	}
+	helper := &ECRHelper{HostPattern: hostPattern}
+
+	_, _, err = helper.Get("registry.example.com/my-image")
+	assert.Equal(t, credentials.ErrCredentialsNotFound, err)
+}
+
+func TestCompileHostPatternValidation(t *testing.T) {
+	for _, expr := range []string{`(?P<registry>[0-9]+`, `(?P<registry>[0-9]+)\.example\.com`, `(?P<region>[a-z0-9-]+)\.example\.com`} {
+		_, err := CompileHostPattern(expr)
+		assert.True(t, errors.Is(err, ErrInvalidHostPattern), expr)
+	}
+}
+
+func TestHostPatternFromEnvironment(t *testing.T) {
+	t.Setenv("ECR_HOST_PATTERN", "")
+	hostPattern, err := HostPatternFromEnvironment()
+	assert.Nil(t, err)
+	assert.Nil(t, hostPattern)
+
+	t.Setenv("ECR_HOST_PATTERN", `(?P<registry>[0-9]+)`)
+	_, err = HostPatternFromEnvironment()
+	assert.True(t, errors.Is(err, ErrInvalidHostPattern))
+}
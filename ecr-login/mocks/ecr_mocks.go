@@ -17,6 +17,8 @@
 package mock_api
 
 import (
+	context "context"
+
 	api "github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api"
 	gomock "github.com/golang/mock/gomock"
 )
@@ -73,14 +75,98 @@ func (_m *MockClient) EXPECT() *_MockClientRecorder {
 	return _m.recorder
 }
 
-func (_m *MockClient) GetCredentials(_param0 string, _param1 string) (string, string, error) {
+func (_m *MockClient) CheckPullPermissions(_param0 context.Context, _param1 []string) (map[string]error, error) {
+	ret := _m.ctrl.Call(_m, "CheckPullPermissions", _param0, _param1)
+	ret0, _ := ret[0].(map[string]error)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockClientRecorder) CheckPullPermissions(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "CheckPullPermissions", arg0, arg1)
+}
+
+func (_m *MockClient) DescribeCredentials(_param0 string, _param1 string) (api.CredentialInfo, error) {
+	ret := _m.ctrl.Call(_m, "DescribeCredentials", _param0, _param1)
+	ret0, _ := ret[0].(api.CredentialInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockClientRecorder) DescribeCredentials(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "DescribeCredentials", arg0, arg1)
+}
+
+func (_m *MockClient) GenerateContainerdHostConfig(_param0 string, _param1 string) ([]byte, error) {
+	ret := _m.ctrl.Call(_m, "GenerateContainerdHostConfig", _param0, _param1)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockClientRecorder) GenerateContainerdHostConfig(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GenerateContainerdHostConfig", arg0, arg1)
+}
+
+func (_m *MockClient) GenerateDockerAuthConfig(_param0 string, _param1 string) ([]byte, error) {
+	ret := _m.ctrl.Call(_m, "GenerateDockerAuthConfig", _param0, _param1)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockClientRecorder) GenerateDockerAuthConfig(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GenerateDockerAuthConfig", arg0, arg1)
+}
+
+func (_m *MockClient) GetCredentials(_param0 string, _param1 string) (*api.Credentials, error) {
 	ret := _m.ctrl.Call(_m, "GetCredentials", _param0, _param1)
-	ret0, _ := ret[0].(string)
-	ret1, _ := ret[1].(string)
-	ret2, _ := ret[2].(error)
-	return ret0, ret1, ret2
+	ret0, _ := ret[0].(*api.Credentials)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 func (_mr *_MockClientRecorder) GetCredentials(arg0, arg1 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetCredentials", arg0, arg1)
 }
+
+func (_m *MockClient) GetPublicCredentials() (*api.Credentials, error) {
+	ret := _m.ctrl.Call(_m, "GetPublicCredentials")
+	ret0, _ := ret[0].(*api.Credentials)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockClientRecorder) GetPublicCredentials() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetPublicCredentials")
+}
+
+func (_m *MockClient) IsCached(_param0 string) bool {
+	ret := _m.ctrl.Call(_m, "IsCached", _param0)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+func (_mr *_MockClientRecorder) IsCached(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "IsCached", arg0)
+}
+
+func (_m *MockClient) ThrottleState() api.ThrottleState {
+	ret := _m.ctrl.Call(_m, "ThrottleState")
+	ret0, _ := ret[0].(api.ThrottleState)
+	return ret0
+}
+
+func (_mr *_MockClientRecorder) ThrottleState() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "ThrottleState")
+}
+
+func (_m *MockClient) WriteDockerConfig(_param0 string, _param1 []string) error {
+	ret := _m.ctrl.Call(_m, "WriteDockerConfig", _param0, _param1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockClientRecorder) WriteDockerConfig(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "WriteDockerConfig", arg0, arg1)
+}
@@ -0,0 +1,150 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ecr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api"
+	log "github.com/cihub/seelog"
+	"github.com/mitchellh/go-homedir"
+)
+
+// ErrPrimeFailed is returned, wrapped with the number of failures, when Prime could not fetch credentials for some
+// of the server URLs.
+var ErrPrimeFailed = errors.New("could not prime credentials")
+
+// Prime fetches the credentials for each of serverURLs, so that they are cached in the configured cache for the
+// docker pulls that follow, typically at the start of a CI job. The outcome for each server URL is written to
+// writer. Every server URL is tried even when some fail. Amazon ECR Public is skipped unless PublicAuth is enabled,
+// as it is pulled anonymously without credentials.
+func (self ECRHelper) Prime(serverURLs []string, writer io.Writer) error {
+	failures := 0
+	for _, serverURL := range serverURLs {
+		if self.pullsAnonymously(serverURL) {
+			fmt.Fprintf(writer, "%s: skipped, pulled anonymously\n", serverURL)
+			continue
+		}
+		creds, err := self.GetCredentials(serverURL)
+		if err != nil {
+			failures++
+			fmt.Fprintf(writer, "%s: failed: %v\n", serverURL, err)
+			continue
+		}
+		fmt.Fprintf(writer, "%s: primed, expires at %s\n", serverURL, creds.ExpiresAt.Format(time.RFC3339))
+	}
+	if failures > 0 {
+		return fmt.Errorf("%w for %d of %d server URLs", ErrPrimeFailed, failures, len(serverURLs))
+	}
+	return nil
+}
+
+// WriteDockerConfig writes a docker config.json to path with fresh credentials for each of serverURLs, for build
+// tools such as Kaniko or BuildKit that read their credentials once at start instead of calling a credential
+// helper. Each server URL is resolved like Get, so registries of several regions can go into one file, keyed by the
+// host of the server URL. The outcome for each server URL is written to writer. Server URLs that cannot be fetched
+// are left out and reported in an error wrapping api.ErrRegistriesNotFetched; nothing is written if none can be.
+func (self ECRHelper) WriteDockerConfig(path string, serverURLs []string, writer io.Writer) error {
+	auths := map[string]*api.Credentials{}
+	failures := 0
+	for _, serverURL := range serverURLs {
+		creds, err := self.GetCredentials(serverURL)
+		if err != nil {
+			failures++
+			fmt.Fprintf(writer, "%s: failed: %v\n", serverURL, err)
+			continue
+		}
+		auths[api.ParseImage(serverURL).Host] = creds
+		fmt.Fprintf(writer, "%s: written, expires at %s\n", serverURL, creds.ExpiresAt.Format(time.RFC3339))
+	}
+
+	var notFetched error
+	if failures > 0 {
+		notFetched = fmt.Errorf("%w: %d of %d server URLs", api.ErrRegistriesNotFetched, failures, len(serverURLs))
+		if len(auths) == 0 {
+			return notFetched
+		}
+	}
+	if err := api.WriteDockerConfigFile(path, auths); err != nil {
+		return err
+	}
+	return notFetched
+}
+
+// dockerConfigFile is the subset of the docker config.json naming registries.
+type dockerConfigFile struct {
+	Auths       map[string]json.RawMessage `json:"auths"`
+	CredHelpers map[string]string          `json:"credHelpers"`
+}
+
+// DockerConfigRegistries returns, sorted, the registry hosts listed in the docker config.json at path: Amazon ECR
+// hosts in its auths, and hosts with ecr-login as their credHelpers entry. An empty path reads config.json in
+// DOCKER_CONFIG, or in ~/.docker when unset.
+func DockerConfigRegistries(path string) ([]string, error) {
+	if path == "" {
+		dir := os.Getenv("DOCKER_CONFIG")
+		if dir == "" {
+			var err error
+			if dir, err = homedir.Expand("~/.docker"); err != nil {
+				return nil, err
+			}
+		}
+		path = filepath.Join(dir, "config.json")
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config dockerConfigFile
+	if err := json.Unmarshal(contents, &config); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	hosts := map[string]bool{}
+	for host := range config.Auths {
+		if host = registryHost(host); len(matchECRHost(host, nil)) > 0 {
+			hosts[host] = true
+		}
+	}
+	for host, helper := range config.CredHelpers {
+		if helper == "ecr-login" {
+			hosts[registryHost(host)] = true
+		}
+	}
+	var registries []string
+	for host := range hosts {
+		registries = append(registries, host)
+	}
+	sort.Strings(registries)
+	log.Debugf("Found registries %v in %s", registries, path)
+	return registries, nil
+}
+
+// registryHost strips the scheme and trailing slash docker config.json keys may have, such as https://host/.
+func registryHost(key string) string {
+	if i := strings.Index(key, "://"); i >= 0 {
+		key = key[i+len("://"):]
+	}
+	return strings.TrimSuffix(key, "/")
+}
@@ -0,0 +1,171 @@
+// Copyright 2016 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ecr
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrime(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	factory := mock_api.NewMockClientFactory(ctrl)
+	client := mock_api.NewMockClient(ctrl)
+
+	helper := &ECRHelper{ClientFactory: factory}
+	otherImage := "210987654321.dkr.ecr." + region + ".amazonaws.com"
+
+	factory.EXPECT().NewClient(region).Return(client).Times(2)
+	client.EXPECT().GetCredentials(registryID, image).Return(&api.Credentials{
+		Username:  expectedUsername,
+		Password:  expectedPassword,
+		ExpiresAt: time.Date(2016, 7, 1, 12, 0, 0, 0, time.UTC),
+	}, nil)
+	client.EXPECT().GetCredentials("210987654321", otherImage).Return(nil, errors.New("access denied"))
+
+	var output bytes.Buffer
+	err := helper.Prime([]string{image, otherImage}, &output)
+	assert.True(t, errors.Is(err, ErrPrimeFailed))
+	assert.Contains(t, err.Error(), "1 of 2")
+	assert.Contains(t, output.String(), image+": primed, expires at 2016-07-01T12:00:00Z\n")
+	assert.Contains(t, output.String(), otherImage+": failed: ")
+	assert.NotContains(t, output.String(), expectedPassword)
+}
+
+func TestPrimeSuccess(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	factory := mock_api.NewMockClientFactory(ctrl)
+	client := mock_api.NewMockClient(ctrl)
+
+	helper := &ECRHelper{ClientFactory: factory}
+	factory.EXPECT().NewClient(region).Return(client)
+	client.EXPECT().GetCredentials(registryID, image).Return(&api.Credentials{Password: expectedPassword}, nil)
+
+	assert.Nil(t, helper.Prime([]string{image}, ioutil.Discard))
+}
+
+func TestPrimeSkipsPublicRegistry(t *testing.T) {
+	t.Setenv("ECR_PUBLIC_AUTH", "")
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	factory := mock_api.NewMockClientFactory(ctrl)
+	client := mock_api.NewMockClient(ctrl)
+
+	helper := &ECRHelper{ClientFactory: factory}
+	factory.EXPECT().NewClient(region).Return(client)
+	client.EXPECT().GetCredentials(registryID, image).Return(&api.Credentials{Password: expectedPassword}, nil)
+
+	var output bytes.Buffer
+	assert.Nil(t, helper.Prime([]string{api.PublicRegistryHost, image}, &output))
+	assert.Contains(t, output.String(), api.PublicRegistryHost+": skipped, pulled anonymously\n")
+
+	// With PublicAuth the public registry is primed like any other.
+	helper.PublicAuth = true
+	factory.EXPECT().NewClient(api.PublicRegion).Return(client)
+	client.EXPECT().GetPublicCredentials().Return(&api.Credentials{Password: expectedPassword}, nil)
+	output.Reset()
+	assert.Nil(t, helper.Prime([]string{api.PublicRegistryHost}, &output))
+	assert.Contains(t, output.String(), api.PublicRegistryHost+": primed")
+}
+
+func TestDockerConfigRegistries(t *testing.T) {
+	dir := t.TempDir()
+	config := `{
+	"auths": {
+		"https://123456789012.dkr.ecr.us-west-2.amazonaws.com/": {},
+		"210987654321.dkr.ecr.eu-west-1.amazonaws.com": {"auth": "dXNlcjpwYXNz"},
+		"registry.example.com": {}
+	},
+	"credHelpers": {
+		"123456789012.dkr.ecr.us-west-2.amazonaws.com": "ecr-login",
+		"mirror.example.com": "ecr-login",
+		"gcr.io": "gcloud"
+	}
+}`
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "config.json"), []byte(config), 0600))
+	t.Setenv("DOCKER_CONFIG", dir)
+
+	registries, err := DockerConfigRegistries("")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"123456789012.dkr.ecr.us-west-2.amazonaws.com",
+		"210987654321.dkr.ecr.eu-west-1.amazonaws.com",
+		"mirror.example.com",
+	}, registries)
+
+	_, err = DockerConfigRegistries(filepath.Join(dir, "missing.json"))
+	assert.NotNil(t, err)
+}
+
+func TestWriteDockerConfig(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	factory := mock_api.NewMockClientFactory(ctrl)
+	client := mock_api.NewMockClient(ctrl)
+	otherClient := mock_api.NewMockClient(ctrl)
+
+	helper := &ECRHelper{ClientFactory: factory}
+	otherImage := "210987654321.dkr.ecr.eu-west-1.amazonaws.com"
+	failingImage := "111111111111.dkr.ecr." + region + ".amazonaws.com"
+
+	// Registries of several regions go into the same file.
+	factory.EXPECT().NewClient(region).Return(client).Times(2)
+	factory.EXPECT().NewClient("eu-west-1").Return(otherClient)
+	client.EXPECT().GetCredentials(registryID, image).Return(&api.Credentials{Username: "AWS", Password: "first"}, nil)
+	otherClient.EXPECT().GetCredentials("210987654321", otherImage).Return(&api.Credentials{Username: "AWS", Password: "second"}, nil)
+	client.EXPECT().GetCredentials("111111111111", failingImage).Return(nil, errors.New("access denied"))
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	var output bytes.Buffer
+	err := helper.WriteDockerConfig(path, []string{image, otherImage, failingImage}, &output)
+	assert.True(t, errors.Is(err, api.ErrRegistriesNotFetched), "%v", err)
+	assert.Contains(t, output.String(), failingImage+": failed: ")
+	assert.NotContains(t, output.String(), "first")
+
+	contents, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"auths": {
+		"`+api.ParseImage(image).Host+`": {"auth": "QVdTOmZpcnN0"},
+		"`+otherImage+`": {"auth": "QVdTOnNlY29uZA=="}
+	}}`, string(contents))
+}
+
+func TestWriteDockerConfigNothingFetched(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	factory := mock_api.NewMockClientFactory(ctrl)
+	client := mock_api.NewMockClient(ctrl)
+
+	helper := &ECRHelper{ClientFactory: factory}
+	factory.EXPECT().NewClient(region).Return(client)
+	client.EXPECT().GetCredentials(registryID, image).Return(nil, errors.New("access denied"))
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	err := helper.WriteDockerConfig(path, []string{image}, ioutil.Discard)
+	assert.True(t, errors.Is(err, api.ErrRegistriesNotFetched), "%v", err)
+	_, err = ioutil.ReadFile(path)
+	assert.True(t, os.IsNotExist(err))
+}